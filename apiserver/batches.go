@@ -0,0 +1,210 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Results of the items of a report batch.
+const (
+	batchItemCreated = "created"
+	batchItemInvalid = "invalid"
+	batchItemFailed  = "failed"
+)
+
+type CreateReportBatchRequest struct {
+	// items are decoded one by one so a malformed item only fails itself
+	Reports []json.RawMessage `json:"reports"`
+}
+
+func (r CreateReportBatchRequest) Validate() error {
+	if len(r.Reports) == 0 {
+		return errors.New("reports is required")
+	}
+	return nil
+}
+
+type ApiReportBatchItem struct {
+	Index  int        `json:"index"`
+	Status string     `json:"status"`
+	Report *ApiReport `json:"report,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+type ApiReportBatchResult struct {
+	BatchId *uuid.UUID           `json:"batch_id,omitempty"`
+	Items   []ApiReportBatchItem `json:"items"`
+}
+
+type ApiReportBatch struct {
+	Id        uuid.UUID      `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Status    string         `json:"status"`
+	Total     int            `json:"total"`
+	Counts    map[string]int `json:"counts"`
+	Reports   []*ApiReport   `json:"reports"`
+}
+
+// batchStatus sums up the statuses of a batch's reports. A batch is processing until every report is done,
+// then completed, failed if every report failed or partially_failed.
+func batchStatus(counts map[string]int, total int) string {
+	switch {
+	case counts["requested"]+counts["processing"] > 0:
+		return "processing"
+	case counts["failed"] == 0:
+		return "completed"
+	case counts["failed"] == total:
+		return "failed"
+	}
+	return "partially_failed"
+}
+
+func newApiReportBatch(batch *store.ReportBatch, batchReports []store.Report) *ApiReportBatch {
+	apiBatch := &ApiReportBatch{
+		Id:        batch.Id,
+		CreatedAt: batch.CreatedAt,
+		Total:     len(batchReports),
+		Counts:    map[string]int{"requested": 0, "processing": 0, "completed": 0, "failed": 0, "expired": 0},
+		Reports:   make([]*ApiReport, 0, len(batchReports)),
+	}
+	for _, report := range batchReports {
+		apiBatch.Counts[report.Status()]++
+		apiBatch.Reports = append(apiBatch.Reports, newApiReport(&report))
+	}
+	apiBatch.Status = batchStatus(apiBatch.Counts, apiBatch.Total)
+	return apiBatch
+}
+
+// createReportBatchHandler validates every report of the batch on its own, stores the valid ones in a
+// single transaction and queues them with batched sends. Invalid items don't prevent the others from
+// being created, the response lists the result of every item in request order.
+func (s *ApiServer) createReportBatchHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[CreateReportBatchRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if len(req.Reports) > s.config.MaxReportBatchSize {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("a batch can have at most %d reports", s.config.MaxReportBatchSize))
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		items := make([]ApiReportBatchItem, len(req.Reports))
+		var valid []*store.Report
+		var validIndexes []int
+		for i, raw := range req.Reports {
+			items[i].Index = i
+			var reportReq CreateReportRequest
+			if err := json.Unmarshal(raw, &reportReq); err != nil {
+				items[i].Status, items[i].Error = batchItemInvalid, err.Error()
+				continue
+			}
+			if err := reportReq.Validate(); err != nil {
+				items[i].Status, items[i].Error = batchItemInvalid, err.Error()
+				continue
+			}
+			if err := s.validateReportRequest(user, reportReq); err != nil {
+				items[i].Status, items[i].Error = batchItemInvalid, err.Error()
+				continue
+			}
+			valid = append(valid, reportReq.report(user.Id))
+			validIndexes = append(validIndexes, i)
+		}
+
+		if len(valid) == 0 {
+			if err := encode(ApiResponse[ApiReportBatchResult]{
+				Data:    &ApiReportBatchResult{Items: items},
+				Message: "no valid reports in batch",
+			}, http.StatusUnprocessableEntity, w); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			return nil
+		}
+
+		batch, created, err := s.store.ReportBatches.Create(r.Context(), user.Id, valid, s.quotaCheck(w, len(valid)))
+		if err != nil {
+			return creationError(err)
+		}
+
+		messages := make([]reports.SqsMessage, 0, len(created))
+		for _, report := range created {
+			messages = append(messages, reports.SqsMessage{UserId: report.UserId, ReportId: report.Id, Priority: report.Priority})
+		}
+		failed, err := s.queue.EnqueueBatch(r.Context(), messages)
+		if err != nil {
+			failed = make(map[uuid.UUID]error, len(created))
+			for _, report := range created {
+				failed[report.Id] = err
+			}
+		}
+
+		for i, report := range created {
+			item := &items[validIndexes[i]]
+			item.Status = batchItemCreated
+			if enqueueErr, ok := failed[report.Id]; ok {
+				s.logger.Error("failed to enqueue report of batch", "batch_id", batch.Id, "report_id", report.Id, "error", enqueueErr)
+				report = *s.failNotEnqueued(r.Context(), &report)
+				item.Status, item.Error = batchItemFailed, notEnqueuedMessage
+			}
+			if err := s.store.ReportStore.PublishEvent(r.Context(), &report); err != nil {
+				s.logger.Error("failed to publish report event", "report_id", report.Id, "error", err)
+			}
+			item.Report = newApiReport(&report)
+		}
+
+		if err := encode(ApiResponse[ApiReportBatchResult]{
+			Data: &ApiReportBatchResult{BatchId: &batch.Id, Items: items},
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) getReportBatchHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		batchId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		batch, err := s.store.ReportBatches.ByPrimaryKey(r.Context(), user.Id, batchId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		batchReports, err := s.store.ReportBatches.Reports(r.Context(), user.Id, batch.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiReportBatch]{
+			Data: newApiReportBatch(batch, batchReports),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
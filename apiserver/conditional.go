@@ -0,0 +1,72 @@
+package apiserver
+
+import (
+	"asyncapi/store"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportETag identifies the state of a report as returned by the api. It is weak since the json encoding
+// isn't guaranteed to be byte for byte stable. The download url is part of the representation, so a
+// refreshed url changes the tag even though the report itself didn't change.
+func reportETag(report *store.Report) string {
+	h := sha256.New()
+	h.Write([]byte(report.Id.String()))
+	h.Write([]byte(strconv.FormatInt(report.UpdatedAt.UnixMicro(), 10)))
+	if report.DownloadUrlExpiresAt != nil {
+		h.Write([]byte(strconv.FormatInt(report.DownloadUrlExpiresAt.UnixMicro(), 10)))
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// reportLastModified is when the report or its download url last changed. Refreshing the url doesn't touch
+// updated_at, so the time the url was signed is derived from its expiry.
+func (s *ApiServer) reportLastModified(report *store.Report) time.Time {
+	lastModified := report.UpdatedAt
+	if report.DownloadUrlExpiresAt != nil {
+		if signedAt := report.DownloadUrlExpiresAt.Add(-s.config.PresignedUrlTtl); signedAt.After(lastModified) {
+			lastModified = signedAt
+		}
+	}
+	return lastModified
+}
+
+// etagMatches compares an If-None-Match header with an entity tag using weak comparison.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the validators of a representation and reports whether the request's preconditions
+// say the client's copy is current, in which case 304 Not Modified should be sent instead. If-None-Match
+// takes precedence over If-Modified-Since, as RFC 9110 requires.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		// http dates have a resolution of seconds
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type DiffReportsRequest struct {
+	Key              string   `json:"key,omitempty"`
+	OutputFormat     string   `json:"output_format,omitempty"`
+	Compression      string   `json:"compression,omitempty"`
+	CompressionLevel *int     `json:"compression_level,omitempty"`
+	CallbackUrl      *string  `json:"callback_url,omitempty"`
+	Title            *string  `json:"title,omitempty"`
+	Description      *string  `json:"description,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+}
+
+// Validate is a no-op, the request is validated as the report request it is turned into.
+func (r DiffReportsRequest) Validate() error {
+	return nil
+}
+
+// diffReportsHandler requests a diff report listing what changed from the report in the path to the
+// other report. The body is optional and picks the key column and output of the diff report.
+func (s *ApiServer) diffReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		baseReportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		targetReportId, err := uuid.Parse(r.PathValue("otherId"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		var diffReq DiffReportsRequest
+		if r.ContentLength != 0 {
+			if diffReq, err = decode[DiffReportsRequest](r); err != nil {
+				return NewErrWithStatus(http.StatusBadRequest, err)
+			}
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		// fail early rather than in the worker if either report can't be read
+		for _, reportId := range []uuid.UUID{baseReportId, targetReportId} {
+			if _, err := s.reportWithFile(r.Context(), user.Id, reportId); err != nil {
+				return err
+			}
+		}
+
+		parameters, err := json.Marshal(reports.DiffReportParameters{
+			BaseReportId:   baseReportId,
+			TargetReportId: targetReportId,
+			Key:            diffReq.Key,
+		})
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		req := CreateReportRequest{
+			ReportType:       reports.DiffReportType,
+			Parameters:       parameters,
+			OutputFormat:     diffReq.OutputFormat,
+			Compression:      diffReq.Compression,
+			CompressionLevel: diffReq.CompressionLevel,
+			CallbackUrl:      diffReq.CallbackUrl,
+			Title:            diffReq.Title,
+			Description:      diffReq.Description,
+			Tags:             diffReq.Tags,
+		}
+		if err := req.Validate(); err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if err := s.validateReportRequest(user, req); err != nil {
+			return err
+		}
+
+		report, err := s.submitReport(r.Context(), w, req.report(user.Id))
+		if err != nil {
+			return err
+		}
+
+		if err := encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,238 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+)
+
+// downloadFilename names the file after the report being downloaded, with the extensions of its stored
+// file, which can be the file of another report when the report was completed from the cache.
+func downloadFilename(report *store.Report) string {
+	base := path.Base(*report.OutputFilePath)
+	if i := strings.Index(base, "."); i >= 0 {
+		return report.Id.String() + base[i:]
+	}
+	return report.Id.String()
+}
+
+// downloadContentType is the content type of the artifact as stored. Compressed artifacts are served
+// as the compressed file rather than with a Content-Encoding, so ranges refer to the stored bytes.
+func downloadContentType(report *store.Report, fallback *string) string {
+	if codec, err := reports.CodecByName(report.Compression); err == nil && codec.ContentType != "" {
+		return codec.ContentType
+	}
+	if format, err := reports.FormatByName(report.OutputFormat); err == nil {
+		return format.ContentType
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return "application/octet-stream"
+}
+
+// setChecksumHeaders exposes the checksums storage computed for the whole object. Repr-Digest is only
+// set for the algorithms RFC 9530 registers.
+func setChecksumHeaders(w http.ResponseWriter, output *s3.GetObjectOutput) {
+	var digests []string
+	if output.ChecksumSHA256 != nil {
+		w.Header().Set("X-Checksum-Sha256", *output.ChecksumSHA256)
+		digests = append(digests, "sha-256=:"+*output.ChecksumSHA256+":")
+	}
+	if output.ChecksumCRC32C != nil {
+		w.Header().Set("X-Checksum-Crc32c", *output.ChecksumCRC32C)
+		digests = append(digests, "crc32c=:"+*output.ChecksumCRC32C+":")
+	}
+	if output.ChecksumCRC32 != nil {
+		w.Header().Set("X-Checksum-Crc32", *output.ChecksumCRC32)
+	}
+	if output.ChecksumCRC64NVME != nil {
+		w.Header().Set("X-Checksum-Crc64nvme", *output.ChecksumCRC64NVME)
+	}
+	if output.ChecksumSHA1 != nil {
+		w.Header().Set("X-Checksum-Sha1", *output.ChecksumSHA1)
+	}
+	for _, digest := range digests {
+		w.Header().Add("Repr-Digest", digest)
+	}
+}
+
+// storedReport loads the report named by the request path and checks that its file is still stored.
+func (s *ApiServer) storedReport(r *http.Request) (*store.Report, error) {
+	reportId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, NewErrWithStatus(http.StatusBadRequest, err)
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return nil, NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+	}
+
+	return s.reportWithFile(r.Context(), user.Id, reportId)
+}
+
+// reportWithFile loads one of the user's reports and checks that its file is still stored.
+func (s *ApiServer) reportWithFile(ctx context.Context, userId uuid.UUID, reportId uuid.UUID) (*store.Report, error) {
+	report, err := s.store.ReportStore.ByPrimaryKey(ctx, userId, reportId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NewErrWithStatus(http.StatusNotFound, err)
+		}
+		return nil, NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+
+	if err := checkReportFile(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// checkReportFile returns an error if the report has no file to download.
+func checkReportFile(report *store.Report) error {
+	if report.ExpiredAt != nil {
+		return NewErrWithStatus(http.StatusGone, fmt.Errorf("report %s expired and its file was deleted", report.Id))
+	}
+	if report.CompletedAt == nil || report.OutputFilePath == nil {
+		return NewErrWithStatus(http.StatusConflict, fmt.Errorf("report is %s and has no file to download", report.Status()))
+	}
+	return nil
+}
+
+// downloadReportHandler streams a completed report's file from storage. Range requests, If-Range,
+// If-Match and If-None-Match are supported so interrupted downloads can be resumed.
+func (s *ApiServer) downloadReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		report, err := s.storedReport(r)
+		if err != nil {
+			return err
+		}
+
+		return s.streamReport(w, r, report, true, nil)
+	})
+}
+
+// streamReport streams the report's file to the client. Without acceptRanges the Range header is ignored
+// and the whole file is always sent. beforeStream, if set, is called once the file was found and before
+// anything is written, an error from it is returned instead of the file.
+func (s *ApiServer) streamReport(w http.ResponseWriter, r *http.Request, report *store.Report, acceptRanges bool, beforeStream func() error) error {
+	input := &s3.GetObjectInput{
+		Bucket:       aws.String(s.config.S3Bucket),
+		Key:          report.OutputFilePath,
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		input.IfMatch = aws.String(ifMatch)
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		input.IfNoneMatch = aws.String(ifNoneMatch)
+	}
+	if rangeHeader := r.Header.Get("Range"); acceptRanges && rangeHeader != "" {
+		// a range is only served if the file is still the one the client started downloading
+		ifRange := r.Header.Get("If-Range")
+		if ifRange == "" {
+			input.Range = aws.String(rangeHeader)
+		} else {
+			head, err := s.s3Client.HeadObject(r.Context(), &s3.HeadObjectInput{
+				Bucket: input.Bucket,
+				Key:    input.Key,
+			})
+			if err != nil {
+				return s.downloadError(w, report, err)
+			}
+			if aws.ToString(head.ETag) == ifRange {
+				input.Range = aws.String(rangeHeader)
+			}
+		}
+	}
+
+	output, err := s.s3Client.GetObject(r.Context(), input)
+	if err != nil {
+		return s.downloadError(w, report, err)
+	}
+	defer output.Body.Close()
+
+	if beforeStream != nil {
+		if err := beforeStream(); err != nil {
+			return err
+		}
+	}
+
+	status := http.StatusOK
+	if output.ContentRange != nil {
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", *output.ContentRange)
+	} else {
+		setChecksumHeaders(w, output)
+	}
+
+	w.Header().Set("Content-Type", downloadContentType(report, output.ContentType))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": downloadFilename(report),
+	}))
+	if acceptRanges {
+		w.Header().Set("Accept-Ranges", "bytes")
+	} else {
+		w.Header().Set("Accept-Ranges", "none")
+	}
+	w.Header().Set("Cache-Control", "private")
+	if output.ETag != nil {
+		w.Header().Set("ETag", *output.ETag)
+	}
+	if output.LastModified != nil {
+		w.Header().Set("Last-Modified", output.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if output.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*output.ContentLength, 10))
+	}
+	w.WriteHeader(status)
+
+	if _, err := io.Copy(w, output.Body); err != nil {
+		s.logger.Error("failed to stream report download", "report_id", report.Id, "error", err)
+	}
+	return nil
+}
+
+// downloadError maps storage errors for conditional and range requests to their HTTP responses.
+func (s *ApiServer) downloadError(w http.ResponseWriter, report *store.Report, err error) error {
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.HTTPStatusCode() {
+		case http.StatusNotModified:
+			// a 304 carries the validators the full response would have had, storage sends them with its own
+			for _, name := range []string{"ETag", "Last-Modified"} {
+				if value := responseErr.Response.Header.Get(name); value != "" {
+					w.Header().Set(name, value)
+				}
+			}
+			w.Header().Set("Cache-Control", "private")
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		case http.StatusPreconditionFailed:
+			return NewErrWithStatus(http.StatusPreconditionFailed, err)
+		case http.StatusRequestedRangeNotSatisfiable:
+			if report.CompressedSizeBytes != nil {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", *report.CompressedSizeBytes))
+			}
+			return NewErrWithStatus(http.StatusRequestedRangeNotSatisfiable, err)
+		case http.StatusNotFound:
+			return NewErrWithStatus(http.StatusNotFound, fmt.Errorf("file of report %s no longer exists: %w", report.Id, err))
+		}
+	}
+	return NewErrWithStatus(http.StatusInternalServerError, err)
+}
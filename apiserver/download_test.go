@@ -0,0 +1,140 @@
+package apiserver_test
+
+import (
+	"asyncapi/apiserver"
+	"asyncapi/fixtures"
+	"asyncapi/reports"
+	"asyncapi/store"
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStorage serves a single object the way S3 does for conditional and range requests.
+func fakeStorage(t *testing.T, content []byte, etag string, lastModified time.Time) *s3.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		// unlike http.ServeContent, S3 keeps Last-Modified on a 304
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		r.Header.Del("If-None-Match")
+		http.ServeContent(w, r, "", lastModified, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+}
+
+func TestDownloadReport(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	dataStore := store.New(env.Db)
+	user, err := dataStore.Users.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	content := []byte("id,name\n1,bokoblin\n2,moblin\n")
+	size := int64(len(content))
+	report, err := dataStore.ReportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters", Compression: "none"})
+	require.NoError(t, err)
+	now := time.Now()
+	path := "/users/" + user.Id.String() + "/report/" + report.Id.String() + ".csv"
+	report.StartedAt = &now
+	report.CompletedAt = &now
+	report.OutputFilePath = &path
+	report.CompressedSizeBytes = &size
+	report, err = dataStore.ReportStore.Update(ctx, report)
+	require.NoError(t, err)
+
+	etag := `"3858f62230ac3c915f300c664312c63f"`
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	conf := *env.Config
+	conf.S3Bucket = "reports"
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	server := apiserver.New(&conf, logger, dataStore, nil, nil, fakeStorage(t, content, etag, lastModified), nil, reports.DefaultRegistry())
+
+	mux := http.NewServeMux()
+	for _, route := range server.Routes() {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{name: "whole file", status: http.StatusOK, body: string(content)},
+		{name: "range", headers: map[string]string{"Range": "bytes=0-6"}, status: http.StatusPartialContent, body: "id,name", contentRange: "bytes 0-6/" + strconv.FormatInt(size, 10)},
+		{name: "open ended range", headers: map[string]string{"Range": "bytes=19-"}, status: http.StatusPartialContent, body: "2,moblin\n", contentRange: "bytes 19-27/" + strconv.FormatInt(size, 10)},
+		{name: "if-range of the current file", headers: map[string]string{"Range": "bytes=0-6", "If-Range": etag}, status: http.StatusPartialContent, body: "id,name", contentRange: "bytes 0-6/" + strconv.FormatInt(size, 10)},
+		{name: "if-range of a replaced file", headers: map[string]string{"Range": "bytes=0-6", "If-Range": `"stale"`}, status: http.StatusOK, body: string(content)},
+		{name: "if-none-match of the current file", headers: map[string]string{"If-None-Match": etag}, status: http.StatusNotModified},
+		{name: "if-none-match of a replaced file", headers: map[string]string{"If-None-Match": `"stale"`}, status: http.StatusOK, body: string(content)},
+		{name: "unsatisfiable range", headers: map[string]string{"Range": "bytes=100-200"}, status: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */" + strconv.FormatInt(size, 10)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/reports/"+report.Id.String()+"/download", nil)
+			r = r.WithContext(apiserver.ContextWithUser(r.Context(), user))
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			require.Equal(t, test.status, w.Code, w.Body.String())
+			require.Equal(t, test.contentRange, w.Header().Get("Content-Range"))
+			if test.status == http.StatusRequestedRangeNotSatisfiable {
+				return
+			}
+
+			// every response with the file, and a 304 in its place, carries its validators
+			require.Equal(t, etag, w.Header().Get("ETag"))
+			require.Equal(t, lastModified.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+			if test.status == http.StatusNotModified {
+				require.Empty(t, w.Body.String())
+				return
+			}
+			require.Equal(t, test.body, w.Body.String())
+			require.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+			require.Equal(t, `attachment; filename=`+report.Id.String()+`.csv`, w.Header().Get("Content-Disposition"))
+		})
+	}
+
+	t.Run("share link ignores ranges", func(t *testing.T) {
+		_, err := dataStore.ShareLinks.Create(ctx, &store.ShareLink{UserId: user.Id, ReportId: report.Id, ExpiresAt: time.Now().Add(time.Hour)}, "sharetoken")
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/shared/sharetoken", nil)
+		r.Header.Set("Range", "bytes=0-6")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Equal(t, string(content), w.Body.String())
+		require.Empty(t, w.Header().Get("Content-Range"))
+		require.Equal(t, "none", w.Header().Get("Accept-Ranges"))
+	})
+}
@@ -0,0 +1,347 @@
+package apiserver
+
+import (
+	"asyncapi/store"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	// reportProgressEvent is sent instead of the status when a report made progress without changing status
+	reportProgressEvent = "progress"
+	// reportResyncEvent tells streams of all reports that events may have been missed, so clients reload
+	reportResyncEvent = "resync"
+
+	reportEventBufferSize      = 16
+	reportEventStreamHeartbeat = 15 * time.Second
+)
+
+type reportSubscription struct {
+	reportId *uuid.UUID
+	events   chan store.ReportEvent
+}
+
+// ReportEventHub fans report status notifications received over Postgres LISTEN/NOTIFY out to the
+// streams open on this apiserver instance.
+type ReportEventHub struct {
+	logger      *slog.Logger
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[*reportSubscription]struct{}
+}
+
+func NewReportEventHub(logger *slog.Logger) *ReportEventHub {
+	return &ReportEventHub{
+		logger:      logger,
+		subscribers: make(map[uuid.UUID]map[*reportSubscription]struct{}),
+	}
+}
+
+// Subscribe returns the events for one of the user's reports, or for all of them when reportId is nil.
+// The returned function must be called once the subscriber stops reading.
+func (h *ReportEventHub) Subscribe(userId uuid.UUID, reportId *uuid.UUID) (<-chan store.ReportEvent, func()) {
+	subscription := &reportSubscription{
+		reportId: reportId,
+		events:   make(chan store.ReportEvent, reportEventBufferSize),
+	}
+
+	h.mu.Lock()
+	if h.subscribers[userId] == nil {
+		h.subscribers[userId] = make(map[*reportSubscription]struct{})
+	}
+	h.subscribers[userId][subscription] = struct{}{}
+	h.mu.Unlock()
+
+	return subscription.events, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[userId], subscription)
+		if len(h.subscribers[userId]) == 0 {
+			delete(h.subscribers, userId)
+		}
+	}
+}
+
+func (h *ReportEventHub) Publish(event store.ReportEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for subscription := range h.subscribers[event.UserId] {
+		if subscription.reportId != nil && *subscription.reportId != event.ReportId {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			// subscribers reload the report on every event, so a slow one only misses intermediate states
+			h.logger.Warn("dropping report event for slow subscriber", "report_id", event.ReportId, "status", event.Status)
+		}
+	}
+}
+
+// Resync wakes every subscriber so they reload their reports, after notifications may have been lost.
+// Subscriptions to all of a user's reports get an event without a report id. Subscribers that already
+// have events waiting are skipped, they reload on those.
+func (h *ReportEventHub) Resync() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for userId, subscriptions := range h.subscribers {
+		for subscription := range subscriptions {
+			event := store.ReportEvent{UserId: userId}
+			if subscription.reportId != nil {
+				event.ReportId = *subscription.reportId
+			}
+			select {
+			case subscription.events <- event:
+			default:
+			}
+		}
+	}
+}
+
+// Run publishes notifications until ctx is done or the channel is closed.
+func (h *ReportEventHub) Run(ctx context.Context, notifications <-chan *pq.Notification) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification, ok := <-notifications:
+			if !ok {
+				return
+			}
+			// a nil notification means the listener reconnected and events may have been missed
+			if notification == nil {
+				h.logger.Warn("report event listener reconnected, resyncing subscribers")
+				h.Resync()
+				continue
+			}
+
+			var event store.ReportEvent
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				h.logger.Error("failed to decode report event", "payload", notification.Extra, "error", err)
+				continue
+			}
+			h.Publish(event)
+		}
+	}
+}
+
+// listenForReportEvents subscribes to report notifications in Postgres and feeds them into the hub.
+func (s *ApiServer) listenForReportEvents(ctx context.Context) error {
+	listener := pq.NewListener(s.config.DatabaseUrl(), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			s.logger.Error("report event listener error", "event", event, "error", err)
+		}
+	})
+	if err := listener.Listen(store.ReportEventsChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to listen on %s: %w", store.ReportEventsChannel, err)
+	}
+
+	go func() {
+		defer listener.Close()
+		s.events.Run(ctx, listener.Notify)
+	}()
+	return nil
+}
+
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &eventStream{w: w, flusher: flusher}, nil
+}
+
+func (s *eventStream) send(event string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, encoded); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *eventStream) heartbeat() error {
+	if _, err := fmt.Fprint(s.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// reportEventsHandler streams the status of a report until it completes or fails. Each event is named
+// after the report's status, or progress while it is being built, and carries the report.
+func (s *ApiServer) reportEventsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		// subscribe before reading the report so no transition is missed in between
+		events, unsubscribe := s.events.Subscribe(user.Id, &reportId)
+		defer unsubscribe()
+
+		report, err := s.store.ReportStore.ByPrimaryKey(r.Context(), user.Id, reportId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		stream, err := newEventStream(w)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		status := report.Status()
+		if err := stream.send(status, newApiReport(report)); err != nil {
+			return nil
+		}
+
+		heartbeat := time.NewTicker(reportEventStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		for !report.IsDone() {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-heartbeat.C:
+				if err := stream.heartbeat(); err != nil {
+					return nil
+				}
+			case <-events:
+				report, err = s.store.ReportStore.ByPrimaryKey(r.Context(), user.Id, reportId)
+				if err != nil {
+					s.logger.Error("failed to reload streamed report", "report_id", reportId, "error", err)
+					return nil
+				}
+				event := reportProgressEvent
+				if report.Status() != status {
+					status = report.Status()
+					event = status
+				}
+				if err := stream.send(event, newApiReport(report)); err != nil {
+					return nil
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// allReportEventsHandler streams status changes and progress of all of the user's reports.
+func (s *ApiServer) allReportEventsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		events, unsubscribe := s.events.Subscribe(user.Id, nil)
+		defer unsubscribe()
+
+		stream, err := newEventStream(w)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		heartbeat := time.NewTicker(reportEventStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-heartbeat.C:
+				if err := stream.heartbeat(); err != nil {
+					return nil
+				}
+			case event := <-events:
+				if event.ReportId == uuid.Nil {
+					if err := stream.send(reportResyncEvent, struct{}{}); err != nil {
+						return nil
+					}
+					continue
+				}
+				report, err := s.store.ReportStore.ByPrimaryKey(r.Context(), user.Id, event.ReportId)
+				if err != nil {
+					// the report may have been deleted since
+					s.logger.Warn("failed to load streamed report", "report_id", event.ReportId, "error", err)
+					continue
+				}
+				if err := stream.send(report.Status(), newApiReport(report)); err != nil {
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// waitForReport blocks until the report completes or fails, the wait passes or the client goes away, and
+// returns the report as it is then. Waiting is rejected once too many requests are already waiting.
+func (s *ApiServer) waitForReport(r *http.Request, report *store.Report, events <-chan store.ReportEvent, wait time.Duration) (*store.Report, error) {
+	select {
+	case s.waiters <- struct{}{}:
+		defer func() { <-s.waiters }()
+	default:
+		return nil, NewErrWithStatus(http.StatusServiceUnavailable, errors.New("too many requests are waiting for reports"))
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for !report.IsDone() {
+		select {
+		case <-r.Context().Done():
+			return report, nil
+		case <-timer.C:
+			return report, nil
+		case <-events:
+			reloaded, err := s.store.ReportStore.ByPrimaryKey(r.Context(), report.UserId, report.Id)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil, NewErrWithStatus(http.StatusNotFound, err)
+				}
+				return nil, NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			report = reloaded
+		}
+	}
+
+	return report, nil
+}
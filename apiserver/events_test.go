@@ -0,0 +1,202 @@
+package apiserver_test
+
+import (
+	"asyncapi/apiserver"
+	"asyncapi/fixtures"
+	"asyncapi/reports"
+	"asyncapi/store"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportEventHub(t *testing.T) {
+	hub := apiserver.NewReportEventHub(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+
+	userId := uuid.New()
+	reportId := uuid.New()
+	otherReportId := uuid.New()
+
+	reportEvents, unsubscribeReport := hub.Subscribe(userId, &reportId)
+	allEvents, unsubscribeAll := hub.Subscribe(userId, nil)
+	otherUserEvents, unsubscribeOtherUser := hub.Subscribe(uuid.New(), nil)
+	defer unsubscribeAll()
+	defer unsubscribeOtherUser()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifications := make(chan *pq.Notification)
+	go hub.Run(ctx, notifications)
+
+	notify := func(event store.ReportEvent) {
+		payload, err := json.Marshal(event)
+		require.NoError(t, err)
+		notifications <- &pq.Notification{Channel: store.ReportEventsChannel, Extra: string(payload)}
+	}
+
+	processing := store.ReportEvent{UserId: userId, ReportId: reportId, Status: "processing"}
+	notify(processing)
+	require.Equal(t, processing, receiveEvent(t, reportEvents))
+	require.Equal(t, processing, receiveEvent(t, allEvents))
+
+	other := store.ReportEvent{UserId: userId, ReportId: otherReportId, Status: "requested"}
+	notify(other)
+	require.Equal(t, other, receiveEvent(t, allEvents))
+
+	unsubscribeReport()
+	notify(store.ReportEvent{UserId: userId, ReportId: reportId, Status: "completed"})
+	receiveEvent(t, allEvents)
+
+	require.Empty(t, reportEvents)
+	require.Empty(t, otherUserEvents)
+}
+
+func TestReportEventHubResync(t *testing.T) {
+	hub := apiserver.NewReportEventHub(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+
+	userId := uuid.New()
+	reportId := uuid.New()
+	slowReportId := uuid.New()
+	reportEvents, unsubscribeReport := hub.Subscribe(userId, &reportId)
+	allEvents, unsubscribeAll := hub.Subscribe(userId, nil)
+	slowEvents, unsubscribeSlow := hub.Subscribe(userId, &slowReportId)
+	defer unsubscribeReport()
+	defer unsubscribeAll()
+	defer unsubscribeSlow()
+
+	// a subscriber that stopped reading can't hold up the others
+	for range cap(slowEvents) {
+		hub.Publish(store.ReportEvent{UserId: userId, ReportId: slowReportId, Status: "processing"})
+	}
+	for range cap(slowEvents) {
+		receiveEvent(t, allEvents)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifications := make(chan *pq.Notification)
+	go hub.Run(ctx, notifications)
+
+	// the listener sends nil after reconnecting, notifications sent while it was down are lost
+	notifications <- nil
+	require.Equal(t, store.ReportEvent{UserId: userId, ReportId: reportId}, receiveEvent(t, reportEvents))
+	require.Equal(t, store.ReportEvent{UserId: userId}, receiveEvent(t, allEvents))
+	require.Len(t, slowEvents, cap(slowEvents))
+
+	completed := store.ReportEvent{UserId: userId, ReportId: reportId, Status: "completed"}
+	payload, err := json.Marshal(completed)
+	require.NoError(t, err)
+	notifications <- &pq.Notification{Channel: store.ReportEventsChannel, Extra: string(payload)}
+	require.Equal(t, completed, receiveEvent(t, reportEvents))
+}
+
+func receiveEvent(t *testing.T, events <-chan store.ReportEvent) store.ReportEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for report event")
+		return store.ReportEvent{}
+	}
+}
+
+func TestGetReportWait(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	dataStore := store.New(env.Db)
+	user, err := dataStore.Users.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+	report, err := dataStore.ReportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+
+	conf := *env.Config
+	conf.MaxReportWaiters = 1
+	conf.MaxReportWait = time.Minute
+	server := apiserver.New(&conf, slog.New(slog.NewTextHandler(os.Stdout, nil)), dataStore, nil, nil, nil, nil, reports.DefaultRegistry())
+	mux := http.NewServeMux()
+	for _, route := range server.Routes() {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
+
+	get := func(wait string) (int, *apiserver.ApiReport) {
+		r := httptest.NewRequest(http.MethodGet, "/reports/"+report.Id.String()+"?wait="+wait, nil)
+		r = r.WithContext(apiserver.ContextWithUser(r.Context(), user))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		var response apiserver.ApiResponse[apiserver.ApiReport]
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response.Data
+	}
+
+	// the wait passing returns the report as it is
+	started := time.Now()
+	status, waited := get("50ms")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "requested", waited.Status)
+	require.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+	type result struct {
+		status int
+		report *apiserver.ApiReport
+	}
+	results := make(chan result, 1)
+	go func() {
+		var w *httptest.ResponseRecorder
+		// retried while one of the probes below holds the only slot
+		for w == nil || w.Code == http.StatusServiceUnavailable {
+			r := httptest.NewRequest(http.MethodGet, "/reports/"+report.Id.String()+"?wait=30s", nil)
+			r = r.WithContext(apiserver.ContextWithUser(r.Context(), user))
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+		}
+		var response apiserver.ApiResponse[apiserver.ApiReport]
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			results <- result{status: w.Code}
+			return
+		}
+		results <- result{status: w.Code, report: response.Data}
+	}()
+
+	// once MAX_REPORT_WAITERS requests are waiting, more are turned away
+	require.Eventually(t, func() bool {
+		status, _ := get("1ms")
+		return status == http.StatusServiceUnavailable
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the waiter returns as soon as the report finished
+	now := time.Now()
+	errorMessage := "generator failed"
+	report.StartedAt = &now
+	report.FailedAt = &now
+	report.ErrorMessage = &errorMessage
+	_, err = dataStore.ReportStore.Update(ctx, report)
+	require.NoError(t, err)
+	server.Events().Publish(store.ReportEvent{UserId: user.Id, ReportId: report.Id, Status: "failed"})
+
+	select {
+	case result := <-results:
+		require.Equal(t, http.StatusOK, result.status)
+		require.Equal(t, "failed", result.report.Status)
+		require.Equal(t, errorMessage, *result.report.ErrorMessage)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter didn't return after the report failed")
+	}
+
+	// finished reports are returned without waiting, and the waiter's slot was released
+	status, waited = get("30s")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "failed", waited.Status)
+}
@@ -2,17 +2,22 @@ package apiserver
 
 import (
 	"asyncapi/reports"
+	"asyncapi/schema"
+	"asyncapi/store"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
 )
 
 type SignupRequest struct {
@@ -206,28 +211,289 @@ func (s *ApiServer) tokenRefreshHandler() http.HandlerFunc {
 }
 
 type CreateReportRequest struct {
-	ReportType string `json:"report_type"`
+	ReportType       string          `json:"report_type"`
+	Parameters       json.RawMessage `json:"parameters,omitempty"`
+	OutputFormat     string          `json:"output_format,omitempty"`
+	Compression      string          `json:"compression,omitempty"`
+	CompressionLevel *int            `json:"compression_level,omitempty"`
+	CallbackUrl      *string         `json:"callback_url,omitempty"`
+	Priority         string          `json:"priority,omitempty"`
+	Title            *string         `json:"title,omitempty"`
+	Description      *string         `json:"description,omitempty"`
+	Tags             []string        `json:"tags,omitempty"`
+	Cache            *bool           `json:"cache,omitempty"`
+}
+
+const (
+	maxReportTitleLength       = 200
+	maxReportDescriptionLength = 2000
+)
+
+// validateReportMetadata checks the parts of a report its owner can change after creating it.
+func validateReportMetadata(title *string, description *string, tags []string) error {
+	if title != nil && len([]rune(*title)) > maxReportTitleLength {
+		return fmt.Errorf("title can be at most %d characters", maxReportTitleLength)
+	}
+	if description != nil && len([]rune(*description)) > maxReportDescriptionLength {
+		return fmt.Errorf("description can be at most %d characters", maxReportDescriptionLength)
+	}
+	_, err := reports.NormalizeTags(tags)
+	return err
+}
+
+// optionalText trims the text, an empty text is no text.
+func optionalText(text *string) *string {
+	if text == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*text)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
 }
 
 func (r CreateReportRequest) Validate() error {
 	if r.ReportType == "" {
 		return errors.New("report_type is required")
 	}
+	if r.OutputFormat != "" {
+		if _, err := reports.FormatByName(r.OutputFormat); err != nil {
+			return err
+		}
+	}
+	compression := r.Compression
+	if compression == "" {
+		compression = reports.DefaultCompression
+	}
+	codec, err := reports.CodecByName(compression)
+	if err != nil {
+		return err
+	}
+	if r.CompressionLevel != nil {
+		if err := codec.ValidateLevel(*r.CompressionLevel); err != nil {
+			return err
+		}
+	}
+	if r.CallbackUrl != nil {
+		if err := reports.ValidateWebhookUrl(*r.CallbackUrl); err != nil {
+			return fmt.Errorf("callback_url: %w", err)
+		}
+	}
+	if r.Priority != "" {
+		if err := reports.ValidatePriority(r.Priority); err != nil {
+			return err
+		}
+	}
+	return validateReportMetadata(r.Title, r.Description, r.Tags)
+}
+
+// hasReportOnlyFields reports whether the request sets any of the title, description, tags or cache, which
+// belong to a single report and can't be set on templates or schedules.
+func (r CreateReportRequest) hasReportOnlyFields() bool {
+	return r.Title != nil || r.Description != nil || len(r.Tags) > 0 || r.Cache != nil
+}
+
+func (r CreateReportRequest) report(userId uuid.UUID) *store.Report {
+	// validated already
+	tags, _ := reports.NormalizeTags(r.Tags)
+	return &store.Report{
+		UserId:           userId,
+		ReportType:       r.ReportType,
+		Parameters:       types.JSONText(r.Parameters),
+		OutputFormat:     r.OutputFormat,
+		Compression:      r.Compression,
+		CompressionLevel: r.CompressionLevel,
+		CallbackUrl:      r.CallbackUrl,
+		Priority:         r.Priority,
+		Title:            optionalText(r.Title),
+		Description:      optionalText(r.Description),
+		Tags:             tags,
+		SkipCache:        r.Cache != nil && !*r.Cache,
+	}
+}
+
+// validateReportRequest runs the checks on a report request that depend on the server's configuration
+// and the user making it.
+func (s *ApiServer) validateReportRequest(user *store.User, req CreateReportRequest) error {
+	if err := s.reportTypes.Validate(req.ReportType, req.Parameters); err != nil {
+		return NewErrWithStatus(http.StatusBadRequest, err)
+	}
+	if req.CallbackUrl != nil && s.config.WebhookSigningKey == "" {
+		return NewErrWithStatus(http.StatusBadRequest, errors.New("callback urls are not enabled on this server"))
+	}
+	if req.Priority != "" && !reports.PriorityAllowed(s.config, user.Role, req.Priority) {
+		return NewErrWithStatus(http.StatusForbidden, fmt.Errorf("priority %s is not available to your account", req.Priority))
+	}
 	return nil
 }
 
+type ApiReportType struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  *schema.Schema `json:"parameters"`
+}
+
+func (s *ApiServer) listReportTypesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		generators := s.reportTypes.Generators()
+		reportTypes := make([]ApiReportType, 0, len(generators))
+		for _, generator := range generators {
+			reportTypes = append(reportTypes, ApiReportType{
+				Name:        generator.Name(),
+				Description: generator.Description(),
+				Parameters:  generator.ParameterSchema(),
+			})
+		}
+
+		if err := encode(ApiResponse[[]ApiReportType]{
+			Data: &reportTypes,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// download urls about to expire are refreshed so clients have time to use the one they get
+const downloadUrlRefreshMargin = 30 * time.Second
+
 type ApiReport struct {
-	Id                   uuid.UUID  `json:"id"`
-	ReportType           string     `json:"report_type,omitempty"`
-	OutputFilePath       *string    `json:"output_file_path,omitempty"`
-	DownloadUrl          *string    `json:"download_url,omitempty"`
-	DownloadUrlExpiresAt *time.Time `json:"download_url_expires_at,omitempty"`
-	ErrorMessage         *string    `json:"error_message,omitempty"`
-	CreatedAt            time.Time  `json:"created_at,omitempty"`
-	StartedAt            *time.Time `json:"started_at,omitempty"`
-	CompletedAt          *time.Time `json:"completed_at,omitempty"`
-	FailedAt             *time.Time `json:"failed_at,omitempty"`
-	Status               string     `json:"status,omitempty"`
+	Id                    uuid.UUID       `json:"id"`
+	ReportType            string          `json:"report_type,omitempty"`
+	OutputFilePath        *string         `json:"output_file_path,omitempty"`
+	DownloadUrl           *string         `json:"download_url,omitempty"`
+	DownloadUrlExpiresAt  *time.Time      `json:"download_url_expires_at,omitempty"`
+	ErrorMessage          *string         `json:"error_message,omitempty"`
+	CreatedAt             time.Time       `json:"created_at,omitempty"`
+	UpdatedAt             time.Time       `json:"updated_at,omitempty"`
+	StartedAt             *time.Time      `json:"started_at,omitempty"`
+	CompletedAt           *time.Time      `json:"completed_at,omitempty"`
+	FailedAt              *time.Time      `json:"failed_at,omitempty"`
+	Status                string          `json:"status,omitempty"`
+	Parameters            json.RawMessage `json:"parameters,omitempty"`
+	OutputFormat          string          `json:"output_format,omitempty"`
+	Compression           string          `json:"compression,omitempty"`
+	CompressionLevel      *int            `json:"compression_level,omitempty"`
+	Priority              string          `json:"priority,omitempty"`
+	Title                 *string         `json:"title,omitempty"`
+	Description           *string         `json:"description,omitempty"`
+	Tags                  []string        `json:"tags"`
+	CacheHit              bool            `json:"cache_hit"`
+	UncompressedSizeBytes *int64          `json:"uncompressed_size_bytes,omitempty"`
+	CompressedSizeBytes   *int64          `json:"compressed_size_bytes,omitempty"`
+	CompressionRatio      *float64        `json:"compression_ratio,omitempty"`
+	RowCount              *int64          `json:"row_count,omitempty"`
+	ContentType           *string         `json:"content_type,omitempty"`
+	Sha256                *string         `json:"sha256,omitempty"`
+	CallbackUrl           *string         `json:"callback_url,omitempty"`
+	ScheduleId            *uuid.UUID      `json:"schedule_id,omitempty"`
+	BatchId               *uuid.UUID      `json:"batch_id,omitempty"`
+	TemplateId            *uuid.UUID      `json:"template_id,omitempty"`
+	Pinned                bool            `json:"pinned"`
+	ExpiredAt             *time.Time      `json:"expired_at,omitempty"`
+	Phase                 *string         `json:"phase,omitempty"`
+	RowsProcessed         int64           `json:"rows_processed"`
+	RowsTotal             *int64          `json:"rows_total,omitempty"`
+	Progress              *float64        `json:"progress,omitempty"`
+	HeartbeatAt           *time.Time      `json:"heartbeat_at,omitempty"`
+	EstimatedCompletionAt *time.Time      `json:"estimated_completion_at,omitempty"`
+}
+
+func newApiReport(report *store.Report) *ApiReport {
+	var compressionRatio *float64
+	if report.UncompressedSizeBytes != nil && report.CompressedSizeBytes != nil && *report.CompressedSizeBytes > 0 {
+		ratio := float64(*report.UncompressedSizeBytes) / float64(*report.CompressedSizeBytes)
+		compressionRatio = &ratio
+	}
+	tags := []string(report.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return &ApiReport{
+		Id:                    report.Id,
+		ReportType:            report.ReportType,
+		OutputFilePath:        report.OutputFilePath,
+		DownloadUrl:           report.DownloadUrl,
+		DownloadUrlExpiresAt:  report.DownloadUrlExpiresAt,
+		ErrorMessage:          report.ErrorMessage,
+		CreatedAt:             report.CreatedAt,
+		UpdatedAt:             report.UpdatedAt,
+		StartedAt:             report.StartedAt,
+		CompletedAt:           report.CompletedAt,
+		FailedAt:              report.FailedAt,
+		Status:                report.Status(),
+		Parameters:            json.RawMessage(report.Parameters),
+		OutputFormat:          report.OutputFormat,
+		Compression:           report.Compression,
+		CompressionLevel:      report.CompressionLevel,
+		UncompressedSizeBytes: report.UncompressedSizeBytes,
+		CompressedSizeBytes:   report.CompressedSizeBytes,
+		CompressionRatio:      compressionRatio,
+		RowCount:              report.RowCount,
+		ContentType:           report.ContentType,
+		Sha256:                report.Sha256,
+		CallbackUrl:           report.CallbackUrl,
+		ScheduleId:            report.ScheduleId,
+		BatchId:               report.BatchId,
+		TemplateId:            report.TemplateId,
+		Priority:              report.Priority,
+		Title:                 report.Title,
+		Description:           report.Description,
+		Tags:                  tags,
+		CacheHit:              report.CacheHit,
+		Pinned:                report.Pinned,
+		ExpiredAt:             report.ExpiredAt,
+		Phase:                 report.Phase,
+		RowsProcessed:         report.RowsProcessed,
+		RowsTotal:             report.RowsTotal,
+		Progress:              report.Progress(),
+		HeartbeatAt:           report.HeartbeatAt,
+		EstimatedCompletionAt: report.EstimatedCompletion(),
+	}
+}
+
+// submitReport stores a report built from a validated request if the user's quotas allow it and queues it
+// for the workers.
+func (s *ApiServer) submitReport(ctx context.Context, w http.ResponseWriter, report *store.Report) (*store.Report, error) {
+	report, err := s.store.ReportStore.CreateWithinQuota(ctx, report, s.quotaCheck(w, 1))
+	if err != nil {
+		return nil, creationError(err)
+	}
+
+	if err := s.store.ReportStore.PublishEvent(ctx, report); err != nil {
+		s.logger.Error("failed to publish report event", "report_id", report.Id, "error", err)
+	}
+
+	if err := s.queue.Enqueue(ctx, reports.SqsMessage{UserId: report.UserId, ReportId: report.Id, Priority: report.Priority}); err != nil {
+		failed := s.failNotEnqueued(ctx, report)
+		if err := s.store.ReportStore.PublishEvent(ctx, failed); err != nil {
+			s.logger.Error("failed to publish report event", "report_id", report.Id, "error", err)
+		}
+		return nil, NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+
+	return report, nil
+}
+
+const notEnqueuedMessage = "failed to enqueue report"
+
+// failNotEnqueued fails a report that couldn't be queued. It would never be picked up, and would count
+// against the in flight quota forever if it was left requested. Errors are only logged, the report is
+// returned unchanged then.
+func (s *ApiServer) failNotEnqueued(ctx context.Context, report *store.Report) *store.Report {
+	now := time.Now()
+	errMsg := notEnqueuedMessage
+	report.FailedAt = &now
+	report.ErrorMessage = &errMsg
+	updated, err := s.store.ReportStore.Update(ctx, report)
+	if err != nil {
+		s.logger.Error("failed to update report", "report_id", report.Id, "error", err)
+		return report
+	}
+	return updated
 }
 
 func (s *ApiServer) createReportHandler() http.HandlerFunc {
@@ -241,48 +507,18 @@ func (s *ApiServer) createReportHandler() http.HandlerFunc {
 		if !ok {
 			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
 		}
-		report, err := s.store.ReportStore.Create(r.Context(), user.Id, req.ReportType)
-		if err != nil {
-			return NewErrWithStatus(http.StatusInternalServerError, err)
-		}
-
-		sqsMessage := reports.SqsMessage{
-			UserId:   report.UserId,
-			ReportId: report.Id,
-		}
-
-		bytes, err := json.Marshal(sqsMessage)
-		if err != nil {
-			return NewErrWithStatus(http.StatusInternalServerError, err)
-		}
 
-		queueUrlOutput, err := s.sqsClient.GetQueueUrl(r.Context(), &sqs.GetQueueUrlInput{QueueName: aws.String(s.config.SqsQueue)})
-		if err != nil {
-			return NewErrWithStatus(http.StatusInternalServerError, err)
+		if err := s.validateReportRequest(user, req); err != nil {
+			return err
 		}
 
-		_, err = s.sqsClient.SendMessage(r.Context(), &sqs.SendMessageInput{
-			QueueUrl:    queueUrlOutput.QueueUrl,
-			MessageBody: aws.String(string(bytes)),
-		})
+		report, err := s.submitReport(r.Context(), w, req.report(user.Id))
 		if err != nil {
-			return NewErrWithStatus(http.StatusInternalServerError, err)
+			return err
 		}
 
 		if err := encode(ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				Id:                   report.Id,
-				ReportType:           report.ReportType,
-				OutputFilePath:       report.OutputFilePath,
-				DownloadUrl:          report.DownloadUrl,
-				DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
-				ErrorMessage:         report.ErrorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            report.StartedAt,
-				CompletedAt:          report.CompletedAt,
-				FailedAt:             report.FailedAt,
-				Status:               report.Status(),
-			},
+			Data: newApiReport(report),
 		}, http.StatusCreated, w); err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
@@ -299,11 +535,28 @@ func (s *ApiServer) getReportHandler() http.HandlerFunc {
 			return NewErrWithStatus(http.StatusBadRequest, err)
 		}
 
+		var wait time.Duration
+		if waitStr := r.URL.Query().Get("wait"); waitStr != "" {
+			wait, err = time.ParseDuration(waitStr)
+			if err != nil || wait < 0 {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("wait must be a non-negative duration such as 30s"))
+			}
+			wait = min(wait, s.config.MaxReportWait)
+		}
+
 		user, ok := UserFromContext(r.Context())
 		if !ok {
 			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
 		}
 
+		var events <-chan store.ReportEvent
+		if wait > 0 {
+			// subscribe before reading the report so a transition in between still wakes the waiter
+			var unsubscribe func()
+			events, unsubscribe = s.events.Subscribe(user.Id, &reportId)
+			defer unsubscribe()
+		}
+
 		report, err := s.store.ReportStore.ByPrimaryKey(r.Context(), user.Id, reportId)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
@@ -312,41 +565,148 @@ func (s *ApiServer) getReportHandler() http.HandlerFunc {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
 
+		if wait > 0 && !report.IsDone() {
+			report, err = s.waitForReport(r, report, events, wait)
+			if err != nil {
+				return err
+			}
+		}
+
+		if report.ExpiredAt != nil {
+			if notModified(w, r, reportETag(report), s.reportLastModified(report)) {
+				w.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+			if err := encode(ApiResponse[ApiReport]{
+				Data:    newApiReport(report),
+				Message: fmt.Sprintf("report expired on %s and its file was deleted", report.ExpiredAt.UTC().Format(time.RFC3339)),
+			}, http.StatusGone, w); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			return nil
+		}
+
 		if report.CompletedAt != nil {
-			needsRefresh := report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.Before(time.Now())
+			needsRefresh := report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.Before(time.Now().Add(downloadUrlRefreshMargin))
 			if report.DownloadUrl == nil || needsRefresh {
-				expiresAt := report.CompletedAt.Add(time.Second * 10)
+				expiresAt := time.Now().Add(s.config.PresignedUrlTtl)
 				signedUrl, err := s.presignClient.PresignGetObject(r.Context(), &s3.GetObjectInput{
 					Bucket: aws.String(s.config.S3Bucket),
 					Key:    report.OutputFilePath,
+					ResponseContentDisposition: aws.String(mime.FormatMediaType("attachment", map[string]string{
+						"filename": downloadFilename(report),
+					})),
 				}, func(options *s3.PresignOptions) {
-					options.Expires = time.Second * 10
+					options.Expires = s.config.PresignedUrlTtl
 				})
 				if err != nil {
 					return NewErrWithStatus(http.StatusInternalServerError, err)
 				}
-				report.DownloadUrl = &signedUrl.URL
-				report.DownloadUrlExpiresAt = &expiresAt
-				report, err = s.store.ReportStore.Update(r.Context(), report)
+				report, err = s.store.ReportStore.SetDownloadUrl(r.Context(), user.Id, report.Id, signedUrl.URL, expiresAt)
 				if err != nil {
 					return NewErrWithStatus(http.StatusInternalServerError, err)
 				}
 			}
 		}
 
+		if notModified(w, r, reportETag(report), s.reportLastModified(report)) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+
 		if err := encode(ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				Id:                   report.Id,
-				ReportType:           report.ReportType,
-				OutputFilePath:       report.OutputFilePath,
-				DownloadUrl:          report.DownloadUrl,
-				DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
-				ErrorMessage:         report.ErrorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            report.StartedAt,
-				CompletedAt:          report.CompletedAt,
-				FailedAt:             report.FailedAt,
-				Status:               report.Status(),
+			Data: newApiReport(report),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) deleteReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportIdStr := r.PathValue("id")
+		reportId, err := uuid.Parse(reportIdStr)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if _, err := s.store.ReportStore.Delete(r.Context(), user.Id, reportId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			if errors.Is(err, store.ErrReportProcessing) {
+				return NewErrWithStatus(http.StatusConflict, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+type BulkDeleteReportsRequest struct {
+	Status        string     `json:"status,omitempty"`
+	ReportType    string     `json:"report_type,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+}
+
+func (r BulkDeleteReportsRequest) Validate() error {
+	if r.Status == "" && r.ReportType == "" && r.CreatedBefore == nil && r.CreatedAfter == nil {
+		return errors.New("at least one of status, report_type, created_before or created_after is required")
+	}
+	switch r.Status {
+	case "", "requested", "completed", "failed", "expired":
+	default:
+		return fmt.Errorf("status must be one of requested, completed, failed or expired")
+	}
+	return nil
+}
+
+type BulkDeleteReportsResponse struct {
+	DeletedCount int         `json:"deleted_count"`
+	ReportIds    []uuid.UUID `json:"report_ids"`
+}
+
+func (s *ApiServer) bulkDeleteReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[BulkDeleteReportsRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		deleted, err := s.store.ReportStore.DeleteMatching(r.Context(), user.Id, store.ReportFilter{
+			Status:        req.Status,
+			ReportType:    req.ReportType,
+			CreatedBefore: req.CreatedBefore,
+			CreatedAfter:  req.CreatedAfter,
+		})
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		reportIds := make([]uuid.UUID, 0, len(deleted))
+		for _, report := range deleted {
+			reportIds = append(reportIds, report.Id)
+		}
+
+		if err := encode(ApiResponse[BulkDeleteReportsResponse]{
+			Data: &BulkDeleteReportsResponse{
+				DeletedCount: len(reportIds),
+				ReportIds:    reportIds,
 			},
 		}, http.StatusOK, w); err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
@@ -355,3 +715,111 @@ func (s *ApiServer) getReportHandler() http.HandlerFunc {
 		return nil
 	})
 }
+
+// pinReportHandler pins or unpins a report so it is or isn't exempt from retention.
+func (s *ApiServer) pinReportHandler(pinned bool) http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		report, err := s.store.ReportStore.ByPrimaryKey(r.Context(), user.Id, reportId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if report.ExpiredAt != nil {
+			return NewErrWithStatus(http.StatusGone, fmt.Errorf("report %s already expired", reportId))
+		}
+
+		report, err = s.store.ReportStore.SetPinned(r.Context(), user.Id, reportId, pinned)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// PatchReportRequest changes the fields that are set and leaves the others alone. An empty title or
+// description removes it, and an empty list of tags removes all tags.
+type PatchReportRequest struct {
+	Title       *string   `json:"title,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Tags        *[]string `json:"tags,omitempty"`
+}
+
+func (r PatchReportRequest) Validate() error {
+	if r.Title == nil && r.Description == nil && r.Tags == nil {
+		return errors.New("at least one of title, description or tags is required")
+	}
+	var tags []string
+	if r.Tags != nil {
+		tags = *r.Tags
+	}
+	return validateReportMetadata(r.Title, r.Description, tags)
+}
+
+func (s *ApiServer) patchReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		req, err := decode[PatchReportRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		report, err := s.store.ReportStore.ByPrimaryKey(r.Context(), user.Id, reportId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if req.Title != nil {
+			report.Title = optionalText(req.Title)
+		}
+		if req.Description != nil {
+			report.Description = optionalText(req.Description)
+		}
+		if req.Tags != nil {
+			// validated already
+			report.Tags, _ = reports.NormalizeTags(*req.Tags)
+		}
+		report, err = s.store.ReportStore.SetMetadata(r.Context(), report)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
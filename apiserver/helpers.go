@@ -28,7 +28,8 @@ func handler(f func(w http.ResponseWriter, r *http.Request) error) http.HandlerF
 			if e, ok := err.(*ErrWithStatus); ok {
 				status = e.status
 				msg = http.StatusText(e.status)
-				if status == http.StatusBadRequest || status == http.StatusConflict {
+				switch status {
+				case http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusGone, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests:
 					msg = e.err.Error()
 				}
 			}
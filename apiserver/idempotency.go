@@ -0,0 +1,124 @@
+package apiserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	// a request holding a key longer than this is assumed to have crashed and the key can be reused
+	idempotencyKeyLockTimeout = time.Minute
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// requestFingerprint hashes the method, path and body of a request. JSON bodies are re-encoded first
+// so that formatting and key order don't make identical requests look different.
+func requestFingerprint(r *http.Request, body []byte) string {
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotent makes a handler safe to retry with an Idempotency-Key header. The first request with a key
+// runs the handler and stores its response, later requests with the same key and body get that response
+// replayed, and reusing the key for a different request is rejected.
+func (s *ApiServer) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		handler(func(w http.ResponseWriter, r *http.Request) error {
+			if len(key) > maxIdempotencyKeyLength {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			}
+
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("reading request body: %w", err))
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			fingerprint := requestFingerprint(r, body)
+			record, acquired, err := s.store.IdempotencyKeys.Acquire(r.Context(), user.Id, key, fingerprint,
+				now.Add(s.config.IdempotencyKeyTtl), now.Add(-idempotencyKeyLockTimeout))
+			if err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+
+			if !acquired {
+				if record.RequestFingerprint != fingerprint {
+					return NewErrWithStatus(http.StatusUnprocessableEntity, errors.New("idempotency key was already used for a different request"))
+				}
+				if record.CompletedAt == nil || record.ResponseStatus == nil {
+					return NewErrWithStatus(http.StatusConflict, errors.New("a request with this idempotency key is still being processed"))
+				}
+
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Header().Set(idempotencyReplayedHeader, "true")
+				w.WriteHeader(*record.ResponseStatus)
+				if _, err := w.Write(record.ResponseBody); err != nil {
+					s.logger.Error("failed to write replayed response", "error", err)
+				}
+				return nil
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next(recorder, r)
+
+			// server errors and exceeded quotas aren't remembered so the client can retry them with the same key
+			if recorder.status >= http.StatusInternalServerError || recorder.status == http.StatusTooManyRequests {
+				if err := s.store.IdempotencyKeys.Release(r.Context(), user.Id, key); err != nil {
+					s.logger.Error("failed to release idempotency key", "error", err)
+				}
+				return nil
+			}
+
+			if err := s.store.IdempotencyKeys.Complete(r.Context(), user.Id, key, recorder.status, recorder.body.Bytes()); err != nil {
+				s.logger.Error("failed to store idempotent response", "error", err)
+			}
+			return nil
+		})(w, r)
+	}
+}
@@ -37,7 +37,8 @@ func UserFromContext(ctx context.Context) (*store.User, bool) {
 func NewAuthMiddleware(jwtManager *JwtManager, userStore *store.UserStore) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.HasPrefix(r.URL.Path, "/auth") {
+			// signing in, share links (the token in the path is the credential) and the api description are public
+			if strings.HasPrefix(r.URL.Path, "/auth") || strings.HasPrefix(r.URL.Path, "/shared/") || r.URL.Path == "/openapi.json" {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -0,0 +1,465 @@
+package apiserver
+
+import (
+	"asyncapi/schema"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OpenApiDocument is the subset of OpenAPI 3.1 needed to describe the api.
+type OpenApiDocument struct {
+	OpenApi    string                                  `json:"openapi"`
+	Info       OpenApiInfo                             `json:"info"`
+	Servers    []OpenApiServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*OpenApiOperation `json:"paths"`
+	Components OpenApiComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security"`
+}
+
+type OpenApiInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenApiServer struct {
+	Url string `json:"url"`
+}
+
+type OpenApiOperation struct {
+	OperationId string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Parameters  []OpenApiParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenApiRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenApiResponse `json:"responses"`
+	Security    *[]map[string][]string     `json:"security,omitempty"`
+}
+
+type OpenApiParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required"`
+	Schema      *schema.Schema `json:"schema"`
+}
+
+type OpenApiRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenApiMediaType `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenApiMediaType `json:"content,omitempty"`
+}
+
+type OpenApiMediaType struct {
+	Schema *schema.Schema `json:"schema"`
+}
+
+type OpenApiComponents struct {
+	SecuritySchemes map[string]OpenApiSecurityScheme `json:"securitySchemes"`
+}
+
+type OpenApiSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// operation documents a route. request and response are the types of the json bodies, nil when there is
+// none. Responses that aren't json set contentType instead.
+type operation struct {
+	summary      string
+	request      reflect.Type
+	optionalBody bool
+	status       int
+	response     reflect.Type
+	contentType  string
+	query        []queryParameter
+	public       bool
+}
+
+type queryParameter struct {
+	name        string
+	description string
+	schema      *schema.Schema
+}
+
+func limitParameter(what string, defaultLimit, maxLimit int) queryParameter {
+	return queryParameter{
+		name:        "limit",
+		description: fmt.Sprintf("Maximum number of %s to return, %d by default and at most %d", what, defaultLimit, maxLimit),
+		schema:      &schema.Schema{Type: "integer"},
+	}
+}
+
+var (
+	apiReportType     = reflect.TypeFor[ApiResponse[ApiReport]]()
+	apiReportsType    = reflect.TypeFor[ApiResponse[[]ApiReport]]()
+	apiScheduleType   = reflect.TypeFor[ApiResponse[ApiReportSchedule]]()
+	apiTemplateType   = reflect.TypeFor[ApiResponse[ApiReportTemplate]]()
+	apiDeliveriesType = reflect.TypeFor[ApiResponse[[]ApiWebhookDelivery]]()
+	apiErrorType      = reflect.TypeFor[ApiResponse[struct{}]]()
+
+	apiRetentionOverrideType = reflect.TypeFor[ApiResponse[ApiRetentionOverride]]()
+)
+
+// apiOperations documents every route in Routes, keyed by the route's pattern.
+var apiOperations = map[string]operation{
+	"GET /ping": {
+		summary: "Check that the server is up", status: http.StatusOK, contentType: "text/plain",
+	},
+	"GET /openapi.json": {
+		summary: "Describe the api as an OpenAPI 3.1 document", status: http.StatusOK, contentType: "application/json", public: true,
+	},
+	"POST /auth/signup": {
+		summary: "Sign up a user", request: reflect.TypeFor[SignupRequest](),
+		status: http.StatusCreated, response: apiErrorType, public: true,
+	},
+	"POST /auth/signin": {
+		summary: "Sign in and get a token pair", request: reflect.TypeFor[SigninRequest](),
+		status: http.StatusOK, response: reflect.TypeFor[ApiResponse[SigninResponse]](), public: true,
+	},
+	"POST /auth/refresh": {
+		summary: "Exchange a refresh token for a new token pair", request: reflect.TypeFor[TokenRefreshRequest](),
+		status: http.StatusOK, response: reflect.TypeFor[ApiResponse[TokenRefreshResponse]](), public: true,
+	},
+	"GET /account/usage": {
+		summary: "Get the account's report quotas and usage",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[ApiUsage]](),
+	},
+	"GET /report-types": {
+		summary: "List the report types and their parameters",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiReportType]](),
+	},
+	"POST /reports": {
+		summary: "Create a report", request: reflect.TypeFor[CreateReportRequest](),
+		status: http.StatusCreated, response: apiReportType,
+	},
+	"POST /reports/batch": {
+		summary: "Create a batch of reports", request: reflect.TypeFor[CreateReportBatchRequest](),
+		status: http.StatusCreated, response: reflect.TypeFor[ApiResponse[ApiReportBatchResult]](),
+	},
+	"POST /reports/bulk-delete": {
+		summary: "Delete the reports matching a filter", request: reflect.TypeFor[BulkDeleteReportsRequest](),
+		status: http.StatusOK, response: reflect.TypeFor[ApiResponse[BulkDeleteReportsResponse]](),
+	},
+	"GET /reports/events": {
+		summary: "Stream status changes of all of the user's reports", status: http.StatusOK, contentType: "text/event-stream",
+	},
+	"GET /reports/search": {
+		summary: "Search reports by title, description, tags and filters",
+		status:  http.StatusOK, response: apiReportsType,
+		query: []queryParameter{
+			{name: "q", description: "Full text query on title and description", schema: &schema.Schema{Type: "string"}},
+			{name: "tag", description: "Tag the reports must have, can be repeated", schema: &schema.Schema{Type: "string"}},
+			{name: "status", description: "Report status", schema: &schema.Schema{Type: "string", Enum: reportSearchStatuses}},
+			{name: "report_type", description: "Report type", schema: &schema.Schema{Type: "string"}},
+			{name: "created_after", schema: &schema.Schema{Type: "string", Format: "date-time"}},
+			{name: "created_before", schema: &schema.Schema{Type: "string", Format: "date-time"}},
+			limitParameter("reports", defaultReportSearchLimit, maxReportSearchLimit),
+			{name: "offset", description: "Number of reports to skip", schema: &schema.Schema{Type: "integer"}},
+		},
+	},
+	"GET /reports/{id}": {
+		summary: "Get a report",
+		status:  http.StatusOK, response: apiReportType,
+		query: []queryParameter{
+			{name: "wait", description: "How long to wait for the report to complete, as a duration such as 30s", schema: &schema.Schema{Type: "string"}},
+		},
+	},
+	"GET /reports/{id}/events": {
+		summary: "Stream status changes of a report", status: http.StatusOK, contentType: "text/event-stream",
+	},
+	"GET /reports/{id}/download": {
+		summary: "Download a report's file", status: http.StatusOK, contentType: "application/octet-stream",
+	},
+	"GET /reports/{id}/preview": {
+		summary: "Preview the first rows of a report's file",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[ApiReportPreview]](),
+		query: []queryParameter{limitParameter("rows", defaultReportPreviewLimit, maxReportPreviewLimit)},
+	},
+	"POST /reports/{id}/diff/{otherId}": {
+		summary: "Create a report of the differences between two reports", request: reflect.TypeFor[DiffReportsRequest](), optionalBody: true,
+		status: http.StatusCreated, response: apiReportType,
+	},
+	"PUT /reports/{id}/pin": {
+		summary: "Pin a report so it doesn't expire", status: http.StatusOK, response: apiReportType,
+	},
+	"DELETE /reports/{id}/pin": {
+		summary: "Unpin a report", status: http.StatusOK, response: apiReportType,
+	},
+	"PATCH /reports/{id}": {
+		summary: "Update a report's title, description and tags", request: reflect.TypeFor[PatchReportRequest](),
+		status: http.StatusOK, response: apiReportType,
+	},
+	"DELETE /reports/{id}": {
+		summary: "Delete a report", status: http.StatusNoContent,
+	},
+	"POST /reports/{id}/grants": {
+		summary: "Share a report with another user", request: reflect.TypeFor[CreateReportGrantRequest](),
+		status: http.StatusAccepted, response: apiErrorType,
+	},
+	"GET /reports/{id}/grants": {
+		summary: "List the users a report is shared with",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiReportGrant]](),
+	},
+	"DELETE /reports/{id}/grants/{userId}": {
+		summary: "Stop sharing a report with a user", status: http.StatusNoContent,
+	},
+	"POST /reports/{id}/share-links": {
+		summary: "Create a public link to a report's file", request: reflect.TypeFor[CreateShareLinkRequest](), optionalBody: true,
+		status: http.StatusCreated, response: reflect.TypeFor[ApiResponse[ApiShareLink]](),
+	},
+	"GET /reports/{id}/share-links": {
+		summary: "List a report's share links",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiShareLink]](),
+	},
+	"DELETE /reports/{id}/share-links/{linkId}": {
+		summary: "Revoke a share link",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[ApiShareLink]](),
+	},
+	"GET /reports/{id}/access-log": {
+		summary: "List the views and downloads of a shared report",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiReportAccess]](),
+		query: []queryParameter{limitParameter("accesses", defaultReportAccessLogLimit, maxReportAccessLogLimit)},
+	},
+	"GET /shared-reports": {
+		summary: "List the reports shared with the user", status: http.StatusOK, response: apiReportsType,
+	},
+	"GET /shared-reports/{id}": {
+		summary: "Get a report shared with the user", status: http.StatusOK, response: apiReportType,
+	},
+	"GET /shared-reports/{id}/download": {
+		summary: "Download the file of a report shared with the user", status: http.StatusOK, contentType: "application/octet-stream",
+	},
+	"GET /shared/{token}": {
+		summary: "Download a report's file through a share link", status: http.StatusOK, contentType: "application/octet-stream", public: true,
+	},
+	"GET /report-batches/{id}": {
+		summary: "Get a batch and the status of its reports",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[ApiReportBatch]](),
+	},
+	"POST /report-schedules": {
+		summary: "Create a report schedule", request: reflect.TypeFor[ReportScheduleRequest](),
+		status: http.StatusCreated, response: apiScheduleType,
+	},
+	"GET /report-schedules": {
+		summary: "List report schedules", status: http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiReportSchedule]](),
+	},
+	"GET /report-schedules/{id}": {
+		summary: "Get a report schedule", status: http.StatusOK, response: apiScheduleType,
+	},
+	"PUT /report-schedules/{id}": {
+		summary: "Replace a report schedule", request: reflect.TypeFor[ReportScheduleRequest](),
+		status: http.StatusOK, response: apiScheduleType,
+	},
+	"DELETE /report-schedules/{id}": {
+		summary: "Delete a report schedule", status: http.StatusNoContent,
+	},
+	"GET /report-schedules/{id}/runs": {
+		summary: "List the runs of a report schedule",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiScheduleRun]](),
+		query: []queryParameter{limitParameter("runs", defaultScheduleRunsLimit, maxScheduleRunsLimit)},
+	},
+	"POST /report-templates": {
+		summary: "Create a report template", request: reflect.TypeFor[ReportTemplateRequest](),
+		status: http.StatusCreated, response: apiTemplateType,
+	},
+	"GET /report-templates": {
+		summary: "List report templates", status: http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiReportTemplate]](),
+	},
+	"GET /report-templates/{id}": {
+		summary: "Get a report template", status: http.StatusOK, response: apiTemplateType,
+	},
+	"PUT /report-templates/{id}": {
+		summary: "Replace a report template", request: reflect.TypeFor[ReportTemplateRequest](),
+		status: http.StatusOK, response: apiTemplateType,
+	},
+	"DELETE /report-templates/{id}": {
+		summary: "Delete a report template", status: http.StatusNoContent,
+	},
+	"POST /report-templates/{id}/run": {
+		summary: "Create a report from a template", request: reflect.TypeFor[RunReportTemplateRequest](), optionalBody: true,
+		status: http.StatusCreated, response: apiReportType,
+	},
+	"GET /admin/users/{userId}/retention": {
+		summary: "Get the retention override of a user's reports", status: http.StatusOK, response: apiRetentionOverrideType,
+	},
+	"PUT /admin/users/{userId}/retention": {
+		summary: "Override the retention of a user's reports", request: reflect.TypeFor[SetRetentionOverrideRequest](),
+		status: http.StatusOK, response: apiRetentionOverrideType,
+	},
+	"DELETE /admin/users/{userId}/retention": {
+		summary: "Remove the retention override of a user's reports", status: http.StatusNoContent,
+	},
+	"POST /webhooks": {
+		summary: "Register a webhook endpoint", request: reflect.TypeFor[CreateWebhookRequest](),
+		status: http.StatusCreated, response: reflect.TypeFor[ApiResponse[ApiWebhookEndpoint]](),
+	},
+	"GET /webhooks": {
+		summary: "List webhook endpoints", status: http.StatusOK, response: reflect.TypeFor[ApiResponse[[]ApiWebhookEndpoint]](),
+	},
+	"GET /webhooks/callback-secret": {
+		summary: "Get the secret report callbacks are signed with",
+		status:  http.StatusOK, response: reflect.TypeFor[ApiResponse[ApiCallbackSecret]](),
+	},
+	"DELETE /webhooks/{id}": {
+		summary: "Delete a webhook endpoint", status: http.StatusNoContent,
+	},
+	"GET /webhooks/{id}/deliveries": {
+		summary: "List the deliveries to a webhook endpoint",
+		status:  http.StatusOK, response: apiDeliveriesType,
+		query: []queryParameter{limitParameter("deliveries", defaultWebhookDeliveriesLimit, maxWebhookDeliveriesLimit)},
+	},
+	"POST /webhooks/events/{id}/redeliver": {
+		summary: "Deliver a webhook event again", status: http.StatusAccepted, response: apiDeliveriesType,
+	},
+}
+
+// OpenApi describes the routes as an OpenAPI 3.1 document. Routes missing from apiOperations are left out.
+func (s *ApiServer) OpenApi() *OpenApiDocument {
+	document := &OpenApiDocument{
+		OpenApi: "3.1.0",
+		Info:    OpenApiInfo{Title: "asyncapi", Version: "1.0.0"},
+		Paths:   map[string]map[string]*OpenApiOperation{},
+		Components: OpenApiComponents{SecuritySchemes: map[string]OpenApiSecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+		}},
+		Security: []map[string][]string{{"bearerAuth": {}}},
+	}
+	if s.config.PublicUrl != "" {
+		document.Servers = []OpenApiServer{{Url: strings.TrimSuffix(s.config.PublicUrl, "/")}}
+	}
+
+	for _, route := range s.Routes() {
+		op, ok := apiOperations[route.Pattern]
+		if !ok {
+			continue
+		}
+		method, path, _ := strings.Cut(route.Pattern, " ")
+		if document.Paths[path] == nil {
+			document.Paths[path] = map[string]*OpenApiOperation{}
+		}
+		document.Paths[path][strings.ToLower(method)] = op.document(route.Pattern)
+	}
+	return document
+}
+
+func (op operation) document(pattern string) *OpenApiOperation {
+	method, path, _ := strings.Cut(pattern, " ")
+	doc := &OpenApiOperation{
+		OperationId: operationId(method, path),
+		Summary:     op.summary,
+		Responses: map[string]OpenApiResponse{
+			"default": {
+				Description: "Error, with the reason in message for client errors",
+				Content:     jsonContent(schema.FromType(apiErrorType)),
+			},
+		},
+	}
+	if op.public {
+		doc.Security = &[]map[string][]string{}
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		name, ok := strings.CutPrefix(segment, "{")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSuffix(name, "}")
+		parameter := OpenApiParameter{Name: name, In: "path", Required: true, Schema: &schema.Schema{Type: "string"}}
+		if name == "id" || strings.HasSuffix(name, "Id") {
+			parameter.Schema.Format = "uuid"
+		}
+		doc.Parameters = append(doc.Parameters, parameter)
+	}
+	for _, q := range op.query {
+		doc.Parameters = append(doc.Parameters, OpenApiParameter{Name: q.name, In: "query", Description: q.description, Schema: q.schema})
+	}
+
+	if op.request != nil {
+		doc.RequestBody = &OpenApiRequestBody{Required: !op.optionalBody, Content: jsonContent(schema.FromType(op.request))}
+	}
+
+	response := OpenApiResponse{Description: http.StatusText(op.status)}
+	switch {
+	case op.response != nil:
+		response.Content = jsonContent(schema.FromType(op.response))
+	case op.contentType != "":
+		response.Content = map[string]OpenApiMediaType{op.contentType: {Schema: &schema.Schema{}}}
+	}
+	doc.Responses[strconv.Itoa(op.status)] = response
+	return doc
+}
+
+func jsonContent(s *schema.Schema) map[string]OpenApiMediaType {
+	return map[string]OpenApiMediaType{"application/json": {Schema: s}}
+}
+
+// operationId turns "DELETE /reports/{id}/share-links/{linkId}" into "deleteReportsByIdShareLinksByLinkId".
+func operationId(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			b.WriteString("By")
+			segment = strings.TrimSuffix(name, "}")
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+func (s *ApiServer) openApiHandler() http.HandlerFunc {
+	// built on first use, as building it lists the routes, this handler included
+	document := sync.OnceValue(s.OpenApi)
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		if err := encode(document(), http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// validateRequest checks request bodies against the documented request schema before the handler decodes
+// them, when VALIDATE_REQUESTS is set. Bodies over MAX_REQUEST_BODY_BYTES are rejected without reading them whole.
+func (s *ApiServer) validateRequest(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	op, ok := apiOperations[pattern]
+	if !s.config.ValidateRequests || !ok || op.request == nil {
+		return next
+	}
+
+	requestSchema := schema.FromType(op.request)
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		if s.config.MaxRequestBodyBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBodyBytes)
+		}
+		body, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return NewErrWithStatus(http.StatusRequestEntityTooLarge, fmt.Errorf("request body is larger than %d bytes", tooLarge.Limit))
+		}
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("reading request body: %w", err))
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(body) > 0 || !op.optionalBody {
+			if err := requestSchema.Validate(body); err != nil {
+				return NewErrWithStatus(http.StatusBadRequest, err)
+			}
+		}
+		next(w, r)
+		return nil
+	})
+}
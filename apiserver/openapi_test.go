@@ -0,0 +1,95 @@
+package apiserver_test
+
+import (
+	"asyncapi/apiserver"
+	"asyncapi/config"
+	"asyncapi/reports"
+	"asyncapi/store"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenApiDocumentsEveryRoute(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	server := apiserver.New(&config.Config{}, logger, &store.Store{}, nil, nil, nil, nil, reports.DefaultRegistry())
+
+	routes := server.Routes()
+	doc := server.OpenApi()
+	require.Equal(t, "3.1.0", doc.OpenApi)
+
+	for _, route := range routes {
+		method, path, ok := strings.Cut(route.Pattern, " ")
+		require.True(t, ok, "route %q has no method", route.Pattern)
+		operation := doc.Paths[path][strings.ToLower(method)]
+		require.NotNil(t, operation, "route %q is not documented", route.Pattern)
+		require.NotEmpty(t, operation.Summary, "route %q has no summary", route.Pattern)
+	}
+
+	operations := 0
+	for _, methods := range doc.Paths {
+		operations += len(methods)
+	}
+	require.Equal(t, len(routes), operations)
+
+	createReport := doc.Paths["/reports"]["post"]
+	require.NotNil(t, createReport.RequestBody)
+	require.Contains(t, createReport.RequestBody.Content["application/json"].Schema.Required, "report_type")
+	require.Contains(t, createReport.Responses, "201")
+
+	getReport := doc.Paths["/reports/{id}"]["get"]
+	require.Equal(t, "id", getReport.Parameters[0].Name)
+	require.Equal(t, "uuid", getReport.Parameters[0].Schema.Format)
+	require.Nil(t, getReport.Security)
+
+	signin := doc.Paths["/auth/signin"]["post"]
+	require.NotNil(t, signin.Security)
+	require.Empty(t, *signin.Security)
+
+	var handler http.HandlerFunc
+	for _, route := range routes {
+		if route.Pattern == "GET /openapi.json" {
+			handler = route.Handler
+		}
+	}
+	require.NotNil(t, handler)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var served map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	require.Equal(t, "3.1.0", served["openapi"])
+	require.Contains(t, served["paths"], "/reports/{id}/download")
+}
+
+func TestValidateRequestBodyLimit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	conf := &config.Config{ValidateRequests: true, MaxRequestBodyBytes: 64}
+	server := apiserver.New(conf, logger, &store.Store{}, nil, nil, nil, nil, reports.DefaultRegistry())
+	handler := server.Handler()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "over the limit", body: `{"email":"` + strings.Repeat("a", 64) + `@test.com","password":"secretpswd"}`, status: http.StatusRequestEntityTooLarge},
+		// rejected by the schema, so it never reaches the handler and its store
+		{name: "under the limit", body: `{"email":1}`, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/signup", strings.NewReader(test.body)))
+			require.Equal(t, test.status, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReportPreviewLimit = 50
+	maxReportPreviewLimit     = 1000
+)
+
+type ApiReportPreview struct {
+	ReportId uuid.UUID `json:"report_id"`
+	Columns  []string  `json:"columns"`
+	Rows     [][]any   `json:"rows"`
+	HasMore  bool      `json:"has_more"`
+}
+
+// previewTooLarge rejects previews of spooled formats that would copy more than maxSpool bytes to disk.
+func previewTooLarge(format *reports.Format, maxSpool int64) error {
+	return NewErrWithStatus(http.StatusUnprocessableEntity, fmt.Errorf("%s reports over %d bytes can't be previewed, download the report instead", format.Name, maxSpool))
+}
+
+// previewReportHandler returns the header and first rows of a completed report. The stored file is
+// decompressed and parsed as it streams in, the read stops once enough rows were parsed.
+func (s *ApiServer) previewReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		limit := defaultReportPreviewLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > maxReportPreviewLimit {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxReportPreviewLimit))
+			}
+		}
+
+		report, err := s.storedReport(r)
+		if err != nil {
+			return err
+		}
+
+		format, err := reports.FormatByName(report.OutputFormat)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		codec, err := reports.CodecByName(report.Compression)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		maxSpool := s.config.MaxPreviewSpoolBytes
+		if format.Spooled && maxSpool > 0 && report.UncompressedSizeBytes != nil && *report.UncompressedSizeBytes > maxSpool {
+			return previewTooLarge(format, maxSpool)
+		}
+
+		output, err := s.s3Client.GetObject(r.Context(), &s3.GetObjectInput{
+			Bucket: aws.String(s.config.S3Bucket),
+			Key:    report.OutputFilePath,
+		})
+		if err != nil {
+			return s.downloadError(w, report, err)
+		}
+		defer output.Body.Close()
+
+		reader, err := codec.NewReader(output.Body)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		defer reader.Close()
+
+		preview, err := format.ReadPreview(reader, limit, maxSpool)
+		if errors.Is(err, reports.ErrPreviewTooLarge) {
+			return previewTooLarge(format, maxSpool)
+		}
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, fmt.Errorf("failed to preview report %s: %w", report.Id, err))
+		}
+
+		if err := encode(ApiResponse[ApiReportPreview]{
+			Data: &ApiReportPreview{
+				ReportId: report.Id,
+				Columns:  preview.Columns,
+				Rows:     preview.Rows,
+				HasMore:  preview.HasMore,
+			},
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,186 @@
+package apiserver
+
+import (
+	"asyncapi/store"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	retryAfterHeader         = "Retry-After"
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+	// there's no telling when a report being built will be done
+	inFlightRetryAfter = 30 * time.Second
+)
+
+// quota is a limit on a user's reports. A limit of 0 is unlimited.
+type quota struct {
+	name  string
+	used  int64
+	limit int64
+	// resetsAt is when usage next goes down on its own, nil if it only goes down when reports finish or
+	// are deleted
+	resetsAt *time.Time
+	// perReport is set for quotas where every new report adds one to used
+	perReport bool
+}
+
+// exceededBy reports whether creating n more reports would go over the quota.
+func (q *quota) exceededBy(n int64) bool {
+	if q.limit == 0 {
+		return false
+	}
+	if !q.perReport {
+		return q.used >= q.limit
+	}
+	return q.used+n > q.limit
+}
+
+func (q *quota) remaining() int64 {
+	return max(q.limit-q.used, 0)
+}
+
+// windowResetsAt is when the oldest report created in a window leaves it.
+func windowResetsAt(oldest *time.Time, window time.Duration) *time.Time {
+	if oldest == nil {
+		return nil
+	}
+	resetsAt := oldest.Add(window)
+	return &resetsAt
+}
+
+// quotas are the user's quotas, in the order they are checked.
+func (s *ApiServer) quotas(usage *store.Usage, now time.Time) (inFlight, hourly, daily, storage *quota) {
+	inFlightResetsAt := now.Add(inFlightRetryAfter)
+	inFlight = &quota{name: "in_flight_reports", used: usage.InFlight, limit: s.config.MaxInFlightReports, resetsAt: &inFlightResetsAt, perReport: true}
+	hourly = &quota{name: "reports_last_hour", used: usage.CreatedLastHour, limit: s.config.MaxReportsPerHour, resetsAt: windowResetsAt(usage.OldestLastHour, time.Hour), perReport: true}
+	daily = &quota{name: "reports_last_day", used: usage.CreatedLastDay, limit: s.config.MaxReportsPerDay, resetsAt: windowResetsAt(usage.OldestLastDay, 24*time.Hour), perReport: true}
+	storage = &quota{name: "stored_bytes", used: usage.StoredBytes, limit: s.config.MaxStoredBytes}
+	return inFlight, hourly, daily, storage
+}
+
+// secondsUntil rounds up so clients don't retry a moment too early.
+func secondsUntil(t time.Time, now time.Time) string {
+	return strconv.FormatInt(max(int64(math.Ceil(t.Sub(now).Seconds())), 0), 10)
+}
+
+// setRateLimitHeaders describes the creation limit closest to being reached, after n more reports.
+func setRateLimitHeaders(w http.ResponseWriter, now time.Time, n int64, windows ...*quota) {
+	var closest *quota
+	for _, window := range windows {
+		if window.limit == 0 {
+			continue
+		}
+		if closest == nil || window.remaining() < closest.remaining() {
+			closest = window
+		}
+	}
+	if closest == nil {
+		return
+	}
+
+	w.Header().Set(rateLimitLimitHeader, strconv.FormatInt(closest.limit, 10))
+	w.Header().Set(rateLimitRemainingHeader, strconv.FormatInt(max(closest.remaining()-n, 0), 10))
+	if closest.resetsAt != nil {
+		w.Header().Set(rateLimitResetHeader, secondsUntil(*closest.resetsAt, now))
+	}
+}
+
+// quotaCheck returns a 429 error if creating n reports would exceed one of the user's quotas. It sets the
+// RateLimit headers either way, and Retry-After when the quota frees up on its own. The store runs it
+// while holding the user's creation lock, so concurrent requests can't all pass against the same usage.
+func (s *ApiServer) quotaCheck(w http.ResponseWriter, n int) store.QuotaCheck {
+	return func(usage *store.Usage) error {
+		now := time.Now()
+		inFlight, hourly, daily, storage := s.quotas(usage, now)
+		for _, q := range []*quota{inFlight, hourly, daily, storage} {
+			if !q.exceededBy(int64(n)) {
+				continue
+			}
+
+			setRateLimitHeaders(w, now, 0, hourly, daily)
+			if q.resetsAt != nil {
+				w.Header().Set(retryAfterHeader, secondsUntil(*q.resetsAt, now))
+			}
+			if q.perReport && int64(n) > q.limit {
+				return NewErrWithStatus(http.StatusTooManyRequests, fmt.Errorf("quota %s exceeded: %d reports requested, the limit is %d", q.name, n, q.limit))
+			}
+			return NewErrWithStatus(http.StatusTooManyRequests, fmt.Errorf("quota %s exceeded: %d of %d used", q.name, q.used, q.limit))
+		}
+
+		setRateLimitHeaders(w, now, int64(n), hourly, daily)
+		return nil
+	}
+}
+
+// creationError passes on the error of a rejected quota check and turns any other creation error into a 500.
+func creationError(err error) error {
+	var quotaErr *ErrWithStatus
+	if errors.As(err, &quotaErr) {
+		return quotaErr
+	}
+	return NewErrWithStatus(http.StatusInternalServerError, err)
+}
+
+type ApiQuota struct {
+	Used      int64      `json:"used"`
+	Limit     *int64     `json:"limit,omitempty"`
+	Remaining *int64     `json:"remaining,omitempty"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+type ApiUsage struct {
+	InFlightReports ApiQuota `json:"in_flight_reports"`
+	ReportsLastHour ApiQuota `json:"reports_last_hour"`
+	ReportsLastDay  ApiQuota `json:"reports_last_day"`
+	StoredBytes     ApiQuota `json:"stored_bytes"`
+}
+
+func newApiQuota(q *quota, withResetsAt bool) ApiQuota {
+	apiQuota := ApiQuota{Used: q.used}
+	if q.limit > 0 {
+		remaining := q.remaining()
+		apiQuota.Limit = &q.limit
+		apiQuota.Remaining = &remaining
+	}
+	if withResetsAt {
+		apiQuota.ResetsAt = q.resetsAt
+	}
+	return apiQuota
+}
+
+func (s *ApiServer) accountUsageHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		now := time.Now()
+		usage, err := s.store.ReportStore.Usage(r.Context(), user.Id, now)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		inFlight, hourly, daily, storage := s.quotas(usage, now)
+		if err := encode(ApiResponse[ApiUsage]{
+			Data: &ApiUsage{
+				// the in flight retry is a guess, not a reset time
+				InFlightReports: newApiQuota(inFlight, false),
+				ReportsLastHour: newApiQuota(hourly, true),
+				ReportsLastDay:  newApiQuota(daily, true),
+				StoredBytes:     newApiQuota(storage, false),
+			},
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
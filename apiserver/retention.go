@@ -0,0 +1,142 @@
+package apiserver
+
+import (
+	"asyncapi/store"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SetRetentionOverrideRequest struct {
+	// Retention is a duration such as 168h, 0s keeps the user's reports forever
+	Retention string `json:"retention"`
+}
+
+func (r SetRetentionOverrideRequest) Validate() error {
+	if retention, err := time.ParseDuration(r.Retention); err != nil || retention < 0 {
+		return errors.New("retention must be a duration such as 168h, or 0s to keep reports forever")
+	}
+	return nil
+}
+
+type ApiRetentionOverride struct {
+	UserId           uuid.UUID `json:"user_id"`
+	Retention        string    `json:"retention"`
+	RetentionSeconds int64     `json:"retention_seconds"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func newApiRetentionOverride(override *store.RetentionOverride) *ApiRetentionOverride {
+	return &ApiRetentionOverride{
+		UserId:           override.UserId,
+		Retention:        override.Retention().String(),
+		RetentionSeconds: override.RetentionSeconds,
+		CreatedAt:        override.CreatedAt,
+		UpdatedAt:        override.UpdatedAt,
+	}
+}
+
+// adminUserId checks the user is an admin, one of ADMIN_ROLES, and returns the id of the user the request
+// path names.
+func (s *ApiServer) adminUserId(r *http.Request) (uuid.UUID, error) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return uuid.Nil, NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+	}
+	if !slices.Contains(s.config.AdminRoles, user.Role) {
+		return uuid.Nil, NewErrWithStatus(http.StatusForbidden, errors.New("only admins can manage other users"))
+	}
+
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		return uuid.Nil, NewErrWithStatus(http.StatusBadRequest, err)
+	}
+	return userId, nil
+}
+
+func (s *ApiServer) getRetentionOverrideHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := s.adminUserId(r)
+		if err != nil {
+			return err
+		}
+
+		override, err := s.store.Retention.ByUser(r.Context(), userId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiRetentionOverride]{
+			Data: newApiRetentionOverride(override),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// setRetentionOverrideHandler replaces the retention of the user's reports, both REPORT_RETENTION and
+// REPORT_TYPE_RETENTION, until the override is deleted.
+func (s *ApiServer) setRetentionOverrideHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[SetRetentionOverrideRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		userId, err := s.adminUserId(r)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.store.Users.ById(r.Context(), userId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		retention, _ := time.ParseDuration(req.Retention)
+		override, err := s.store.Retention.Set(r.Context(), userId, retention)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiRetentionOverride]{
+			Data: newApiRetentionOverride(override),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) deleteRetentionOverrideHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := s.adminUserId(r)
+		if err != nil {
+			return err
+		}
+
+		if err := s.store.Retention.Delete(r.Context(), userId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
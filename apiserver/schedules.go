@@ -0,0 +1,354 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	defaultScheduleRunsLimit = 50
+	maxScheduleRunsLimit     = 500
+)
+
+type ReportScheduleRequest struct {
+	CreateReportRequest
+	CronExpression string `json:"cron_expression"`
+	Timezone       string `json:"timezone,omitempty"`
+	Enabled        *bool  `json:"enabled,omitempty"`
+	CatchUpPolicy  string `json:"catch_up_policy,omitempty"`
+}
+
+func (r ReportScheduleRequest) Validate() error {
+	if err := r.CreateReportRequest.Validate(); err != nil {
+		return err
+	}
+	if r.Priority != "" && r.Priority != reports.DefaultPriority {
+		return fmt.Errorf("scheduled reports have %s priority", reports.DefaultPriority)
+	}
+	if r.hasReportOnlyFields() {
+		return errors.New("title, description, tags and cache are set on reports, not schedules")
+	}
+	if r.CronExpression == "" {
+		return errors.New("cron_expression is required")
+	}
+	if _, err := reports.NextScheduleRun(r.CronExpression, r.timezone(), time.Now()); err != nil {
+		return err
+	}
+	if r.CatchUpPolicy != "" && !slices.Contains(reports.CatchUpPolicies, r.CatchUpPolicy) {
+		return fmt.Errorf("catch_up_policy must be one of %s", strings.Join(reports.CatchUpPolicies, ", "))
+	}
+	return nil
+}
+
+func (r ReportScheduleRequest) timezone() string {
+	if r.Timezone == "" {
+		return "UTC"
+	}
+	return r.Timezone
+}
+
+// schedule builds the schedule the request describes, due next after now.
+func (r ReportScheduleRequest) schedule(userId uuid.UUID, now time.Time) (*store.ReportSchedule, error) {
+	nextRunAt, err := reports.NextScheduleRun(r.CronExpression, r.timezone(), now)
+	if err != nil {
+		return nil, err
+	}
+
+	catchUpPolicy := r.CatchUpPolicy
+	if catchUpPolicy == "" {
+		catchUpPolicy = reports.CatchUpSkip
+	}
+
+	return &store.ReportSchedule{
+		UserId:           userId,
+		CronExpression:   r.CronExpression,
+		Timezone:         r.timezone(),
+		ReportType:       r.ReportType,
+		Parameters:       types.JSONText(r.Parameters),
+		OutputFormat:     r.OutputFormat,
+		Compression:      r.Compression,
+		CompressionLevel: r.CompressionLevel,
+		CallbackUrl:      r.CallbackUrl,
+		Enabled:          r.Enabled == nil || *r.Enabled,
+		CatchUpPolicy:    catchUpPolicy,
+		NextRunAt:        nextRunAt,
+	}, nil
+}
+
+type ApiReportSchedule struct {
+	Id               uuid.UUID       `json:"id"`
+	CronExpression   string          `json:"cron_expression"`
+	Timezone         string          `json:"timezone"`
+	ReportType       string          `json:"report_type"`
+	Parameters       json.RawMessage `json:"parameters,omitempty"`
+	OutputFormat     string          `json:"output_format"`
+	Compression      string          `json:"compression"`
+	CompressionLevel *int            `json:"compression_level,omitempty"`
+	CallbackUrl      *string         `json:"callback_url,omitempty"`
+	Enabled          bool            `json:"enabled"`
+	CatchUpPolicy    string          `json:"catch_up_policy"`
+	NextRunAt        *time.Time      `json:"next_run_at,omitempty"`
+	LastRunAt        *time.Time      `json:"last_run_at,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+func newApiReportSchedule(schedule *store.ReportSchedule) *ApiReportSchedule {
+	apiSchedule := &ApiReportSchedule{
+		Id:               schedule.Id,
+		CronExpression:   schedule.CronExpression,
+		Timezone:         schedule.Timezone,
+		ReportType:       schedule.ReportType,
+		Parameters:       json.RawMessage(schedule.Parameters),
+		OutputFormat:     schedule.OutputFormat,
+		Compression:      schedule.Compression,
+		CompressionLevel: schedule.CompressionLevel,
+		CallbackUrl:      schedule.CallbackUrl,
+		Enabled:          schedule.Enabled,
+		CatchUpPolicy:    schedule.CatchUpPolicy,
+		LastRunAt:        schedule.LastRunAt,
+		CreatedAt:        schedule.CreatedAt,
+		UpdatedAt:        schedule.UpdatedAt,
+	}
+	if schedule.Enabled {
+		apiSchedule.NextRunAt = &schedule.NextRunAt
+	}
+	return apiSchedule
+}
+
+type ApiScheduleRun struct {
+	ScheduledFor  time.Time  `json:"scheduled_for"`
+	ReportId      *uuid.UUID `json:"report_id,omitempty"`
+	SkippedReason *string    `json:"skipped_reason,omitempty"`
+	EnqueuedAt    *time.Time `json:"enqueued_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func (s *ApiServer) createReportScheduleHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[ReportScheduleRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.validateReportRequest(user, req.CreateReportRequest); err != nil {
+			return err
+		}
+
+		schedule, err := req.schedule(user.Id, time.Now())
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		schedule, err = s.store.ReportSchedules.Create(r.Context(), schedule)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiReportSchedule]{
+			Data: newApiReportSchedule(schedule),
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) listReportSchedulesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		schedules, err := s.store.ReportSchedules.ByUser(r.Context(), user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiSchedules := make([]ApiReportSchedule, 0, len(schedules))
+		for _, schedule := range schedules {
+			apiSchedules = append(apiSchedules, *newApiReportSchedule(&schedule))
+		}
+
+		if err := encode(ApiResponse[[]ApiReportSchedule]{
+			Data: &apiSchedules,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) getReportScheduleHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		scheduleId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		schedule, err := s.store.ReportSchedules.ByPrimaryKey(r.Context(), user.Id, scheduleId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiReportSchedule]{
+			Data: newApiReportSchedule(schedule),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// updateReportScheduleHandler replaces a schedule. Its next run is computed again from now, so runs
+// missed while the schedule was disabled aren't caught up on.
+func (s *ApiServer) updateReportScheduleHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		scheduleId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		req, err := decode[ReportScheduleRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.validateReportRequest(user, req.CreateReportRequest); err != nil {
+			return err
+		}
+
+		schedule, err := req.schedule(user.Id, time.Now())
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		schedule.Id = scheduleId
+
+		schedule, err = s.store.ReportSchedules.Update(r.Context(), schedule)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiReportSchedule]{
+			Data: newApiReportSchedule(schedule),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) deleteReportScheduleHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		scheduleId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.store.ReportSchedules.Delete(r.Context(), user.Id, scheduleId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func (s *ApiServer) listScheduleRunsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		scheduleId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		limit := defaultScheduleRunsLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > maxScheduleRunsLimit {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxScheduleRunsLimit))
+			}
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if _, err := s.store.ReportSchedules.ByPrimaryKey(r.Context(), user.Id, scheduleId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		runs, err := s.store.ReportSchedules.RunsBySchedule(r.Context(), user.Id, scheduleId, limit)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiRuns := make([]ApiScheduleRun, 0, len(runs))
+		for _, run := range runs {
+			apiRuns = append(apiRuns, ApiScheduleRun{
+				ScheduledFor:  run.ScheduledFor,
+				ReportId:      run.ReportId,
+				SkippedReason: run.SkippedReason,
+				EnqueuedAt:    run.EnqueuedAt,
+				CreatedAt:     run.CreatedAt,
+			})
+		}
+
+		if err := encode(ApiResponse[[]ApiScheduleRun]{
+			Data: &apiRuns,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
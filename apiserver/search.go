@@ -0,0 +1,109 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultReportSearchLimit = 50
+	maxReportSearchLimit     = 200
+)
+
+var reportSearchStatuses = []string{"requested", "processing", "completed", "failed", "expired"}
+
+// parseTimeParam parses an optional RFC 3339 time query parameter.
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time such as 2024-01-02T15:04:05Z", name)
+	}
+	return &t, nil
+}
+
+// parseReportSearch reads a search from the query string: q, any number of tag, status, report_type,
+// created_after, created_before, limit and offset.
+func parseReportSearch(query url.Values) (store.ReportSearch, error) {
+	search := store.ReportSearch{
+		ReportFilter: store.ReportFilter{
+			Status:     query.Get("status"),
+			ReportType: query.Get("report_type"),
+		},
+		Query: query.Get("q"),
+		Limit: defaultReportSearchLimit,
+	}
+	if search.Status != "" && !slices.Contains(reportSearchStatuses, search.Status) {
+		return search, fmt.Errorf("status must be one of %v", reportSearchStatuses)
+	}
+
+	tags, err := reports.NormalizeTags(query["tag"])
+	if err != nil {
+		return search, err
+	}
+	search.Tags = tags
+
+	if search.CreatedAfter, err = parseTimeParam(query, "created_after"); err != nil {
+		return search, err
+	}
+	if search.CreatedBefore, err = parseTimeParam(query, "created_before"); err != nil {
+		return search, err
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		search.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || search.Limit < 1 || search.Limit > maxReportSearchLimit {
+			return search, fmt.Errorf("limit must be between 1 and %d", maxReportSearchLimit)
+		}
+	}
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		search.Offset, err = strconv.Atoi(offsetStr)
+		if err != nil || search.Offset < 0 {
+			return search, fmt.Errorf("offset must be a non-negative number")
+		}
+	}
+	return search, nil
+}
+
+// searchReportsHandler finds the user's reports by full text search of their title and description,
+// tags, status, type and creation date. All given filters have to match.
+func (s *ApiServer) searchReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		search, err := parseReportSearch(r.URL.Query())
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		found, err := s.store.ReportStore.Search(r.Context(), user.Id, search)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiReports := make([]ApiReport, 0, len(found))
+		for _, report := range found {
+			apiReports = append(apiReports, *newApiReport(&report))
+		}
+
+		if err := encode(ApiResponse[[]ApiReport]{
+			Data: &apiReports,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -2,6 +2,7 @@ package apiserver
 
 import (
 	"asyncapi/config"
+	"asyncapi/reports"
 	"asyncapi/store"
 	"context"
 	"log/slog"
@@ -19,12 +20,22 @@ type ApiServer struct {
 	logger        *slog.Logger
 	store         *store.Store
 	jwtManager    *JwtManager
-	sqsClient     *sqs.Client
+	queue         *reports.Queue
+	s3Client      *s3.Client
 	presignClient *s3.PresignClient
+	reportTypes   *reports.Registry
+	events        *ReportEventHub
+	waiters       chan struct{}
 }
 
-func New(config *config.Config, logger *slog.Logger, store *store.Store, jwtManager *JwtManager, sqsClient *sqs.Client, presignClient *s3.PresignClient) *ApiServer {
-	return &ApiServer{config: config, logger: logger, store: store, jwtManager: jwtManager, sqsClient: sqsClient, presignClient: presignClient}
+func New(config *config.Config, logger *slog.Logger, store *store.Store, jwtManager *JwtManager, sqsClient *sqs.Client, s3Client *s3.Client, presignClient *s3.PresignClient, reportTypes *reports.Registry) *ApiServer {
+	return &ApiServer{config: config, logger: logger, store: store, jwtManager: jwtManager, queue: reports.NewQueue(config, sqsClient), s3Client: s3Client, presignClient: presignClient, reportTypes: reportTypes, events: NewReportEventHub(logger),
+		waiters: make(chan struct{}, max(config.MaxReportWaiters, 0))}
+}
+
+// Events is the hub that fans report events out to the streams and waiters of this instance.
+func (s *ApiServer) Events() *ReportEventHub {
+	return s.events
 }
 
 func (s *ApiServer) ping(w http.ResponseWriter, r *http.Request) {
@@ -32,21 +43,92 @@ func (s *ApiServer) ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("pong"))
 }
 
-func (s *ApiServer) Start(ctx context.Context) error {
+// Handler serves every route, with request validation but without the auth and logging middleware.
+func (s *ApiServer) Handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /ping", s.ping)
-	mux.HandleFunc("POST /auth/signup", s.signupHandler())
-	mux.HandleFunc("POST /auth/signin", s.signinHandler())
-	mux.HandleFunc("POST /auth/refresh", s.tokenRefreshHandler())
-	mux.HandleFunc("POST /reports", s.createReportHandler())
-	mux.HandleFunc("GET /reports/{id}", s.getReportHandler())
+	for _, route := range s.Routes() {
+		mux.HandleFunc(route.Pattern, s.validateRequest(route.Pattern, route.Handler))
+	}
+	return mux
+}
+
+// Route is a pattern served by the api and its handler.
+type Route struct {
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// Routes lists every route the api serves. Each one needs an entry in apiOperations to be documented.
+func (s *ApiServer) Routes() []Route {
+	return []Route{
+		{"GET /ping", s.ping},
+		{"GET /openapi.json", s.openApiHandler()},
+		{"POST /auth/signup", s.signupHandler()},
+		{"POST /auth/signin", s.signinHandler()},
+		{"POST /auth/refresh", s.tokenRefreshHandler()},
+		{"GET /account/usage", s.accountUsageHandler()},
+		{"GET /report-types", s.listReportTypesHandler()},
+		{"POST /reports", s.idempotent(s.createReportHandler())},
+		{"POST /reports/batch", s.idempotent(s.createReportBatchHandler())},
+		{"POST /reports/bulk-delete", s.bulkDeleteReportsHandler()},
+		{"GET /reports/events", s.allReportEventsHandler()},
+		{"GET /reports/search", s.searchReportsHandler()},
+		{"GET /reports/{id}", s.getReportHandler()},
+		{"GET /reports/{id}/events", s.reportEventsHandler()},
+		{"GET /reports/{id}/download", s.downloadReportHandler()},
+		{"GET /reports/{id}/preview", s.previewReportHandler()},
+		{"POST /reports/{id}/diff/{otherId}", s.diffReportsHandler()},
+		{"PUT /reports/{id}/pin", s.pinReportHandler(true)},
+		{"DELETE /reports/{id}/pin", s.pinReportHandler(false)},
+		{"PATCH /reports/{id}", s.patchReportHandler()},
+		{"DELETE /reports/{id}", s.deleteReportHandler()},
+		{"POST /reports/{id}/grants", s.createReportGrantHandler()},
+		{"GET /reports/{id}/grants", s.listReportGrantsHandler()},
+		{"DELETE /reports/{id}/grants/{userId}", s.deleteReportGrantHandler()},
+		{"POST /reports/{id}/share-links", s.createShareLinkHandler()},
+		{"GET /reports/{id}/share-links", s.listShareLinksHandler()},
+		{"DELETE /reports/{id}/share-links/{linkId}", s.revokeShareLinkHandler()},
+		{"GET /reports/{id}/access-log", s.reportAccessLogHandler()},
+		{"GET /shared-reports", s.listSharedReportsHandler()},
+		{"GET /shared-reports/{id}", s.getSharedReportHandler()},
+		{"GET /shared-reports/{id}/download", s.downloadSharedReportHandler()},
+		{"GET /shared/{token}", s.shareLinkDownloadHandler()},
+		{"GET /report-batches/{id}", s.getReportBatchHandler()},
+		{"POST /report-schedules", s.createReportScheduleHandler()},
+		{"GET /report-schedules", s.listReportSchedulesHandler()},
+		{"GET /report-schedules/{id}", s.getReportScheduleHandler()},
+		{"PUT /report-schedules/{id}", s.updateReportScheduleHandler()},
+		{"DELETE /report-schedules/{id}", s.deleteReportScheduleHandler()},
+		{"GET /report-schedules/{id}/runs", s.listScheduleRunsHandler()},
+		{"POST /report-templates", s.createReportTemplateHandler()},
+		{"GET /report-templates", s.listReportTemplatesHandler()},
+		{"GET /report-templates/{id}", s.getReportTemplateHandler()},
+		{"PUT /report-templates/{id}", s.updateReportTemplateHandler()},
+		{"DELETE /report-templates/{id}", s.deleteReportTemplateHandler()},
+		{"POST /report-templates/{id}/run", s.idempotent(s.runReportTemplateHandler())},
+		{"GET /admin/users/{userId}/retention", s.getRetentionOverrideHandler()},
+		{"PUT /admin/users/{userId}/retention", s.setRetentionOverrideHandler()},
+		{"DELETE /admin/users/{userId}/retention", s.deleteRetentionOverrideHandler()},
+		{"POST /webhooks", s.createWebhookHandler()},
+		{"GET /webhooks", s.listWebhooksHandler()},
+		{"GET /webhooks/callback-secret", s.callbackSecretHandler()},
+		{"DELETE /webhooks/{id}", s.deleteWebhookHandler()},
+		{"GET /webhooks/{id}/deliveries", s.listWebhookDeliveriesHandler()},
+		{"POST /webhooks/events/{id}/redeliver", s.redeliverWebhookEventHandler()},
+	}
+}
+
+func (s *ApiServer) Start(ctx context.Context) error {
+	if err := s.listenForReportEvents(ctx); err != nil {
+		return err
+	}
 
 	middleware := NewLoggerMiddleware(s.logger)
 	middleware = NewAuthMiddleware(s.jwtManager, s.store.Users)
 
 	server := &http.Server{
 		Addr:    net.JoinHostPort(s.config.ApiServerHost, s.config.ApiServerPort),
-		Handler: middleware(mux),
+		Handler: middleware(s.Handler()),
 	}
 
 	go func() {
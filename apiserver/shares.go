@@ -0,0 +1,563 @@
+package apiserver
+
+import (
+	"asyncapi/store"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReportAccessLogLimit = 100
+	maxReportAccessLogLimit     = 1000
+)
+
+type CreateReportGrantRequest struct {
+	Email string `json:"email"`
+}
+
+func (r CreateReportGrantRequest) Validate() error {
+	if strings.TrimSpace(r.Email) == "" {
+		return errors.New("email is required")
+	}
+	return nil
+}
+
+type ApiReportGrant struct {
+	UserId    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newApiReportGrant(grant *store.ReportGrant) *ApiReportGrant {
+	return &ApiReportGrant{
+		UserId:    grant.GranteeId,
+		Email:     grant.GranteeEmail,
+		CreatedAt: grant.CreatedAt,
+	}
+}
+
+type CreateShareLinkRequest struct {
+	// ExpiresIn is a duration such as 48h, SHARE_LINK_TTL when empty
+	ExpiresIn    string `json:"expires_in,omitempty"`
+	MaxDownloads *int   `json:"max_downloads,omitempty"`
+}
+
+func (r CreateShareLinkRequest) Validate() error {
+	if r.ExpiresIn != "" {
+		if expiresIn, err := time.ParseDuration(r.ExpiresIn); err != nil || expiresIn <= 0 {
+			return errors.New("expires_in must be a positive duration such as 48h")
+		}
+	}
+	if r.MaxDownloads != nil && *r.MaxDownloads < 1 {
+		return errors.New("max_downloads must be at least 1")
+	}
+	return nil
+}
+
+type ApiShareLink struct {
+	Id            uuid.UUID  `json:"id"`
+	ReportId      uuid.UUID  `json:"report_id"`
+	Url           string     `json:"url,omitempty"`
+	Status        string     `json:"status"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	MaxDownloads  *int       `json:"max_downloads,omitempty"`
+	DownloadCount int        `json:"download_count"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// shareLinkStatus is active while the link can be used, and otherwise why it can't.
+func shareLinkStatus(link *store.ShareLink, now time.Time) string {
+	switch {
+	case link.RevokedAt != nil:
+		return "revoked"
+	case !link.ExpiresAt.After(now):
+		return "expired"
+	case link.MaxDownloads != nil && link.DownloadCount >= *link.MaxDownloads:
+		return "exhausted"
+	}
+	return "active"
+}
+
+func newApiShareLink(link *store.ShareLink, now time.Time) *ApiShareLink {
+	return &ApiShareLink{
+		Id:            link.Id,
+		ReportId:      link.ReportId,
+		Status:        shareLinkStatus(link, now),
+		ExpiresAt:     link.ExpiresAt,
+		MaxDownloads:  link.MaxDownloads,
+		DownloadCount: link.DownloadCount,
+		RevokedAt:     link.RevokedAt,
+		CreatedAt:     link.CreatedAt,
+	}
+}
+
+type ApiReportAccess struct {
+	Action      string     `json:"action"`
+	UserId      *uuid.UUID `json:"user_id,omitempty"`
+	ShareLinkId *uuid.UUID `json:"share_link_id,omitempty"`
+	RemoteAddr  *string    `json:"remote_addr,omitempty"`
+	UserAgent   *string    `json:"user_agent,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// newApiSharedReport is the report as seen by someone it was shared with. The owner's download url,
+// storage path and callback url are left out, grantees download through the API so access is logged.
+func newApiSharedReport(report *store.Report) *ApiReport {
+	apiReport := newApiReport(report)
+	apiReport.OutputFilePath = nil
+	apiReport.DownloadUrl = nil
+	apiReport.DownloadUrlExpiresAt = nil
+	apiReport.CallbackUrl = nil
+	return apiReport
+}
+
+func newShareLinkToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate share link token: %w", err)
+	}
+	return "shr_" + hex.EncodeToString(token), nil
+}
+
+// shareLinkUrl is the public url of a share link. PUBLIC_URL is used when set, the url the request was
+// made to otherwise.
+func (s *ApiServer) shareLinkUrl(r *http.Request, token string) string {
+	baseUrl := s.config.PublicUrl
+	if baseUrl == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		baseUrl = scheme + "://" + r.Host
+	}
+	return strings.TrimSuffix(baseUrl, "/") + "/shared/" + token
+}
+
+// logReportAccess records an access to a report by someone other than its owner. Failing to log doesn't
+// fail the access.
+func (s *ApiServer) logReportAccess(ctx context.Context, r *http.Request, report *store.Report, action string, accessedBy *uuid.UUID, shareLinkId *uuid.UUID) {
+	access := &store.ReportAccess{
+		OwnerId:     report.UserId,
+		ReportId:    report.Id,
+		Action:      action,
+		AccessedBy:  accessedBy,
+		ShareLinkId: shareLinkId,
+	}
+	if r.RemoteAddr != "" {
+		access.RemoteAddr = &r.RemoteAddr
+	}
+	if userAgent := r.UserAgent(); userAgent != "" {
+		access.UserAgent = &userAgent
+	}
+	if err := s.store.ReportAccessLog.Log(ctx, access); err != nil {
+		s.logger.Error("failed to log report access", "report_id", report.Id, "action", action, "error", err)
+	}
+}
+
+// ownReport loads the report named by the request path, which has to belong to the user.
+func (s *ApiServer) ownReport(r *http.Request) (*store.User, *store.Report, error) {
+	reportId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, nil, NewErrWithStatus(http.StatusBadRequest, err)
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return nil, nil, NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+	}
+
+	report, err := s.store.ReportStore.ByPrimaryKey(r.Context(), user.Id, reportId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, NewErrWithStatus(http.StatusNotFound, err)
+		}
+		return nil, nil, NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	return user, report, nil
+}
+
+// sharedReport loads the report named by the request path, which has to be shared with the user.
+func (s *ApiServer) sharedReport(r *http.Request) (*store.User, *store.Report, error) {
+	reportId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, nil, NewErrWithStatus(http.StatusBadRequest, err)
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return nil, nil, NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+	}
+
+	report, err := s.store.ReportGrants.SharedReport(r.Context(), user.Id, reportId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, NewErrWithStatus(http.StatusNotFound, err)
+		}
+		return nil, nil, NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	return user, report, nil
+}
+
+// createReportGrantHandler gives the user with the email read-only access to the report. The response is the
+// same whether or not a user has the email, so the endpoint can't be used to find out who has an account.
+func (s *ApiServer) createReportGrantHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[CreateReportGrantRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, report, err := s.ownReport(r)
+		if err != nil {
+			return err
+		}
+
+		grantee, err := s.store.Users.ByEmail(r.Context(), strings.TrimSpace(req.Email))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if grantee != nil && grantee.Id == user.Id {
+			return NewErrWithStatus(http.StatusBadRequest, errors.New("a report can't be shared with its owner"))
+		}
+
+		if grantee != nil {
+			if _, err := s.store.ReportGrants.Create(r.Context(), user.Id, report.Id, grantee.Id); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "the report is shared with the user with this email, if there is one",
+		}, http.StatusAccepted, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) listReportGrantsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownReport(r)
+		if err != nil {
+			return err
+		}
+
+		grants, err := s.store.ReportGrants.ByReport(r.Context(), user.Id, report.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiGrants := make([]ApiReportGrant, 0, len(grants))
+		for _, grant := range grants {
+			apiGrants = append(apiGrants, *newApiReportGrant(&grant))
+		}
+
+		if err := encode(ApiResponse[[]ApiReportGrant]{
+			Data: &apiGrants,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) deleteReportGrantHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		granteeId, err := uuid.Parse(r.PathValue("userId"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.store.ReportGrants.Delete(r.Context(), user.Id, reportId, granteeId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// createShareLinkHandler creates a public link to a completed report's file. The link's url holds its
+// token and is only returned here.
+func (s *ApiServer) createShareLinkHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		var req CreateShareLinkRequest
+		var err error
+		if r.ContentLength != 0 {
+			if req, err = decode[CreateShareLinkRequest](r); err != nil {
+				return NewErrWithStatus(http.StatusBadRequest, err)
+			}
+		}
+
+		expiresIn := s.config.ShareLinkTtl
+		if req.ExpiresIn != "" {
+			expiresIn, _ = time.ParseDuration(req.ExpiresIn)
+		}
+		if expiresIn > s.config.MaxShareLinkTtl {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("expires_in can be at most %s", s.config.MaxShareLinkTtl))
+		}
+
+		user, report, err := s.ownReport(r)
+		if err != nil {
+			return err
+		}
+		if err := checkReportFile(report); err != nil {
+			return err
+		}
+
+		token, err := newShareLinkToken()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		now := time.Now()
+		link, err := s.store.ShareLinks.Create(r.Context(), &store.ShareLink{
+			UserId:       user.Id,
+			ReportId:     report.Id,
+			ExpiresAt:    now.Add(expiresIn),
+			MaxDownloads: req.MaxDownloads,
+		}, token)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiLink := newApiShareLink(link, now)
+		apiLink.Url = s.shareLinkUrl(r, token)
+		if err := encode(ApiResponse[ApiShareLink]{
+			Data: apiLink,
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) listShareLinksHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownReport(r)
+		if err != nil {
+			return err
+		}
+
+		links, err := s.store.ShareLinks.ByReport(r.Context(), user.Id, report.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		now := time.Now()
+		apiLinks := make([]ApiShareLink, 0, len(links))
+		for _, link := range links {
+			apiLinks = append(apiLinks, *newApiShareLink(&link, now))
+		}
+
+		if err := encode(ApiResponse[[]ApiShareLink]{
+			Data: &apiLinks,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) revokeShareLinkHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		linkId, err := uuid.Parse(r.PathValue("linkId"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		link, err := s.store.ShareLinks.Revoke(r.Context(), user.Id, reportId, linkId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiShareLink]{
+			Data: newApiShareLink(link, time.Now()),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// shareLinkDownloadHandler streams the file of a share link's report without authentication. The
+// download is counted once the file was found, so a link limited to one download isn't used up by a
+// failed attempt. Ranges aren't served, every download through a link is of the whole file.
+func (s *ApiServer) shareLinkDownloadHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		link, err := s.store.ShareLinks.ByToken(r.Context(), r.PathValue("token"))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if status := shareLinkStatus(link, time.Now()); status != "active" {
+			return NewErrWithStatus(http.StatusGone, fmt.Errorf("share link is %s", status))
+		}
+
+		report, err := s.reportWithFile(r.Context(), link.UserId, link.ReportId)
+		if err != nil {
+			return err
+		}
+
+		return s.streamReport(w, r, report, false, func() error {
+			if _, err := s.store.ShareLinks.Use(r.Context(), link.Id, time.Now()); err != nil {
+				if errors.Is(err, store.ErrShareLinkInactive) {
+					return NewErrWithStatus(http.StatusGone, err)
+				}
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			s.logReportAccess(r.Context(), r, report, store.ReportAccessDownload, nil, &link.Id)
+			return nil
+		})
+	})
+}
+
+func (s *ApiServer) listSharedReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		sharedReports, err := s.store.ReportGrants.SharedReports(r.Context(), user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiReports := make([]ApiReport, 0, len(sharedReports))
+		for _, report := range sharedReports {
+			apiReports = append(apiReports, *newApiSharedReport(&report))
+		}
+
+		if err := encode(ApiResponse[[]ApiReport]{
+			Data: &apiReports,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) getSharedReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.sharedReport(r)
+		if err != nil {
+			return err
+		}
+
+		s.logReportAccess(r.Context(), r, report, store.ReportAccessView, &user.Id, nil)
+
+		if err := encode(ApiResponse[ApiReport]{
+			Data: newApiSharedReport(report),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) downloadSharedReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.sharedReport(r)
+		if err != nil {
+			return err
+		}
+		if err := checkReportFile(report); err != nil {
+			return err
+		}
+
+		return s.streamReport(w, r, report, true, func() error {
+			s.logReportAccess(r.Context(), r, report, store.ReportAccessDownload, &user.Id, nil)
+			return nil
+		})
+	})
+}
+
+// reportAccessLogHandler lists the latest accesses to the report by the users it was shared with and
+// through its share links.
+func (s *ApiServer) reportAccessLogHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		limit := defaultReportAccessLogLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > maxReportAccessLogLimit {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxReportAccessLogLimit))
+			}
+		}
+
+		user, report, err := s.ownReport(r)
+		if err != nil {
+			return err
+		}
+
+		accesses, err := s.store.ReportAccessLog.ByReport(r.Context(), user.Id, report.Id, limit)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiAccesses := make([]ApiReportAccess, 0, len(accesses))
+		for _, access := range accesses {
+			apiAccesses = append(apiAccesses, ApiReportAccess{
+				Action:      access.Action,
+				UserId:      access.AccessedBy,
+				ShareLinkId: access.ShareLinkId,
+				RemoteAddr:  access.RemoteAddr,
+				UserAgent:   access.UserAgent,
+				CreatedAt:   access.CreatedAt,
+			})
+		}
+
+		if err := encode(ApiResponse[[]ApiReportAccess]{
+			Data: &apiAccesses,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,344 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
+)
+
+type ReportTemplateRequest struct {
+	CreateReportRequest
+	Name string `json:"name"`
+}
+
+func (r ReportTemplateRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.hasReportOnlyFields() {
+		return errors.New("title, description, tags and cache are set on reports, not templates")
+	}
+	return r.CreateReportRequest.Validate()
+}
+
+func (r ReportTemplateRequest) template(userId uuid.UUID) *store.ReportTemplate {
+	return &store.ReportTemplate{
+		UserId:           userId,
+		Name:             strings.TrimSpace(r.Name),
+		ReportType:       r.ReportType,
+		Parameters:       types.JSONText(r.Parameters),
+		OutputFormat:     r.OutputFormat,
+		Compression:      r.Compression,
+		CompressionLevel: r.CompressionLevel,
+		CallbackUrl:      r.CallbackUrl,
+		Priority:         r.Priority,
+	}
+}
+
+// RunReportTemplateRequest overrides parts of a template for a single run. Parameters are merged into the
+// template's parameters, the other fields replace the template's value when set.
+type RunReportTemplateRequest struct {
+	Parameters       json.RawMessage `json:"parameters,omitempty"`
+	OutputFormat     string          `json:"output_format,omitempty"`
+	Compression      string          `json:"compression,omitempty"`
+	CompressionLevel *int            `json:"compression_level,omitempty"`
+	CallbackUrl      *string         `json:"callback_url,omitempty"`
+	Priority         string          `json:"priority,omitempty"`
+	Title            *string         `json:"title,omitempty"`
+	Description      *string         `json:"description,omitempty"`
+	Tags             []string        `json:"tags,omitempty"`
+	Cache            *bool           `json:"cache,omitempty"`
+}
+
+// Validate is a no-op, the run is validated as the report request it is turned into.
+func (r RunReportTemplateRequest) Validate() error {
+	return nil
+}
+
+// reportRequest applies the overrides to the template.
+func (r RunReportTemplateRequest) reportRequest(template *store.ReportTemplate) (CreateReportRequest, error) {
+	parameters, err := reports.MergeParameters(template.Parameters, r.Parameters)
+	if err != nil {
+		return CreateReportRequest{}, err
+	}
+
+	req := CreateReportRequest{
+		ReportType:       template.ReportType,
+		Parameters:       parameters,
+		OutputFormat:     template.OutputFormat,
+		Compression:      template.Compression,
+		CompressionLevel: template.CompressionLevel,
+		CallbackUrl:      template.CallbackUrl,
+		Priority:         template.Priority,
+		Title:            r.Title,
+		Description:      r.Description,
+		Tags:             r.Tags,
+		Cache:            r.Cache,
+	}
+	if r.OutputFormat != "" {
+		req.OutputFormat = r.OutputFormat
+	}
+	if r.Compression != "" {
+		// the template's level may not be valid for the other codec
+		req.Compression = r.Compression
+		req.CompressionLevel = nil
+	}
+	if r.CompressionLevel != nil {
+		req.CompressionLevel = r.CompressionLevel
+	}
+	if r.CallbackUrl != nil {
+		req.CallbackUrl = r.CallbackUrl
+	}
+	if r.Priority != "" {
+		req.Priority = r.Priority
+	}
+	return req, nil
+}
+
+type ApiReportTemplate struct {
+	Id               uuid.UUID       `json:"id"`
+	Name             string          `json:"name"`
+	ReportType       string          `json:"report_type"`
+	Parameters       json.RawMessage `json:"parameters,omitempty"`
+	OutputFormat     string          `json:"output_format"`
+	Compression      string          `json:"compression"`
+	CompressionLevel *int            `json:"compression_level,omitempty"`
+	CallbackUrl      *string         `json:"callback_url,omitempty"`
+	Priority         string          `json:"priority"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+func newApiReportTemplate(template *store.ReportTemplate) *ApiReportTemplate {
+	return &ApiReportTemplate{
+		Id:               template.Id,
+		Name:             template.Name,
+		ReportType:       template.ReportType,
+		Parameters:       json.RawMessage(template.Parameters),
+		OutputFormat:     template.OutputFormat,
+		Compression:      template.Compression,
+		CompressionLevel: template.CompressionLevel,
+		CallbackUrl:      template.CallbackUrl,
+		Priority:         template.Priority,
+		CreatedAt:        template.CreatedAt,
+		UpdatedAt:        template.UpdatedAt,
+	}
+}
+
+// reportTemplateError maps the errors of storing a template to their HTTP responses.
+func reportTemplateError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return NewErrWithStatus(http.StatusNotFound, err)
+	case errors.Is(err, store.ErrReportTemplateNameTaken):
+		return NewErrWithStatus(http.StatusConflict, store.ErrReportTemplateNameTaken)
+	}
+	return NewErrWithStatus(http.StatusInternalServerError, err)
+}
+
+func (s *ApiServer) createReportTemplateHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[ReportTemplateRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.validateReportRequest(user, req.CreateReportRequest); err != nil {
+			return err
+		}
+
+		template, err := s.store.ReportTemplates.Create(r.Context(), req.template(user.Id))
+		if err != nil {
+			return reportTemplateError(err)
+		}
+
+		if err := encode(ApiResponse[ApiReportTemplate]{
+			Data: newApiReportTemplate(template),
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) listReportTemplatesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		templates, err := s.store.ReportTemplates.ByUser(r.Context(), user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiTemplates := make([]ApiReportTemplate, 0, len(templates))
+		for _, template := range templates {
+			apiTemplates = append(apiTemplates, *newApiReportTemplate(&template))
+		}
+
+		if err := encode(ApiResponse[[]ApiReportTemplate]{
+			Data: &apiTemplates,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) getReportTemplateHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		templateId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		template, err := s.store.ReportTemplates.ByPrimaryKey(r.Context(), user.Id, templateId)
+		if err != nil {
+			return reportTemplateError(err)
+		}
+
+		if err := encode(ApiResponse[ApiReportTemplate]{
+			Data: newApiReportTemplate(template),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) updateReportTemplateHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		templateId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		req, err := decode[ReportTemplateRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.validateReportRequest(user, req.CreateReportRequest); err != nil {
+			return err
+		}
+
+		template := req.template(user.Id)
+		template.Id = templateId
+		template, err = s.store.ReportTemplates.Update(r.Context(), template)
+		if err != nil {
+			return reportTemplateError(err)
+		}
+
+		if err := encode(ApiResponse[ApiReportTemplate]{
+			Data: newApiReportTemplate(template),
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) deleteReportTemplateHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		templateId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.store.ReportTemplates.Delete(r.Context(), user.Id, templateId); err != nil {
+			return reportTemplateError(err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// runReportTemplateHandler creates a report from a template. The body is optional and overrides parts
+// of the template for this report only.
+func (s *ApiServer) runReportTemplateHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		templateId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		var runReq RunReportTemplateRequest
+		if r.ContentLength != 0 {
+			if runReq, err = decode[RunReportTemplateRequest](r); err != nil {
+				return NewErrWithStatus(http.StatusBadRequest, err)
+			}
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		template, err := s.store.ReportTemplates.ByPrimaryKey(r.Context(), user.Id, templateId)
+		if err != nil {
+			return reportTemplateError(err)
+		}
+
+		req, err := runReq.reportRequest(template)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if err := req.Validate(); err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if err := s.validateReportRequest(user, req); err != nil {
+			return err
+		}
+
+		report := req.report(user.Id)
+		report.TemplateId = &template.Id
+		report, err = s.submitReport(r.Context(), w, report)
+		if err != nil {
+			return err
+		}
+
+		if err := encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,276 @@
+package apiserver
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit     = 500
+)
+
+type CreateWebhookRequest struct {
+	Url         string  `json:"url"`
+	Description *string `json:"description,omitempty"`
+}
+
+func (r CreateWebhookRequest) Validate() error {
+	if r.Url == "" {
+		return errors.New("url is required")
+	}
+	return reports.ValidateWebhookUrl(r.Url)
+}
+
+type ApiWebhookEndpoint struct {
+	Id          uuid.UUID `json:"id"`
+	Url         string    `json:"url"`
+	Description *string   `json:"description,omitempty"`
+	Secret      string    `json:"secret,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newApiWebhookEndpoint(endpoint *store.WebhookEndpoint) ApiWebhookEndpoint {
+	return ApiWebhookEndpoint{
+		Id:          endpoint.Id,
+		Url:         endpoint.Url,
+		Description: endpoint.Description,
+		CreatedAt:   endpoint.CreatedAt,
+	}
+}
+
+type ApiWebhookDelivery struct {
+	Id             uuid.UUID  `json:"id"`
+	EventId        uuid.UUID  `json:"event_id"`
+	Url            string     `json:"url"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func newApiWebhookDeliveries(deliveries []store.WebhookDelivery) []ApiWebhookDelivery {
+	apiDeliveries := make([]ApiWebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		apiDelivery := ApiWebhookDelivery{
+			Id:             delivery.Id,
+			EventId:        delivery.EventId,
+			Url:            delivery.Url,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			LastAttemptAt:  delivery.LastAttemptAt,
+			ResponseStatus: delivery.ResponseStatus,
+			LastError:      delivery.LastError,
+			CreatedAt:      delivery.CreatedAt,
+		}
+		if delivery.Status == store.WebhookDeliveryPending {
+			apiDelivery.NextAttemptAt = &delivery.NextAttemptAt
+		}
+		apiDeliveries = append(apiDeliveries, apiDelivery)
+	}
+	return apiDeliveries
+}
+
+func (s *ApiServer) createWebhookHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[CreateWebhookRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		secret, err := reports.NewWebhookSecret()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		endpoint, err := s.store.WebhookEndpoints.Create(r.Context(), user.Id, req.Url, secret, req.Description)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		// the secret is only ever returned when the endpoint is created
+		apiEndpoint := newApiWebhookEndpoint(endpoint)
+		apiEndpoint.Secret = endpoint.Secret
+		if err := encode(ApiResponse[ApiWebhookEndpoint]{
+			Data: &apiEndpoint,
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) listWebhooksHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		endpoints, err := s.store.WebhookEndpoints.ByUser(r.Context(), user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiEndpoints := make([]ApiWebhookEndpoint, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			apiEndpoints = append(apiEndpoints, newApiWebhookEndpoint(&endpoint))
+		}
+
+		if err := encode(ApiResponse[[]ApiWebhookEndpoint]{
+			Data: &apiEndpoints,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) deleteWebhookHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		endpointId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := s.store.WebhookEndpoints.Delete(r.Context(), user.Id, endpointId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func (s *ApiServer) listWebhookDeliveriesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		endpointId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		limit := defaultWebhookDeliveriesLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > maxWebhookDeliveriesLimit {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxWebhookDeliveriesLimit))
+			}
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if _, err := s.store.WebhookEndpoints.ByPrimaryKey(r.Context(), user.Id, endpointId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		deliveries, err := s.store.WebhookEvents.DeliveriesByEndpoint(r.Context(), user.Id, endpointId, limit)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		apiDeliveries := newApiWebhookDeliveries(deliveries)
+		if err := encode(ApiResponse[[]ApiWebhookDelivery]{
+			Data: &apiDeliveries,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *ApiServer) redeliverWebhookEventHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		eventId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if _, err := s.store.WebhookEvents.ByPrimaryKey(r.Context(), user.Id, eventId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		deliveries, err := s.store.WebhookEvents.Redeliver(r.Context(), user.Id, eventId)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if len(deliveries) == 0 {
+			return NewErrWithStatus(http.StatusConflict, errors.New("event has no webhook endpoints or callback url to deliver to"))
+		}
+
+		apiDeliveries := newApiWebhookDeliveries(deliveries)
+		if err := encode(ApiResponse[[]ApiWebhookDelivery]{
+			Data: &apiDeliveries,
+		}, http.StatusAccepted, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+type ApiCallbackSecret struct {
+	Secret string `json:"secret"`
+}
+
+// callbackSecretHandler returns the secret used to sign deliveries to the callback urls of the user's reports.
+func (s *ApiServer) callbackSecretHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		if s.config.WebhookSigningKey == "" {
+			return NewErrWithStatus(http.StatusNotFound, errors.New("callback urls are not enabled"))
+		}
+
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		if err := encode(ApiResponse[ApiCallbackSecret]{
+			Data: &ApiCallbackSecret{Secret: reports.CallbackSecret(s.config.WebhookSigningKey, user.Id)},
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"asyncapi/apiserver"
 	"asyncapi/config"
+	"asyncapi/reports"
 	"asyncapi/store"
 	"context"
 	"fmt"
@@ -31,6 +32,9 @@ func run() error {
 	if err != nil {
 		return nil
 	}
+	if err := reports.ValidateQueues(conf); err != nil {
+		return err
+	}
 
 	jsonHandler := slog.NewJSONHandler(os.Stdout, nil)
 	logger := slog.New(jsonHandler)
@@ -57,7 +61,7 @@ func run() error {
 	presignClient := s3.NewPresignClient(s3Client)
 
 	dataStore := store.New(db)
-	server := apiserver.New(conf, logger, dataStore, jwtManager, sqsClient, presignClient)
+	server := apiserver.New(conf, logger, dataStore, jwtManager, sqsClient, s3Client, presignClient, reports.DefaultRegistry())
 	if err := server.Start(ctx); err != nil {
 		return err
 	}
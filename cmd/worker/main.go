@@ -58,7 +58,42 @@ func run() error {
 	logger := slog.New(jsonHandler)
 
 	lozClient := reports.NewLozClient(&http.Client{Timeout: time.Second * 10})
-	builder := reports.NewReportBuilder(conf, dataStore.ReportStore, lozClient, s3Client, logger)
+	builder := reports.NewReportBuilder(conf, dataStore.ReportStore, dataStore.WebhookEvents, reports.DefaultRegistry(), lozClient, s3Client, logger)
+
+	cleaner := reports.NewArtifactCleaner(conf, dataStore.ArtifactDeletions, s3Client, logger)
+	go func() {
+		if err := cleaner.Start(ctx); err != nil {
+			logger.Error("artifact cleaner failed", "error", err)
+		}
+	}()
+
+	sweeper := reports.NewRetentionSweeper(conf, dataStore.ReportStore, logger)
+	go func() {
+		if err := sweeper.Start(ctx); err != nil {
+			logger.Error("retention sweeper failed", "error", err)
+		}
+	}()
+
+	reaper := reports.NewStaleReportReaper(conf, dataStore.ReportStore, dataStore.WebhookEvents, logger)
+	go func() {
+		if err := reaper.Start(ctx); err != nil {
+			logger.Error("stale report reaper failed", "error", err)
+		}
+	}()
+
+	dispatcher := reports.NewWebhookDispatcher(conf, dataStore.WebhookEvents, reports.NewWebhookClient(reports.NewWebhookHttpClient(time.Second*10)), logger)
+	go func() {
+		if err := dispatcher.Start(ctx); err != nil {
+			logger.Error("webhook dispatcher failed", "error", err)
+		}
+	}()
+
+	scheduler := reports.NewScheduler(conf, dataStore.ReportSchedules, reports.NewQueue(conf, sqsClient), logger)
+	go func() {
+		if err := scheduler.Start(ctx); err != nil {
+			logger.Error("report scheduler failed", "error", err)
+		}
+	}()
 
 	maxConcurrency := 2
 	worker := reports.NewWorker(conf, logger, builder, sqsClient, maxConcurrency)
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -14,21 +15,48 @@ const (
 )
 
 type Config struct {
-	DatabaseName         string `env:"DB_NAME"`
-	DatabaseHost         string `env:"DB_HOST"`
-	DatabasePort         string `env:"DB_PORT"`
-	DatabasePortTest     string `env:"DB_PORT_TEST"`
-	DatabaseUser         string `env:"DB_USER"`
-	DatabasePassword     string `env:"DB_PASSWORD"`
-	Env                  Env    `env:"ENV" envDefault:"dev"`
-	ProjectRoot          string `env:"PROJECT_ROOT"`
-	ApiServerPort        string `env:"APISERVER_PORT"`
-	ApiServerHost        string `env:"APISERVER_HOST"`
-	JwtSecret            string `env:"JWT_SECRET"`
-	S3LocalstackEndpoint string `env:"S3_LOCALSTACK_ENDPOINT"`
-	LocalstackEndpoint   string `env:"LOCALSTACK_ENDPOINT"`
-	S3Bucket             string `env:"S3_BUCKET"`
-	SqsQueue             string `env:"SQS_QUEUE"`
+	DatabaseName         string                   `env:"DB_NAME"`
+	DatabaseHost         string                   `env:"DB_HOST"`
+	DatabasePort         string                   `env:"DB_PORT"`
+	DatabasePortTest     string                   `env:"DB_PORT_TEST"`
+	DatabaseUser         string                   `env:"DB_USER"`
+	DatabasePassword     string                   `env:"DB_PASSWORD"`
+	Env                  Env                      `env:"ENV" envDefault:"dev"`
+	ProjectRoot          string                   `env:"PROJECT_ROOT"`
+	ApiServerPort        string                   `env:"APISERVER_PORT"`
+	ApiServerHost        string                   `env:"APISERVER_HOST"`
+	JwtSecret            string                   `env:"JWT_SECRET"`
+	S3LocalstackEndpoint string                   `env:"S3_LOCALSTACK_ENDPOINT"`
+	LocalstackEndpoint   string                   `env:"LOCALSTACK_ENDPOINT"`
+	S3Bucket             string                   `env:"S3_BUCKET"`
+	SqsQueue             string                   `env:"SQS_QUEUE"`
+	SqsQueueHigh         string                   `env:"SQS_QUEUE_HIGH"`
+	SqsQueueLow          string                   `env:"SQS_QUEUE_LOW"`
+	HighPriorityRoles    []string                 `env:"HIGH_PRIORITY_ROLES" envDefault:"admin"`
+	AdminRoles           []string                 `env:"ADMIN_ROLES" envDefault:"admin"`
+	PriorityWeights      map[string]int           `env:"PRIORITY_WEIGHTS" envDefault:"high:6,normal:3,low:1"`
+	IdempotencyKeyTtl    time.Duration            `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+	WebhookSigningKey    string                   `env:"WEBHOOK_SIGNING_KEY"`
+	MaxReportWaiters     int                      `env:"MAX_REPORT_WAITERS" envDefault:"1000"`
+	MaxReportWait        time.Duration            `env:"MAX_REPORT_WAIT" envDefault:"60s"`
+	PresignedUrlTtl      time.Duration            `env:"PRESIGNED_URL_TTL" envDefault:"15m"`
+	ReportRetention      time.Duration            `env:"REPORT_RETENTION" envDefault:"720h"`
+	ReportTypeRetention  map[string]time.Duration `env:"REPORT_TYPE_RETENTION"`
+	MaxReportBatchSize   int                      `env:"MAX_REPORT_BATCH_SIZE" envDefault:"100"`
+	MaxInFlightReports   int64                    `env:"MAX_IN_FLIGHT_REPORTS" envDefault:"10"`
+	MaxReportsPerHour    int64                    `env:"MAX_REPORTS_PER_HOUR" envDefault:"100"`
+	MaxReportsPerDay     int64                    `env:"MAX_REPORTS_PER_DAY" envDefault:"1000"`
+	MaxStoredBytes       int64                    `env:"MAX_STORED_BYTES" envDefault:"10737418240"`
+	ShareLinkTtl         time.Duration            `env:"SHARE_LINK_TTL" envDefault:"24h"`
+	MaxShareLinkTtl      time.Duration            `env:"MAX_SHARE_LINK_TTL" envDefault:"720h"`
+	PublicUrl            string                   `env:"PUBLIC_URL"`
+	ReportCacheTtl       time.Duration            `env:"REPORT_CACHE_TTL" envDefault:"10m"`
+	ValidateRequests     bool                     `env:"VALIDATE_REQUESTS" envDefault:"false"`
+	MaxRequestBodyBytes  int64                    `env:"MAX_REQUEST_BODY_BYTES" envDefault:"1048576"`
+	MaxPreviewSpoolBytes int64                    `env:"MAX_PREVIEW_SPOOL_BYTES" envDefault:"104857600"`
+	BuildTimeout         time.Duration            `env:"BUILD_TIMEOUT" envDefault:"15m"`
+	HeartbeatInterval    time.Duration            `env:"HEARTBEAT_INTERVAL" envDefault:"10s"`
+	StaleReportAfter     time.Duration            `env:"STALE_REPORT_AFTER" envDefault:"2m"`
 }
 
 func (c *Config) DatabaseUrl() string {
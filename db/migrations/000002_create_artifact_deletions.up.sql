@@ -0,0 +1,10 @@
+CREATE TABLE artifact_deletions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    object_key VARCHAR NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX artifact_deletions_next_attempt_at_idx ON artifact_deletions (next_attempt_at);
@@ -0,0 +1,5 @@
+ALTER TABLE reports
+    DROP COLUMN IF EXISTS compression,
+    DROP COLUMN IF EXISTS compression_level,
+    DROP COLUMN IF EXISTS uncompressed_size_bytes,
+    DROP COLUMN IF EXISTS compressed_size_bytes;
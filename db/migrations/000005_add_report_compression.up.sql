@@ -0,0 +1,5 @@
+ALTER TABLE reports
+    ADD COLUMN compression VARCHAR NOT NULL DEFAULT 'gzip',
+    ADD COLUMN compression_level INT,
+    ADD COLUMN uncompressed_size_bytes BIGINT,
+    ADD COLUMN compressed_size_bytes BIGINT;
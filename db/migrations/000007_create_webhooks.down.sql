@@ -0,0 +1,4 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS callback_url;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_events;
+DROP TABLE IF EXISTS webhook_endpoints;
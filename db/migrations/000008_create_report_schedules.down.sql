@@ -0,0 +1,3 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS schedule_id;
+DROP TABLE IF EXISTS schedule_runs;
+DROP TABLE IF EXISTS report_schedules;
@@ -0,0 +1,35 @@
+CREATE TABLE report_schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    cron_expression VARCHAR NOT NULL,
+    timezone VARCHAR NOT NULL DEFAULT 'UTC',
+    report_type VARCHAR NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '{}',
+    output_format VARCHAR NOT NULL DEFAULT 'csv',
+    compression VARCHAR NOT NULL DEFAULT 'gzip',
+    compression_level INT,
+    callback_url VARCHAR,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    catch_up_policy VARCHAR NOT NULL DEFAULT 'skip', --skip, run_once or run_all
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX report_schedules_user_id_idx ON report_schedules (user_id);
+CREATE INDEX report_schedules_due_idx ON report_schedules (next_run_at) WHERE enabled;
+
+CREATE TABLE schedule_runs (
+    schedule_id UUID NOT NULL REFERENCES report_schedules(id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    report_id UUID NOT NULL,
+    enqueued_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (schedule_id, scheduled_for)
+);
+
+CREATE INDEX schedule_runs_not_enqueued_idx ON schedule_runs (created_at) WHERE enqueued_at IS NULL;
+
+ALTER TABLE reports ADD COLUMN schedule_id UUID;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS retention_overrides;
+ALTER TABLE reports DROP COLUMN IF EXISTS expired_at;
+ALTER TABLE reports DROP COLUMN IF EXISTS pinned;
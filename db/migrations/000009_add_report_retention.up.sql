@@ -0,0 +1,9 @@
+ALTER TABLE reports ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE reports ADD COLUMN expired_at TIMESTAMPTZ;
+
+CREATE TABLE retention_overrides (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    retention_seconds BIGINT NOT NULL, --0 keeps the user's reports forever
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
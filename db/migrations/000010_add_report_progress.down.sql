@@ -0,0 +1,4 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS heartbeat_at;
+ALTER TABLE reports DROP COLUMN IF EXISTS phase;
+ALTER TABLE reports DROP COLUMN IF EXISTS rows_total;
+ALTER TABLE reports DROP COLUMN IF EXISTS rows_processed;
@@ -0,0 +1,4 @@
+ALTER TABLE reports ADD COLUMN rows_processed BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE reports ADD COLUMN rows_total BIGINT;
+ALTER TABLE reports ADD COLUMN phase TEXT;
+ALTER TABLE reports ADD COLUMN heartbeat_at TIMESTAMPTZ;
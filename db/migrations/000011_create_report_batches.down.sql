@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reports_batch_id_idx;
+ALTER TABLE reports DROP COLUMN IF EXISTS batch_id;
+DROP TABLE IF EXISTS report_batches;
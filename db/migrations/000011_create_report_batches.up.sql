@@ -0,0 +1,11 @@
+CREATE TABLE report_batches (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX report_batches_user_id_idx ON report_batches (user_id);
+
+ALTER TABLE reports ADD COLUMN batch_id UUID;
+
+CREATE INDEX reports_batch_id_idx ON reports (batch_id) WHERE batch_id IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS template_id;
+DROP TABLE IF EXISTS report_templates;
@@ -0,0 +1,16 @@
+CREATE TABLE report_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR NOT NULL,
+    report_type VARCHAR NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '{}',
+    output_format VARCHAR NOT NULL DEFAULT 'csv',
+    compression VARCHAR NOT NULL DEFAULT 'gzip',
+    compression_level INT,
+    callback_url VARCHAR,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+ALTER TABLE reports ADD COLUMN template_id UUID REFERENCES report_templates(id) ON DELETE SET NULL;
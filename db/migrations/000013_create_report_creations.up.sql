@@ -0,0 +1,7 @@
+-- every report created through the api, kept for a day so deleting reports doesn't reset the creation limits
+CREATE TABLE report_creations (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX report_creations_user_id_created_at_idx ON report_creations (user_id, created_at);
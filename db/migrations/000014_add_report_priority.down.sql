@@ -0,0 +1,3 @@
+ALTER TABLE report_templates DROP COLUMN IF EXISTS priority;
+ALTER TABLE reports DROP COLUMN IF EXISTS priority;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
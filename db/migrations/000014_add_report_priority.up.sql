@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN role VARCHAR NOT NULL DEFAULT 'standard';
+ALTER TABLE reports ADD COLUMN priority VARCHAR NOT NULL DEFAULT 'normal';
+ALTER TABLE report_templates ADD COLUMN priority VARCHAR NOT NULL DEFAULT 'normal';
@@ -0,0 +1,3 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS sha256;
+ALTER TABLE reports DROP COLUMN IF EXISTS content_type;
+ALTER TABLE reports DROP COLUMN IF EXISTS row_count;
@@ -0,0 +1,3 @@
+ALTER TABLE reports ADD COLUMN row_count BIGINT;
+ALTER TABLE reports ADD COLUMN content_type VARCHAR;
+ALTER TABLE reports ADD COLUMN sha256 VARCHAR(64); --hex of the stored object
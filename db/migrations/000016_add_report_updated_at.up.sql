@@ -0,0 +1,4 @@
+ALTER TABLE reports ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- GREATEST ignores nulls, so this is the last change recorded on the report
+UPDATE reports SET updated_at = GREATEST(created_at, started_at, completed_at, failed_at, expired_at, heartbeat_at);
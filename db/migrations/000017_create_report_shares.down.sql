@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS report_access_log;
+DROP TABLE IF EXISTS share_links;
+DROP TABLE IF EXISTS report_grants;
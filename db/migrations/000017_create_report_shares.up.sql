@@ -0,0 +1,40 @@
+CREATE TABLE report_grants (
+    owner_id UUID NOT NULL,
+    report_id UUID NOT NULL,
+    grantee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (owner_id, report_id, grantee_id),
+    FOREIGN KEY (owner_id, report_id) REFERENCES reports(user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX report_grants_grantee_id_idx ON report_grants (grantee_id, report_id);
+
+CREATE TABLE share_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    report_id UUID NOT NULL,
+    hashed_token VARCHAR(64) NOT NULL UNIQUE, --sha256 hex of the token, the token itself is only returned once
+    expires_at TIMESTAMPTZ NOT NULL,
+    max_downloads INT, --null is unlimited
+    download_count INT NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id, report_id) REFERENCES reports(user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX share_links_report_idx ON share_links (user_id, report_id);
+
+-- no foreign keys, the log outlives the reports and links it mentions
+CREATE TABLE report_access_log (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id UUID NOT NULL,
+    report_id UUID NOT NULL,
+    action VARCHAR NOT NULL,
+    accessed_by UUID, --the user with a grant, null for share links
+    share_link_id UUID,
+    remote_addr VARCHAR,
+    user_agent VARCHAR,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX report_access_log_report_idx ON report_access_log (owner_id, report_id, created_at);
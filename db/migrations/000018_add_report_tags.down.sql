@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS reports_search_idx;
+DROP INDEX IF EXISTS reports_tags_idx;
+ALTER TABLE reports DROP COLUMN IF EXISTS tags;
+ALTER TABLE reports DROP COLUMN IF EXISTS description;
+ALTER TABLE reports DROP COLUMN IF EXISTS title;
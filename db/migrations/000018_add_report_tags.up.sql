@@ -0,0 +1,10 @@
+ALTER TABLE reports ADD COLUMN title VARCHAR;
+ALTER TABLE reports ADD COLUMN description VARCHAR;
+ALTER TABLE reports ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX reports_tags_idx ON reports USING GIN (tags);
+
+-- searches have to use the same expression for the index to be used
+CREATE INDEX reports_search_idx ON reports USING GIN (
+    to_tsvector('english', COALESCE(title, '') || ' ' || COALESCE(description, ''))
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS artifacts;
+DROP INDEX IF EXISTS reports_fingerprint_idx;
+ALTER TABLE reports DROP COLUMN IF EXISTS cache_hit;
+ALTER TABLE reports DROP COLUMN IF EXISTS skip_cache;
+ALTER TABLE reports DROP COLUMN IF EXISTS fingerprint;
@@ -0,0 +1,13 @@
+ALTER TABLE reports ADD COLUMN fingerprint VARCHAR(64); --sha256 hex of what the file is built from, null if it can't be reused
+ALTER TABLE reports ADD COLUMN skip_cache BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE reports ADD COLUMN cache_hit BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- only reports that built their own file are reused, so a file can't be kept alive past the cache ttl
+CREATE INDEX reports_fingerprint_idx ON reports (fingerprint, completed_at) WHERE fingerprint IS NOT NULL AND NOT cache_hit;
+
+-- files referenced by more than one report. A file without a row is referenced by its own report only.
+CREATE TABLE artifacts (
+    object_key VARCHAR PRIMARY KEY,
+    ref_count INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
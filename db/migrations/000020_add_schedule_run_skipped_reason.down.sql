@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS schedule_runs_not_enqueued_idx;
+CREATE INDEX schedule_runs_not_enqueued_idx ON schedule_runs (created_at) WHERE enqueued_at IS NULL;
+
+DELETE FROM schedule_runs WHERE report_id IS NULL;
+ALTER TABLE schedule_runs DROP COLUMN IF EXISTS skipped_reason;
+ALTER TABLE schedule_runs ALTER COLUMN report_id SET NOT NULL;
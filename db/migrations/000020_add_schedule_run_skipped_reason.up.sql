@@ -0,0 +1,6 @@
+-- runs skipped because the user was over a quota have no report
+ALTER TABLE schedule_runs ALTER COLUMN report_id DROP NOT NULL;
+ALTER TABLE schedule_runs ADD COLUMN skipped_reason TEXT;
+
+DROP INDEX IF EXISTS schedule_runs_not_enqueued_idx;
+CREATE INDEX schedule_runs_not_enqueued_idx ON schedule_runs (created_at) WHERE enqueued_at IS NULL AND report_id IS NOT NULL;
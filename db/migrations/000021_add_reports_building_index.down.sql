@@ -0,0 +1 @@
+DROP INDEX IF EXISTS reports_building_idx;
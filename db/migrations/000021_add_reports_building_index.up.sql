@@ -0,0 +1,2 @@
+CREATE INDEX reports_building_idx ON reports (COALESCE(heartbeat_at, started_at))
+    WHERE started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL;
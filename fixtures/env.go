@@ -47,6 +47,6 @@ func (te *TestEnv) SetupDb(t *testing.T) func(t *testing.T) {
 }
 
 func (te *TestEnv) TeardownDb(t *testing.T) {
-	_, err := te.Db.Exec(fmt.Sprintf("TRUNCATE TABLE %s", strings.Join([]string{"users", "refresh_tokens", "reports"}, ", ")))
+	_, err := te.Db.Exec(fmt.Sprintf("TRUNCATE TABLE %s", strings.Join([]string{"users", "refresh_tokens", "reports", "artifact_deletions", "idempotency_keys", "webhook_endpoints", "webhook_events", "webhook_deliveries", "report_schedules", "schedule_runs", "retention_overrides", "report_batches", "report_templates", "report_creations", "report_grants", "share_links", "report_access_log", "artifacts"}, ", ")))
 	require.NoError(t, err)
 }
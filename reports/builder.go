@@ -4,13 +4,16 @@ import (
 	"asyncapi/config"
 	"asyncapi/store"
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/csv"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -18,21 +21,30 @@ import (
 	"github.com/google/uuid"
 )
 
+// failureUpdateTimeout bounds storing a failed build, which can't use the build's context.
+const failureUpdateTimeout = 10 * time.Second
+
 type ReportBuilder struct {
-	config      *config.Config
-	reportStore *store.ReportStore
-	lozClient   *LozClient
-	s3Client    *s3.Client
-	logger      *slog.Logger
+	config        *config.Config
+	reportStore   *store.ReportStore
+	webhookEvents *store.WebhookEventStore
+	storedReports *StoredReports
+	registry      *Registry
+	lozClient     *LozClient
+	s3Client      *s3.Client
+	logger        *slog.Logger
 }
 
-func NewReportBuilder(config *config.Config, reportStore *store.ReportStore, lozClient *LozClient, s3Client *s3.Client, logger *slog.Logger) *ReportBuilder {
+func NewReportBuilder(config *config.Config, reportStore *store.ReportStore, webhookEvents *store.WebhookEventStore, registry *Registry, lozClient *LozClient, s3Client *s3.Client, logger *slog.Logger) *ReportBuilder {
 	return &ReportBuilder{
-		config:      config,
-		reportStore: reportStore,
-		lozClient:   lozClient,
-		s3Client:    s3Client,
-		logger:      logger,
+		config:        config,
+		reportStore:   reportStore,
+		webhookEvents: webhookEvents,
+		storedReports: NewStoredReports(config, reportStore, s3Client),
+		registry:      registry,
+		lozClient:     lozClient,
+		s3Client:      s3Client,
+		logger:        logger,
 	}
 }
 
@@ -48,13 +60,22 @@ func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uu
 
 	defer func() {
 		if err != nil && report != nil {
+			// ctx is usually done when the build timed out or the worker is stopping, which mustn't keep the
+			// report in flight
+			failCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), failureUpdateTimeout)
+			defer cancel()
+
 			now := time.Now()
 			errMsg := err.Error()
 			report.FailedAt = &now
 			report.ErrorMessage = &errMsg
-			if _, updateErr := b.reportStore.Update(ctx, report); updateErr != nil {
+			failed, updateErr := b.reportStore.Update(failCtx, report)
+			if updateErr != nil {
 				b.logger.Error("failed to update report", "error", updateErr.Error())
+				return
 			}
+			b.publishEvent(failCtx, failed)
+			b.publishWebhook(failCtx, failed)
 		}
 	}()
 
@@ -66,72 +87,131 @@ func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uu
 	report.DownloadUrlExpiresAt = nil
 	report.DownloadUrl = nil
 	report.OutputFilePath = nil
+	report.UncompressedSizeBytes = nil
+	report.CompressedSizeBytes = nil
+	report.RowCount = nil
+	report.ContentType = nil
+	report.Sha256 = nil
+	report.Fingerprint = nil
 	report, err = b.reportStore.Update(ctx, report)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update report: %w", err)
 	}
+	b.publishEvent(ctx, report)
+
+	progress := newProgressTracker(b.reportStore, b.logger, report)
+	stopHeartbeat := progress.start(ctx, heartbeatInterval(b.config))
+	defer stopHeartbeat()
 
-	resp, err := b.lozClient.GetMonsters()
+	generator, err := b.registry.Get(report.ReportType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get monsters: %w", err)
+		return nil, err
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no monsters")
+	if cacheable, ok := generator.(Cacheable); ok {
+		// the fingerprint is stored even if this report skips the cache, so later ones can reuse it
+		fingerprint, err := Fingerprint(report, cacheable.SourceVersion())
+		if err != nil {
+			return nil, err
+		}
+		report.Fingerprint = &fingerprint
+
+		if !report.SkipCache && b.config.ReportCacheTtl > 0 {
+			if cached := b.fromCache(ctx, report); cached != nil {
+				stopHeartbeat()
+				b.logger.Info("completed report from cache", "reportId", report.Id, "userId", userId.String(), "path", *cached.OutputFilePath)
+				b.publishEvent(ctx, cached)
+				b.publishWebhook(ctx, cached)
+				return cached, nil
+			}
+		}
 	}
 
-	var buffer bytes.Buffer
+	progress.setPhase(ctx, PhaseFetching)
 
-	gzipWriter := gzip.NewWriter(&buffer)
-	csvWriter := csv.NewWriter(gzipWriter)
-	header := []string{"name", "id", "category", "description", "image", "common_locations", "drops", "dlc"}
-	if err := csvWriter.Write(header); err != nil {
-		return nil, fmt.Errorf("failed to write csv header: %w", err)
-	}
-
-	for _, monster := range resp.Data {
-		csvRow := []string{
-			monster.Name,
-			fmt.Sprintf("%d", monster.Id),
-			monster.Category,
-			monster.Description,
-			monster.Image,
-			strings.Join(monster.CommonLocations, ","),
-			strings.Join(monster.Drops, ","),
-			strconv.FormatBool(monster.Dlc),
-		}
+	table, err := generator.Generate(ctx, &Sources{LozClient: b.lozClient, Reports: b.storedReports}, report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s report: %w", report.ReportType, err)
+	}
 
-		if err := csvWriter.Write(csvRow); err != nil {
-			return nil, fmt.Errorf("failed to write csv row: %w", err)
-		}
+	format, err := FormatByName(report.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := CodecByName(report.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	// the checksum is computed over the stored bytes as they are written
+	var buffer bytes.Buffer
+	hash := sha256.New()
+
+	compressor, err := codec.NewWriter(io.MultiWriter(&buffer, hash), report.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	uncompressed := &countingWriter{w: compressor}
+	writer, err := format.NewWriter(uncompressed, table.Columns)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := csvWriter.Error(); err != nil {
-			return nil, fmt.Errorf("failed to write csv row: %w", err)
+	progress.setRowsTotal(int64(len(table.Rows)))
+	progress.setPhase(ctx, PhaseWriting)
+	for _, row := range table.Rows {
+		if err := writer.WriteRow(row); err != nil {
+			return nil, err
 		}
+		progress.addRows(ctx, 1)
 	}
 
-	csvWriter.Flush()
-	if err := csvWriter.Error(); err != nil {
-		return nil, fmt.Errorf("failed to write csv writer: %w", err)
+	if err := writer.Close(); err != nil {
+		return nil, err
 	}
 
-	if err := gzipWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+	if err := compressor.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close %s writer: %w", codec.Name, err)
 	}
 
-	key := "/users/" + userId.String() + "/report/" + reportId.String() + ".csv.gz"
-	_, err = b.s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Key:    aws.String(key),
-		Bucket: aws.String(b.config.S3Bucket),
-		Body:   bytes.NewReader(buffer.Bytes()),
-	})
+	progress.setPhase(ctx, PhaseUploading)
+	checksum := hash.Sum(nil)
+	sha256Hex := hex.EncodeToString(checksum)
+	rowCount := int64(len(table.Rows))
+	contentType := format.ContentType
+	key := "/users/" + userId.String() + "/report/" + reportId.String() + "." + format.Extension + codec.Extension
+	putObjectInput := &s3.PutObjectInput{
+		Key:         aws.String(key),
+		Bucket:      aws.String(b.config.S3Bucket),
+		Body:        bytes.NewReader(buffer.Bytes()),
+		ContentType: aws.String(contentType),
+		// storage verifies the upload against the checksum and returns it with the object
+		ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(checksum)),
+		Metadata: map[string]string{
+			"sha256":            sha256Hex,
+			"row-count":         strconv.FormatInt(rowCount, 10),
+			"uncompressed-size": strconv.FormatInt(uncompressed.count, 10),
+		},
+	}
+	if codec.ContentEncoding != "" {
+		putObjectInput.ContentEncoding = aws.String(codec.ContentEncoding)
+	}
+	_, err = b.s3Client.PutObject(ctx, putObjectInput)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload report to %s: %w", key, err)
 	}
 
+	stopHeartbeat()
 	now = time.Now()
+	compressedSize := int64(buffer.Len())
 	report.OutputFilePath = &key
+	report.UncompressedSizeBytes = &uncompressed.count
+	report.CompressedSizeBytes = &compressedSize
+	report.RowCount = &rowCount
+	report.ContentType = &contentType
+	report.Sha256 = &sha256Hex
 	report.CompletedAt = &now
 	report, err = b.reportStore.Update(ctx, report)
 	if err != nil {
@@ -139,5 +219,59 @@ func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uu
 	}
 
 	b.logger.Info("successfully uploaded report", "reportId", report.Id, "userId", userId.String(), "path", key)
+	b.publishEvent(ctx, report)
+	b.publishWebhook(ctx, report)
 	return report, nil
 }
+
+// fromCache completes the report with the file of an identical report of the same user completed within
+// REPORT_CACHE_TTL.
+// It returns nil if there is none, in which case the report is built. Errors are only logged, a report
+// can always be built instead.
+func (b *ReportBuilder) fromCache(ctx context.Context, report *store.Report) *store.Report {
+	source, err := b.reportStore.CachedReport(ctx, report.UserId, *report.Fingerprint, time.Now().Add(-b.config.ReportCacheTtl))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			b.logger.Error("failed to look up cached report", "reportId", report.Id, "error", err)
+		}
+		return nil
+	}
+
+	cached, err := b.reportStore.CompleteFromCache(ctx, report, source, time.Now())
+	if err != nil {
+		// sql.ErrNoRows if the cached report was deleted or expired since it was found
+		if !errors.Is(err, sql.ErrNoRows) {
+			b.logger.Error("failed to complete report from cache", "reportId", report.Id, "cachedReportId", source.Id, "error", err)
+		}
+		return nil
+	}
+	return cached
+}
+
+// publishEvent lets apiserver instances streaming this report know its status changed.
+// heartbeatInterval is how often reports being built store a heartbeat.
+func heartbeatInterval(config *config.Config) time.Duration {
+	if config.HeartbeatInterval <= 0 {
+		return defaultHeartbeatInterval
+	}
+	return config.HeartbeatInterval
+}
+
+func (b *ReportBuilder) publishEvent(ctx context.Context, report *store.Report) {
+	if err := b.reportStore.PublishEvent(ctx, report); err != nil {
+		b.logger.Error("failed to publish report event", "reportId", report.Id, "error", err)
+	}
+}
+
+// publishWebhook queues webhook deliveries for a finished report. Errors are only logged since the
+// report itself has already been stored.
+func (b *ReportBuilder) publishWebhook(ctx context.Context, report *store.Report) {
+	event, err := NewWebhookEvent(report)
+	if err != nil {
+		b.logger.Error("failed to create webhook event", "reportId", report.Id, "error", err)
+		return
+	}
+	if _, err := b.webhookEvents.Publish(ctx, event); err != nil {
+		b.logger.Error("failed to publish webhook event", "reportId", report.Id, "error", err)
+	}
+}
@@ -0,0 +1,64 @@
+package reports_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/reports"
+	"asyncapi/schema"
+	"asyncapi/store"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowGenerator takes delay to generate a report and then fails, so the build never reaches storage.
+type slowGenerator struct {
+	delay time.Duration
+}
+
+func (g *slowGenerator) Name() string                    { return "slow" }
+func (g *slowGenerator) Description() string             { return "Takes a while and then fails" }
+func (g *slowGenerator) ParameterSchema() *schema.Schema { return nil }
+func (g *slowGenerator) ValidateParameters([]byte) error { return nil }
+
+func (g *slowGenerator) Generate(ctx context.Context, _ *reports.Sources, _ *store.Report) (*reports.Table, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(g.delay):
+		return nil, errors.New("slow generator is done")
+	}
+}
+
+func TestReportBuilderHeartbeat(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	dataStore := store.New(env.Db)
+	user, err := dataStore.Users.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+	report, err := dataStore.ReportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "slow"})
+	require.NoError(t, err)
+
+	conf := *env.Config
+	conf.HeartbeatInterval = 50 * time.Millisecond
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	builder := reports.NewReportBuilder(&conf, dataStore.ReportStore, dataStore.WebhookEvents, reports.NewRegistry(&slowGenerator{delay: 5 * conf.HeartbeatInterval}), nil, nil, logger)
+
+	_, err = builder.Build(ctx, user.Id, report.Id)
+	require.ErrorContains(t, err, "slow generator is done")
+
+	// the generator failed the build rather than a timeout, and heartbeats were stored while it ran
+	built, err := dataStore.ReportStore.ByPrimaryKey(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.NotNil(t, built.FailedAt)
+	require.Equal(t, "failed to generate slow report: slow generator is done", *built.ErrorMessage)
+	require.NotNil(t, built.HeartbeatAt)
+	require.GreaterOrEqual(t, built.HeartbeatAt.Sub(*built.StartedAt), conf.HeartbeatInterval)
+}
@@ -0,0 +1,53 @@
+package reports
+
+import (
+	"asyncapi/store"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Cacheable is implemented by generators whose reports can be reused: the same parameters give the same
+// file as long as the data the generator reads doesn't change.
+type Cacheable interface {
+	// SourceVersion changes whenever the generator's output for the same parameters does, so reports
+	// built before the change aren't reused.
+	SourceVersion() string
+}
+
+// Fingerprint identifies the file a report builds to. Reports with the same fingerprint get the same
+// file. Parameters are re-encoded so the order of their keys and whitespace don't matter.
+func Fingerprint(report *store.Report, sourceVersion string) (string, error) {
+	var parameters any
+	if len(report.Parameters) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(report.Parameters))
+		decoder.UseNumber()
+		if err := decoder.Decode(&parameters); err != nil {
+			return "", fmt.Errorf("failed to decode parameters of report %s: %w", report.Id, err)
+		}
+	}
+
+	canonical, err := json.Marshal(struct {
+		ReportType       string `json:"report_type"`
+		Parameters       any    `json:"parameters"`
+		OutputFormat     string `json:"output_format"`
+		Compression      string `json:"compression"`
+		CompressionLevel *int   `json:"compression_level"`
+		SourceVersion    string `json:"source_version"`
+	}{
+		ReportType:       report.ReportType,
+		Parameters:       parameters,
+		OutputFormat:     report.OutputFormat,
+		Compression:      report.Compression,
+		CompressionLevel: report.CompressionLevel,
+		SourceVersion:    sourceVersion,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode fingerprint of report %s: %w", report.Id, err)
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,63 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"testing"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	report := &store.Report{
+		ReportType:   reports.MonsterReportType,
+		Parameters:   types.JSONText(`{"category": "monsters", "columns": ["name", "id"]}`),
+		OutputFormat: "csv",
+		Compression:  "gzip",
+	}
+	fingerprint, err := reports.Fingerprint(report, "1")
+	require.NoError(t, err)
+	require.Len(t, fingerprint, 64)
+
+	// key order and whitespace don't matter
+	reordered := *report
+	reordered.Parameters = types.JSONText(`{"columns":["name","id"],"category":"monsters"}`)
+	same, err := reports.Fingerprint(&reordered, "1")
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, same)
+
+	// the order of values does
+	swapped := *report
+	swapped.Parameters = types.JSONText(`{"category": "monsters", "columns": ["id", "name"]}`)
+	different, err := reports.Fingerprint(&swapped, "1")
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, different)
+
+	json := *report
+	json.OutputFormat = "json"
+	different, err = reports.Fingerprint(&json, "1")
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, different)
+
+	level := 9
+	leveled := *report
+	leveled.CompressionLevel = &level
+	different, err = reports.Fingerprint(&leveled, "1")
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, different)
+
+	different, err = reports.Fingerprint(report, "2")
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, different)
+
+	noParameters := *report
+	noParameters.Parameters = nil
+	_, err = reports.Fingerprint(&noParameters, "1")
+	require.NoError(t, err)
+
+	invalid := *report
+	invalid.Parameters = types.JSONText(`{`)
+	_, err = reports.Fingerprint(&invalid, "1")
+	require.Error(t, err)
+}
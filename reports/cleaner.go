@@ -0,0 +1,93 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"asyncapi/store"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	artifactCleanupInterval  = 10 * time.Second
+	artifactCleanupBatchSize = 25
+	artifactDeletionLease    = time.Minute
+	artifactDeletionBackoff  = 30 * time.Second
+	artifactDeletionMaxDelay = time.Hour
+)
+
+// ArtifactCleaner removes report output files from S3 after their reports have been deleted.
+// Failed deletions stay queued and are retried with exponential backoff so temporary storage
+// errors don't leave orphaned objects in the bucket.
+type ArtifactCleaner struct {
+	config    *config.Config
+	deletions *store.ArtifactDeletionStore
+	s3Client  *s3.Client
+	logger    *slog.Logger
+}
+
+func NewArtifactCleaner(config *config.Config, deletions *store.ArtifactDeletionStore, s3Client *s3.Client, logger *slog.Logger) *ArtifactCleaner {
+	return &ArtifactCleaner{
+		config:    config,
+		deletions: deletions,
+		s3Client:  s3Client,
+		logger:    logger,
+	}
+}
+
+func (c *ArtifactCleaner) Start(ctx context.Context) error {
+	c.logger.Info("starting artifact cleaner", "interval", artifactCleanupInterval.String())
+	ticker := time.NewTicker(artifactCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Info("artifact cleaner stopped", "error", ctx.Err())
+			return nil
+		case <-ticker.C:
+			c.cleanup(ctx)
+		}
+	}
+}
+
+func (c *ArtifactCleaner) cleanup(ctx context.Context) {
+	deletions, err := c.deletions.Claim(ctx, artifactCleanupBatchSize, time.Now().Add(artifactDeletionLease))
+	if err != nil {
+		c.logger.Error("failed to claim artifact deletions", "error", err)
+		return
+	}
+
+	for _, deletion := range deletions {
+		_, err := c.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(c.config.S3Bucket),
+			Key:    aws.String(deletion.ObjectKey),
+		})
+		if err != nil {
+			nextAttemptAt := time.Now().Add(backoffDelay(artifactDeletionBackoff, artifactDeletionMaxDelay, deletion.Attempts))
+			c.logger.Warn("failed to delete artifact", "key", deletion.ObjectKey, "attempts", deletion.Attempts, "next_attempt_at", nextAttemptAt, "error", err)
+			if err := c.deletions.Fail(ctx, deletion.Id, err.Error(), nextAttemptAt); err != nil {
+				c.logger.Error("failed to record artifact deletion failure", "error", err)
+			}
+			continue
+		}
+
+		if err := c.deletions.Complete(ctx, deletion.Id); err != nil {
+			c.logger.Error("failed to complete artifact deletion", "error", err)
+			continue
+		}
+		c.logger.Info("deleted artifact", "key", deletion.ObjectKey)
+	}
+}
+
+// backoffDelay doubles the initial delay for every attempt after the first, up to maxDelay.
+func backoffDelay(initial time.Duration, maxDelay time.Duration, attempts int) time.Duration {
+	delay := initial
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
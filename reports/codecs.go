@@ -0,0 +1,145 @@
+package reports
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const DefaultCompression = "gzip"
+
+// Codec compresses report artifacts. Extension is appended to the object key after the format
+// extension and ContentEncoding is set on the stored object. ContentType is used when the compressed
+// file is downloaded as is.
+type Codec struct {
+	Name            string
+	Extension       string
+	ContentEncoding string
+	ContentType     string
+	minLevel        int
+	maxLevel        int
+	newWriter       func(w io.Writer, level *int) (io.WriteCloser, error)
+	newReader       func(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = []*Codec{
+	{
+		Name: "none",
+		newWriter: func(w io.Writer, level *int) (io.WriteCloser, error) {
+			return nopWriteCloser{w}, nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(r), nil
+		},
+	},
+	{
+		Name:            "gzip",
+		Extension:       ".gz",
+		ContentEncoding: "gzip",
+		ContentType:     "application/gzip",
+		minLevel:        gzip.BestSpeed,
+		maxLevel:        gzip.BestCompression,
+		newWriter: func(w io.Writer, level *int) (io.WriteCloser, error) {
+			if level == nil {
+				return gzip.NewWriter(w), nil
+			}
+			return gzip.NewWriterLevel(w, *level)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		Name:            "zstd",
+		Extension:       ".zst",
+		ContentEncoding: "zstd",
+		ContentType:     "application/zstd",
+		minLevel:        1,
+		maxLevel:        22,
+		newWriter: func(w io.Writer, level *int) (io.WriteCloser, error) {
+			if level == nil {
+				return zstd.NewWriter(w)
+			}
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(*level)))
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			decoder, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		},
+	},
+}
+
+func CodecByName(name string) (*Codec, error) {
+	index := slices.IndexFunc(codecs, func(c *Codec) bool { return c.Name == name })
+	if index < 0 {
+		return nil, fmt.Errorf("unknown compression %q, must be one of %s", name, strings.Join(CodecNames(), ", "))
+	}
+	return codecs[index], nil
+}
+
+func CodecNames() []string {
+	names := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		names = append(names, codec.Name)
+	}
+	return names
+}
+
+func (c *Codec) ValidateLevel(level int) error {
+	if c.minLevel == 0 && c.maxLevel == 0 {
+		return fmt.Errorf("compression %s does not support a level", c.Name)
+	}
+	if level < c.minLevel || level > c.maxLevel {
+		return fmt.Errorf("compression level for %s must be between %d and %d", c.Name, c.minLevel, c.maxLevel)
+	}
+	return nil
+}
+
+// NewWriter returns a writer compressing into w at the given level, or the codec's default level if nil.
+func (c *Codec) NewWriter(w io.Writer, level *int) (io.WriteCloser, error) {
+	if level != nil {
+		if err := c.ValidateLevel(*level); err != nil {
+			return nil, err
+		}
+	}
+	writer, err := c.newWriter(w, level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s writer: %w", c.Name, err)
+	}
+	return writer, nil
+}
+
+// NewReader returns a reader decompressing r.
+func (c *Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	reader, err := c.newReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s reader: %w", c.Name, err)
+	}
+	return reader, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += int64(n)
+	return n, err
+}
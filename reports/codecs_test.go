@@ -0,0 +1,61 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs(t *testing.T) {
+	input := strings.Repeat("name,id,category\nBokoblin,1,monsters\n", 100)
+	level := 9
+
+	decompress := map[string]func(r io.Reader) (io.Reader, error){
+		"none": func(r io.Reader) (io.Reader, error) { return r, nil },
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	for _, name := range reports.CodecNames() {
+		t.Run(name, func(t *testing.T) {
+			codec, err := reports.CodecByName(name)
+			require.NoError(t, err)
+
+			var levelPtr *int
+			if name != "none" {
+				levelPtr = &level
+			}
+
+			var buffer bytes.Buffer
+			writer, err := codec.NewWriter(&buffer, levelPtr)
+			require.NoError(t, err)
+			_, err = io.WriteString(writer, input)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			reader, err := decompress[name](&buffer)
+			require.NoError(t, err)
+			output, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, input, string(output))
+		})
+	}
+
+	none, err := reports.CodecByName("none")
+	require.NoError(t, err)
+	require.Error(t, none.ValidateLevel(1))
+
+	gzipCodec, err := reports.CodecByName("gzip")
+	require.NoError(t, err)
+	require.Equal(t, ".gz", gzipCodec.Extension)
+	require.Error(t, gzipCodec.ValidateLevel(10))
+
+	_, err = reports.CodecByName("brotli")
+	require.Error(t, err)
+}
@@ -0,0 +1,230 @@
+package reports
+
+import (
+	"asyncapi/schema"
+	"asyncapi/store"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DiffReportType = "diff"
+
+	DefaultDiffKey = "id"
+	// maxDiffRows bounds the rows read from each report since both are held in memory while diffing.
+	maxDiffRows = 100_000
+)
+
+// Kinds of changes listed in a diff report.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+var diffColumns = []Column{
+	{Name: "change", Type: ColumnTypeString},
+	{Name: "key", Type: ColumnTypeString},
+	{Name: "field", Type: ColumnTypeString},
+	{Name: "before", Type: ColumnTypeString},
+	{Name: "after", Type: ColumnTypeString},
+}
+
+type DiffReportParameters struct {
+	BaseReportId   uuid.UUID `json:"base_report_id" description:"earlier report to compare against"`
+	TargetReportId uuid.UUID `json:"target_report_id" description:"later report whose changes are listed"`
+	Key            string    `json:"key,omitempty" description:"column rows are matched on, defaults to id"`
+}
+
+func (p DiffReportParameters) Validate() error {
+	if p.BaseReportId == uuid.Nil {
+		return errors.New("base_report_id is required")
+	}
+	if p.TargetReportId == uuid.Nil {
+		return errors.New("target_report_id is required")
+	}
+	if p.BaseReportId == p.TargetReportId {
+		return errors.New("base_report_id and target_report_id must be different reports")
+	}
+	return nil
+}
+
+// ParseDiffReportParameters decodes and validates diff report parameters, defaulting the key column.
+func ParseDiffReportParameters(raw []byte) (*DiffReportParameters, error) {
+	var params DiffReportParameters
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if params.Key == "" {
+		params.Key = DefaultDiffKey
+	}
+	return &params, nil
+}
+
+type DiffReportGenerator struct{}
+
+func (g *DiffReportGenerator) Name() string {
+	return DiffReportType
+}
+
+func (g *DiffReportGenerator) Description() string {
+	return "Rows added, removed and changed between two completed reports, matched on a key column. " +
+		"Changed rows list each changed field with its before and after value, added and removed rows carry the whole row as json."
+}
+
+func (g *DiffReportGenerator) ParameterSchema() *schema.Schema {
+	return schema.For[DiffReportParameters]()
+}
+
+func (g *DiffReportGenerator) ValidateParameters(raw []byte) error {
+	_, err := ParseDiffReportParameters(raw)
+	return err
+}
+
+func (g *DiffReportGenerator) Generate(ctx context.Context, sources *Sources, report *store.Report) (*Table, error) {
+	params, err := ParseDiffReportParameters(report.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := sources.Reports.Read(ctx, report.UserId, params.BaseReportId, maxDiffRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base report: %w", err)
+	}
+	target, err := sources.Reports.Read(ctx, report.UserId, params.TargetReportId, maxDiffRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target report: %w", err)
+	}
+	if base.HasMore || target.HasMore {
+		return nil, fmt.Errorf("reports with more than %d rows can't be diffed", maxDiffRows)
+	}
+
+	return DiffTables(base, target, params.Key)
+}
+
+type keyedRows struct {
+	keys []string
+	rows map[string]map[string]string
+}
+
+func keyRows(preview *Preview, key string) (*keyedRows, error) {
+	keyIndex := -1
+	for i, column := range preview.Columns {
+		if column == key {
+			keyIndex = i
+		}
+	}
+	if keyIndex < 0 {
+		return nil, fmt.Errorf("key column %q not found", key)
+	}
+
+	keyed := &keyedRows{rows: make(map[string]map[string]string, len(preview.Rows))}
+	for _, row := range preview.Rows {
+		rowKey := previewValue(row[keyIndex])
+		if _, ok := keyed.rows[rowKey]; ok {
+			return nil, fmt.Errorf("key %q appears more than once in column %q", rowKey, key)
+		}
+		values := make(map[string]string, len(row))
+		for i, value := range row {
+			values[preview.Columns[i]] = previewValue(value)
+		}
+		keyed.keys = append(keyed.keys, rowKey)
+		keyed.rows[rowKey] = values
+	}
+	return keyed, nil
+}
+
+// previewValue formats a parsed value the way it is written in a report table.
+func previewValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// encodeRow encodes a whole row as a json object with its columns in order.
+func encodeRow(columns []string, values map[string]string) (string, error) {
+	row := make([]string, 0, len(columns))
+	tableColumns := make([]Column, 0, len(columns))
+	for _, column := range columns {
+		row = append(row, values[column])
+		tableColumns = append(tableColumns, Column{Name: column, Type: ColumnTypeString})
+	}
+	object, err := encodeObject(tableColumns, row)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode row: %w", err)
+	}
+	return string(object), nil
+}
+
+// DiffTables lists the rows removed from and changed in base, in base's order, followed by the rows added
+// in target. Columns are matched by name, so reports in different formats can be compared, and only the
+// columns both reports have are compared.
+func DiffTables(base *Preview, target *Preview, key string) (*Table, error) {
+	baseRows, err := keyRows(base, key)
+	if err != nil {
+		return nil, fmt.Errorf("base report: %w", err)
+	}
+	targetRows, err := keyRows(target, key)
+	if err != nil {
+		return nil, fmt.Errorf("target report: %w", err)
+	}
+
+	fields := make([]string, 0, len(base.Columns))
+	for _, column := range base.Columns {
+		if slices.Contains(target.Columns, column) {
+			fields = append(fields, column)
+		}
+	}
+
+	table := &Table{Columns: diffColumns}
+	for _, rowKey := range baseRows.keys {
+		before := baseRows.rows[rowKey]
+		after, ok := targetRows.rows[rowKey]
+		if !ok {
+			encoded, err := encodeRow(base.Columns, before)
+			if err != nil {
+				return nil, err
+			}
+			table.Rows = append(table.Rows, []string{DiffRemoved, rowKey, "", encoded, ""})
+			continue
+		}
+		for _, field := range fields {
+			if before[field] != after[field] {
+				table.Rows = append(table.Rows, []string{DiffChanged, rowKey, field, before[field], after[field]})
+			}
+		}
+	}
+	for _, rowKey := range targetRows.keys {
+		if _, ok := baseRows.rows[rowKey]; ok {
+			continue
+		}
+		encoded, err := encodeRow(target.Columns, targetRows.rows[rowKey])
+		if err != nil {
+			return nil, err
+		}
+		table.Rows = append(table.Rows, []string{DiffAdded, rowKey, "", "", encoded})
+	}
+	return table, nil
+}
@@ -0,0 +1,59 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffTables(t *testing.T) {
+	base := &reports.Preview{
+		Columns: []string{"name", "id", "drops"},
+		Rows: [][]any{
+			{"Bokoblin", "1", "Bokoblin Horn"},
+			{"Moblin", "2", "Moblin Horn"},
+			{"Lizalfos", "3", "Lizalfos Tail"},
+		},
+	}
+	// the target was stored as json, so its values are typed and its columns in another order
+	target := &reports.Preview{
+		Columns: []string{"id", "name", "drops", "dlc"},
+		Rows: [][]any{
+			{json.Number("1"), "Bokoblin", "Bokoblin Horn,Bokoblin Fang", false},
+			{json.Number("3"), "Lizalfos", "Lizalfos Tail", false},
+			{json.Number("4"), "Lynel", "Lynel Hoof", true},
+		},
+	}
+
+	table, err := reports.DiffTables(base, target, "id")
+	require.NoError(t, err)
+	require.Equal(t, []string{"change", "key", "field", "before", "after"}, []string{
+		table.Columns[0].Name, table.Columns[1].Name, table.Columns[2].Name, table.Columns[3].Name, table.Columns[4].Name,
+	})
+	require.Equal(t, [][]string{
+		{reports.DiffChanged, "1", "drops", "Bokoblin Horn", "Bokoblin Horn,Bokoblin Fang"},
+		{reports.DiffRemoved, "2", "", `{"name":"Moblin","id":"2","drops":"Moblin Horn"}`, ""},
+		{reports.DiffAdded, "4", "", "", `{"id":"4","name":"Lynel","drops":"Lynel Hoof","dlc":"true"}`},
+	}, table.Rows)
+
+	_, err = reports.DiffTables(base, target, "category")
+	require.Error(t, err)
+
+	duplicate := &reports.Preview{Columns: []string{"id"}, Rows: [][]any{{"1"}, {"1"}}}
+	_, err = reports.DiffTables(base, duplicate, "id")
+	require.Error(t, err)
+}
+
+func TestParseDiffReportParameters(t *testing.T) {
+	params, err := reports.ParseDiffReportParameters([]byte(`{
+		"base_report_id": "0b9c2a4e-5f1d-4c7e-9a0b-1c2d3e4f5a6b",
+		"target_report_id": "7d8e9f0a-1b2c-4d3e-8f4a-5b6c7d8e9f0a"
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, reports.DefaultDiffKey, params.Key)
+
+	_, err = reports.ParseDiffReportParameters([]byte(`{"base_report_id": "0b9c2a4e-5f1d-4c7e-9a0b-1c2d3e4f5a6b"}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type parquetWriter struct {
+	writer  *parquet.Writer
+	columns []Column
+}
+
+func newParquetWriter(w io.Writer, columns []Column) (Writer, error) {
+	group := make(parquet.Group, len(columns))
+	for _, column := range columns {
+		switch column.Type {
+		case ColumnTypeInteger:
+			group[column.Name] = parquet.Optional(parquet.Int(64))
+		case ColumnTypeBoolean:
+			group[column.Name] = parquet.Optional(parquet.Leaf(parquet.BooleanType))
+		default:
+			group[column.Name] = parquet.Optional(parquet.String())
+		}
+	}
+
+	return &parquetWriter{
+		writer:  parquet.NewWriter(w, parquet.NewSchema("report", group)),
+		columns: columns,
+	}, nil
+}
+
+func (w *parquetWriter) WriteRow(row []string) error {
+	values := make(map[string]any, len(row))
+	for i, value := range row {
+		values[w.columns[i].Name] = typedValue(w.columns[i], value)
+	}
+	if err := w.writer.Write(values); err != nil {
+		return fmt.Errorf("failed to write parquet row: %w", err)
+	}
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close parquet writer: %w", err)
+	}
+	return nil
+}
+
+// readParquetPreview reads the first rows of a parquet file. Parquet keeps its metadata at the end of the
+// file, so it is spooled to disk and read from there.
+func readParquetPreview(r io.Reader, limit int) (*Preview, error) {
+	file, size, cleanup, err := spool(r)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	parquetFile, err := parquet.OpenFile(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	reader := parquet.NewReader(parquetFile)
+	defer reader.Close()
+
+	preview := &Preview{Columns: []string{}, Rows: [][]any{}, HasMore: reader.NumRows() > int64(limit)}
+	for _, field := range reader.Schema().Fields() {
+		preview.Columns = append(preview.Columns, field.Name())
+	}
+
+	for len(preview.Rows) < limit {
+		values := map[string]any{}
+		if err := reader.Read(&values); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read parquet row: %w", err)
+		}
+		row := make([]any, len(preview.Columns))
+		for i, column := range preview.Columns {
+			row[i] = values[column]
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+	return preview, nil
+}
@@ -0,0 +1,195 @@
+package reports
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	xlsxSheet     = "Sheet1"
+	xlsxSheetPath = "xl/worksheets/sheet1.xml"
+)
+
+type xlsxWriter struct {
+	w       io.Writer
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	columns []Column
+	rowNum  int
+}
+
+func newXlsxWriter(w io.Writer, columns []Column) (Writer, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create xlsx stream writer: %w", err)
+	}
+
+	header := make([]any, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, column.Name)
+	}
+	if err := stream.SetRow("A1", header); err != nil {
+		return nil, fmt.Errorf("failed to write xlsx header: %w", err)
+	}
+
+	return &xlsxWriter{w: w, file: file, stream: stream, columns: columns, rowNum: 1}, nil
+}
+
+func (w *xlsxWriter) WriteRow(row []string) error {
+	w.rowNum++
+	cell, err := excelize.CoordinatesToCellName(1, w.rowNum)
+	if err != nil {
+		return fmt.Errorf("failed to get xlsx cell name: %w", err)
+	}
+
+	values := make([]any, 0, len(row))
+	for i, value := range row {
+		values = append(values, typedValue(w.columns[i], value))
+	}
+	if err := w.stream.SetRow(cell, values); err != nil {
+		return fmt.Errorf("failed to write xlsx row: %w", err)
+	}
+	return nil
+}
+
+// Close writes the workbook out. xlsx is a zip archive, so nothing reaches the underlying writer before this.
+func (w *xlsxWriter) Close() error {
+	defer w.file.Close()
+	if err := w.stream.Flush(); err != nil {
+		return fmt.Errorf("failed to flush xlsx stream: %w", err)
+	}
+	if err := w.file.Write(w.w); err != nil {
+		return fmt.Errorf("failed to write xlsx file: %w", err)
+	}
+	return nil
+}
+
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+func (c *xlsxCell) value() (any, error) {
+	switch c.Type {
+	case "inlineStr":
+		var text strings.Builder
+		text.WriteString(c.Inline.Text)
+		for _, run := range c.Inline.Runs {
+			text.WriteString(run.Text)
+		}
+		return text.String(), nil
+	case "b":
+		return c.Value == "1", nil
+	case "str", "e":
+		return c.Value, nil
+	case "s":
+		return nil, errors.New("shared strings are not supported")
+	}
+	if i, err := strconv.ParseInt(c.Value, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(c.Value, 64); err == nil {
+		return f, nil
+	}
+	return c.Value, nil
+}
+
+// readXlsxPreview streams the rows of the sheet written by xlsxWriter out of the workbook. excelize reads
+// whole workbooks into memory, so the sheet is decoded from the zip archive directly.
+func readXlsxPreview(r io.Reader, limit int) (*Preview, error) {
+	file, size, cleanup, err := spool(r)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xlsx archive: %w", err)
+	}
+	sheet, err := archive.Open(xlsxSheetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xlsx sheet: %w", err)
+	}
+	defer sheet.Close()
+
+	preview := &Preview{Columns: []string{}, Rows: [][]any{}}
+	header := true
+	var row []any
+	decoder := xml.NewDecoder(sheet)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return preview, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode xlsx sheet: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "row":
+				if !header && len(preview.Rows) == limit {
+					preview.HasMore = true
+					return preview, nil
+				}
+				row = []any{}
+			case "c":
+				var cell xlsxCell
+				if err := decoder.DecodeElement(&cell, &element); err != nil {
+					return nil, fmt.Errorf("failed to decode xlsx cell: %w", err)
+				}
+				column := len(row) + 1
+				if cell.Ref != "" {
+					name, _, err := excelize.SplitCellName(cell.Ref)
+					if err != nil {
+						return nil, err
+					}
+					if column, err = excelize.ColumnNameToNumber(name); err != nil {
+						return nil, err
+					}
+				}
+				value, err := cell.value()
+				if err != nil {
+					return nil, err
+				}
+				for len(row) < column {
+					row = append(row, nil)
+				}
+				row[column-1] = value
+			}
+		case xml.EndElement:
+			if element.Name.Local != "row" {
+				continue
+			}
+			if header {
+				for _, value := range row {
+					name, _ := value.(string)
+					preview.Columns = append(preview.Columns, name)
+				}
+				header = false
+				continue
+			}
+			for len(row) < len(preview.Columns) {
+				row = append(row, nil)
+			}
+			preview.Rows = append(preview.Rows, row)
+		}
+	}
+}
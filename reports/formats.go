@@ -0,0 +1,191 @@
+package reports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const DefaultOutputFormat = "csv"
+
+// Writer encodes the rows of a report table into an output format. Writers don't close the
+// underlying io.Writer, Close only flushes whatever the format still buffers.
+type Writer interface {
+	WriteRow(row []string) error
+	Close() error
+}
+
+type Format struct {
+	Name        string
+	Extension   string
+	ContentType string
+	// Spooled formats need random access and are copied to a temporary file as a whole to be previewed
+	Spooled     bool
+	newWriter   func(w io.Writer, columns []Column) (Writer, error)
+	readPreview func(r io.Reader, limit int) (*Preview, error)
+}
+
+// NewWriter returns a writer for the format that has already written any header the format needs.
+func (f *Format) NewWriter(w io.Writer, columns []Column) (Writer, error) {
+	return f.newWriter(w, columns)
+}
+
+var formats = []*Format{
+	{Name: "csv", Extension: "csv", ContentType: "text/csv; charset=utf-8", newWriter: newCsvWriter, readPreview: readCsvPreview},
+	{Name: "json", Extension: "json", ContentType: "application/json", newWriter: newJsonWriter, readPreview: readJsonPreview},
+	{Name: "ndjson", Extension: "ndjson", ContentType: "application/x-ndjson", newWriter: newNdjsonWriter, readPreview: readNdjsonPreview},
+	{Name: "xlsx", Extension: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Spooled: true, newWriter: newXlsxWriter, readPreview: readXlsxPreview},
+	{Name: "parquet", Extension: "parquet", ContentType: "application/vnd.apache.parquet", Spooled: true, newWriter: newParquetWriter, readPreview: readParquetPreview},
+}
+
+func FormatByName(name string) (*Format, error) {
+	index := slices.IndexFunc(formats, func(f *Format) bool { return f.Name == name })
+	if index < 0 {
+		return nil, fmt.Errorf("unknown output format %q, must be one of %s", name, strings.Join(FormatNames(), ", "))
+	}
+	return formats[index], nil
+}
+
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for _, format := range formats {
+		names = append(names, format.Name)
+	}
+	return names
+}
+
+// typedValue converts a table value to the go type matching its column. Values that don't
+// parse as the column type are treated as missing.
+func typedValue(column Column, value string) any {
+	switch column.Type {
+	case ColumnTypeInteger:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return i
+	case ColumnTypeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	return value
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCsvWriter(w io.Writer, columns []Column) (Writer, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, column.Name)
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write csv header: %w", err)
+	}
+	return &csvWriter{writer: writer}, nil
+}
+
+func (w *csvWriter) WriteRow(row []string) error {
+	if err := w.writer.Write(row); err != nil {
+		return fmt.Errorf("failed to write csv row: %w", err)
+	}
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return fmt.Errorf("failed to flush csv writer: %w", err)
+	}
+	return nil
+}
+
+// encodeObject encodes a row as a json object, keeping the keys in column order.
+func encodeObject(columns []Column, row []string) ([]byte, error) {
+	object := []byte{'{'}
+	for i, column := range columns {
+		if i > 0 {
+			object = append(object, ',')
+		}
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(typedValue(column, row[i]))
+		if err != nil {
+			return nil, err
+		}
+		object = append(object, key...)
+		object = append(object, ':')
+		object = append(object, value...)
+	}
+	return append(object, '}'), nil
+}
+
+type jsonWriter struct {
+	w       io.Writer
+	columns []Column
+	rows    int
+}
+
+func newJsonWriter(w io.Writer, columns []Column) (Writer, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, fmt.Errorf("failed to write json array: %w", err)
+	}
+	return &jsonWriter{w: w, columns: columns}, nil
+}
+
+func (w *jsonWriter) WriteRow(row []string) error {
+	object, err := encodeObject(w.columns, row)
+	if err != nil {
+		return fmt.Errorf("failed to encode json row: %w", err)
+	}
+	if w.rows > 0 {
+		object = append([]byte{','}, object...)
+	}
+	if _, err := w.w.Write(object); err != nil {
+		return fmt.Errorf("failed to write json row: %w", err)
+	}
+	w.rows++
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	if _, err := io.WriteString(w.w, "]\n"); err != nil {
+		return fmt.Errorf("failed to close json array: %w", err)
+	}
+	return nil
+}
+
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []Column
+}
+
+func newNdjsonWriter(w io.Writer, columns []Column) (Writer, error) {
+	return &ndjsonWriter{w: w, columns: columns}, nil
+}
+
+func (w *ndjsonWriter) WriteRow(row []string) error {
+	object, err := encodeObject(w.columns, row)
+	if err != nil {
+		return fmt.Errorf("failed to encode ndjson row: %w", err)
+	}
+	if _, err := w.w.Write(append(object, '\n')); err != nil {
+		return fmt.Errorf("failed to write ndjson row: %w", err)
+	}
+	return nil
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
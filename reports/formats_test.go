@@ -0,0 +1,85 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+var testColumns = []reports.Column{
+	{Name: "name", Type: reports.ColumnTypeString},
+	{Name: "id", Type: reports.ColumnTypeInteger},
+	{Name: "dlc", Type: reports.ColumnTypeBoolean},
+}
+
+var testRows = [][]string{
+	{"Bokoblin", "1", "false"},
+	{"Lynel, Silver", "3", "true"},
+}
+
+func writeTestTable(t *testing.T, formatName string) []byte {
+	format, err := reports.FormatByName(formatName)
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+	writer, err := format.NewWriter(&buffer, testColumns)
+	require.NoError(t, err)
+	for _, row := range testRows {
+		require.NoError(t, writer.WriteRow(row))
+	}
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func TestFormats(t *testing.T) {
+	_, err := reports.FormatByName("pdf")
+	require.Error(t, err)
+
+	t.Run("csv", func(t *testing.T) {
+		records, err := csv.NewReader(bytes.NewReader(writeTestTable(t, "csv"))).ReadAll()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{{"name", "id", "dlc"}, testRows[0], testRows[1]}, records)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		output := writeTestTable(t, "json")
+		require.True(t, strings.HasPrefix(string(output), `[{"name":"Bokoblin","id":1,"dlc":false}`))
+		var rows []map[string]any
+		require.NoError(t, json.Unmarshal(output, &rows))
+		require.Len(t, rows, 2)
+		require.Equal(t, map[string]any{"name": "Lynel, Silver", "id": float64(3), "dlc": true}, rows[1])
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(string(writeTestTable(t, "ndjson"))), "\n")
+		require.Equal(t, []string{
+			`{"name":"Bokoblin","id":1,"dlc":false}`,
+			`{"name":"Lynel, Silver","id":3,"dlc":true}`,
+		}, lines)
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		file, err := excelize.OpenReader(bytes.NewReader(writeTestTable(t, "xlsx")))
+		require.NoError(t, err)
+		defer file.Close()
+		rows, err := file.GetRows(file.GetSheetName(0))
+		require.NoError(t, err)
+		require.Equal(t, [][]string{{"name", "id", "dlc"}, {"Bokoblin", "1", "FALSE"}, {"Lynel, Silver", "3", "TRUE"}}, rows)
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		reader := parquet.NewReader(bytes.NewReader(writeTestTable(t, "parquet")))
+		defer reader.Close()
+		require.Equal(t, int64(2), reader.NumRows())
+		row := map[string]any{}
+		require.NoError(t, reader.Read(&row))
+		require.Equal(t, map[string]any{"name": "Bokoblin", "id": int64(1), "dlc": false}, row)
+	})
+}
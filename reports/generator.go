@@ -0,0 +1,93 @@
+package reports
+
+import (
+	"asyncapi/schema"
+	"asyncapi/store"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownReportType = errors.New("unknown report type")
+
+type ColumnType string
+
+const (
+	ColumnTypeString  ColumnType = "string"
+	ColumnTypeInteger ColumnType = "integer"
+	ColumnTypeBoolean ColumnType = "boolean"
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Table is the format independent result of a generator. Values are kept in their string form and
+// converted according to the column type by the output writers.
+type Table struct {
+	Columns []Column
+	Rows    [][]string
+}
+
+// Sources gives generators access to the data reports are built from.
+type Sources struct {
+	LozClient *LozClient
+	Reports   *StoredReports
+}
+
+type Generator interface {
+	Name() string
+	Description() string
+	ParameterSchema() *schema.Schema
+	ValidateParameters(raw []byte) error
+	Generate(ctx context.Context, sources *Sources, report *store.Report) (*Table, error)
+}
+
+type Registry struct {
+	generators map[string]Generator
+}
+
+func NewRegistry(generators ...Generator) *Registry {
+	registry := &Registry{generators: make(map[string]Generator, len(generators))}
+	for _, generator := range generators {
+		registry.generators[generator.Name()] = generator
+	}
+	return registry
+}
+
+// DefaultRegistry returns a registry with every report type the service supports.
+func DefaultRegistry() *Registry {
+	return NewRegistry(&MonsterReportGenerator{}, &DiffReportGenerator{})
+}
+
+func (r *Registry) Get(reportType string) (Generator, error) {
+	generator, ok := r.generators[reportType]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownReportType, reportType)
+	}
+	return generator, nil
+}
+
+// Generators returns the registered generators sorted by name.
+func (r *Registry) Generators() []Generator {
+	generators := make([]Generator, 0, len(r.generators))
+	for _, generator := range r.generators {
+		generators = append(generators, generator)
+	}
+	slices.SortFunc(generators, func(a, b Generator) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return generators
+}
+
+// Validate checks that the report type exists and that the parameters are valid for it.
+func (r *Registry) Validate(reportType string, parameters []byte) error {
+	generator, err := r.Get(reportType)
+	if err != nil {
+		return err
+	}
+	return generator.ValidateParameters(parameters)
+}
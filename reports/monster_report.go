@@ -0,0 +1,237 @@
+package reports
+
+import (
+	"asyncapi/schema"
+	"asyncapi/store"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const MonsterReportType = "monsters"
+
+// monsterReportVersion has to be bumped when monster reports change, e.g. a column is added, so that
+// cached reports built before aren't reused.
+const monsterReportVersion = "1"
+
+type monsterColumn struct {
+	name       string
+	columnType ColumnType
+	value      func(m Monster) string
+	compare    func(a, b Monster) int
+}
+
+var monsterColumns = []monsterColumn{
+	{name: "name", columnType: ColumnTypeString, value: func(m Monster) string { return m.Name }},
+	{
+		name:       "id",
+		columnType: ColumnTypeInteger,
+		value:      func(m Monster) string { return strconv.Itoa(m.Id) },
+		compare:    func(a, b Monster) int { return cmp.Compare(a.Id, b.Id) },
+	},
+	{name: "category", columnType: ColumnTypeString, value: func(m Monster) string { return m.Category }},
+	{name: "description", columnType: ColumnTypeString, value: func(m Monster) string { return m.Description }},
+	{name: "image", columnType: ColumnTypeString, value: func(m Monster) string { return m.Image }},
+	{name: "common_locations", columnType: ColumnTypeString, value: func(m Monster) string { return strings.Join(m.CommonLocations, ",") }},
+	{name: "drops", columnType: ColumnTypeString, value: func(m Monster) string { return strings.Join(m.Drops, ",") }},
+	{
+		name:       "dlc",
+		columnType: ColumnTypeBoolean,
+		value:      func(m Monster) string { return strconv.FormatBool(m.Dlc) },
+		compare:    func(a, b Monster) int { return cmp.Compare(strconv.FormatBool(a.Dlc), strconv.FormatBool(b.Dlc)) },
+	},
+}
+
+func monsterColumnByName(name string) (monsterColumn, bool) {
+	for _, column := range monsterColumns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return monsterColumn{}, false
+}
+
+type MonsterReportParameters struct {
+	Category       string   `json:"category,omitempty" description:"only include monsters of this category"`
+	Dlc            *bool    `json:"dlc,omitempty" description:"only include dlc (true) or base game (false) monsters"`
+	CommonLocation string   `json:"common_location,omitempty" description:"only include monsters commonly found at this location"`
+	Drop           string   `json:"drop,omitempty" description:"only include monsters that drop this item"`
+	Columns        []string `json:"columns,omitempty" description:"columns to include, in order; defaults to all columns"`
+	SortBy         string   `json:"sort_by,omitempty" description:"column to sort the rows by"`
+	SortOrder      string   `json:"sort_order,omitempty" enum:"asc,desc" description:"sort direction, defaults to asc"`
+}
+
+func (p MonsterReportParameters) Validate() error {
+	seen := make(map[string]bool, len(p.Columns))
+	for _, name := range p.Columns {
+		if _, ok := monsterColumnByName(name); !ok {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("column %q is listed more than once", name)
+		}
+		seen[name] = true
+	}
+	if p.SortBy != "" {
+		if _, ok := monsterColumnByName(p.SortBy); !ok {
+			return fmt.Errorf("unknown sort_by column %q", p.SortBy)
+		}
+	}
+	switch p.SortOrder {
+	case "", "asc", "desc":
+	default:
+		return errors.New("sort_order must be asc or desc")
+	}
+	if p.SortOrder != "" && p.SortBy == "" {
+		return errors.New("sort_order requires sort_by")
+	}
+	return nil
+}
+
+// ParseMonsterReportParameters decodes and validates monster report parameters, rejecting unknown fields
+// so that typos in filter names don't silently produce an unfiltered report.
+func ParseMonsterReportParameters(raw []byte) (*MonsterReportParameters, error) {
+	var params MonsterReportParameters
+	if len(raw) == 0 {
+		return &params, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	return &params, nil
+}
+
+func (p *MonsterReportParameters) columns() []monsterColumn {
+	if len(p.Columns) == 0 {
+		return monsterColumns
+	}
+	columns := make([]monsterColumn, 0, len(p.Columns))
+	for _, name := range p.Columns {
+		column, _ := monsterColumnByName(name)
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func (p *MonsterReportParameters) matches(m Monster) bool {
+	if p.Category != "" && !strings.EqualFold(m.Category, p.Category) {
+		return false
+	}
+	if p.Dlc != nil && m.Dlc != *p.Dlc {
+		return false
+	}
+	if p.CommonLocation != "" && !containsFold(m.CommonLocations, p.CommonLocation) {
+		return false
+	}
+	if p.Drop != "" && !containsFold(m.Drops, p.Drop) {
+		return false
+	}
+	return true
+}
+
+// apply filters and sorts the monsters according to the parameters.
+func (p *MonsterReportParameters) apply(monsters []Monster) []Monster {
+	filtered := make([]Monster, 0, len(monsters))
+	for _, monster := range monsters {
+		if p.matches(monster) {
+			filtered = append(filtered, monster)
+		}
+	}
+
+	if p.SortBy != "" {
+		column, _ := monsterColumnByName(p.SortBy)
+		compare := column.compare
+		if compare == nil {
+			compare = func(a, b Monster) int { return strings.Compare(column.value(a), column.value(b)) }
+		}
+		slices.SortStableFunc(filtered, func(a, b Monster) int {
+			if p.SortOrder == "desc" {
+				return compare(b, a)
+			}
+			return compare(a, b)
+		})
+	}
+
+	return filtered
+}
+
+func containsFold(values []string, target string) bool {
+	return slices.ContainsFunc(values, func(value string) bool {
+		return strings.EqualFold(value, target)
+	})
+}
+
+type MonsterReportGenerator struct{}
+
+func (g *MonsterReportGenerator) Name() string {
+	return MonsterReportType
+}
+
+func (g *MonsterReportGenerator) Description() string {
+	return "Monsters from the Hyrule Compendium with their locations and drops."
+}
+
+func (g *MonsterReportGenerator) ParameterSchema() *schema.Schema {
+	s := schema.For[MonsterReportParameters]()
+	columnNames := make([]string, 0, len(monsterColumns))
+	for _, column := range monsterColumns {
+		columnNames = append(columnNames, column.name)
+	}
+	s.Properties["columns"].Items.Enum = columnNames
+	s.Properties["sort_by"].Enum = columnNames
+	return s
+}
+
+// SourceVersion makes monster reports cacheable. The compendium doesn't change, so the version only
+// changes with the report itself.
+func (g *MonsterReportGenerator) SourceVersion() string {
+	return monsterReportVersion
+}
+
+func (g *MonsterReportGenerator) ValidateParameters(raw []byte) error {
+	_, err := ParseMonsterReportParameters(raw)
+	return err
+}
+
+func (g *MonsterReportGenerator) Generate(ctx context.Context, sources *Sources, report *store.Report) (*Table, error) {
+	params, err := ParseMonsterReportParameters(report.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sources.LozClient.GetMonsters()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monsters: %w", err)
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no monsters")
+	}
+
+	columns := params.columns()
+	table := &Table{Columns: make([]Column, 0, len(columns))}
+	for _, column := range columns {
+		table.Columns = append(table.Columns, Column{Name: column.name, Type: column.columnType})
+	}
+
+	for _, monster := range params.apply(resp.Data) {
+		row := make([]string, 0, len(columns))
+		for _, column := range columns {
+			row = append(row, column.value(monster))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
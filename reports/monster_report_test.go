@@ -0,0 +1,45 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMonsterReportParameters(t *testing.T) {
+	params, err := reports.ParseMonsterReportParameters([]byte(`{"category":"monsters","dlc":false,"drop":"Lynel Horn","columns":["id","name"],"sort_by":"id","sort_order":"desc"}`))
+	require.NoError(t, err)
+	require.Equal(t, "monsters", params.Category)
+	require.False(t, *params.Dlc)
+	require.Equal(t, "Lynel Horn", params.Drop)
+	require.Equal(t, []string{"id", "name"}, params.Columns)
+
+	params, err = reports.ParseMonsterReportParameters(nil)
+	require.NoError(t, err)
+	require.Empty(t, params.Columns)
+
+	_, err = reports.ParseMonsterReportParameters([]byte(`{"colour":"red"}`))
+	require.Error(t, err)
+	_, err = reports.ParseMonsterReportParameters([]byte(`{"columns":["id","id"]}`))
+	require.Error(t, err)
+	_, err = reports.ParseMonsterReportParameters([]byte(`{"columns":["weight"]}`))
+	require.Error(t, err)
+	_, err = reports.ParseMonsterReportParameters([]byte(`{"sort_order":"desc"}`))
+	require.Error(t, err)
+}
+
+func TestRegistry(t *testing.T) {
+	registry := reports.DefaultRegistry()
+
+	require.NoError(t, registry.Validate(reports.MonsterReportType, []byte(`{"dlc":true}`)))
+	require.Error(t, registry.Validate(reports.MonsterReportType, []byte(`{"dlc":"yes"}`)))
+	require.ErrorIs(t, registry.Validate("food", nil), reports.ErrUnknownReportType)
+
+	generator, err := registry.Get(reports.MonsterReportType)
+	require.NoError(t, err)
+	parameterSchema := generator.ParameterSchema()
+	require.Equal(t, "object", parameterSchema.Type)
+	require.Equal(t, []string{"asc", "desc"}, parameterSchema.Properties["sort_order"].Enum)
+	require.Contains(t, parameterSchema.Properties["columns"].Items.Enum, "drops")
+}
@@ -0,0 +1,43 @@
+package reports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MergeParameters shallowly merges overrides into the parameters of a report. Top level keys of overrides
+// replace those of base and a null value removes the key, nested objects are replaced as a whole.
+func MergeParameters(base []byte, overrides []byte) (json.RawMessage, error) {
+	if len(overrides) == 0 {
+		return base, nil
+	}
+
+	merged := map[string]json.RawMessage{}
+	if len(base) > 0 {
+		if err := json.Unmarshal(base, &merged); err != nil {
+			return nil, fmt.Errorf("parameters must be an object: %w", err)
+		}
+	}
+	var overrideValues map[string]json.RawMessage
+	if err := json.Unmarshal(overrides, &overrideValues); err != nil {
+		return nil, fmt.Errorf("parameter overrides must be an object: %w", err)
+	}
+	if overrideValues == nil {
+		return nil, errors.New("parameter overrides must be an object")
+	}
+
+	for key, value := range overrideValues {
+		if string(value) == "null" {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+
+	result, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode parameters: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,29 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeParameters(t *testing.T) {
+	base := []byte(`{"category": "monsters", "dlc": true, "columns": ["name", "id"]}`)
+
+	merged, err := reports.MergeParameters(base, nil)
+	require.NoError(t, err)
+	require.JSONEq(t, string(base), string(merged))
+
+	merged, err = reports.MergeParameters(base, []byte(`{"dlc": null, "columns": ["name"], "sort_by": "name"}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"category": "monsters", "columns": ["name"], "sort_by": "name"}`, string(merged))
+
+	merged, err = reports.MergeParameters(nil, []byte(`{"category": "monsters"}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"category": "monsters"}`, string(merged))
+
+	_, err = reports.MergeParameters(base, []byte(`["dlc"]`))
+	require.Error(t, err)
+	_, err = reports.MergeParameters(base, []byte(`null`))
+	require.Error(t, err)
+}
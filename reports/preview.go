@@ -0,0 +1,190 @@
+package reports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Preview is the beginning of a stored report. HasMore is set when the report has rows past the preview.
+type Preview struct {
+	Columns []string
+	Rows    [][]any
+	HasMore bool
+}
+
+var ErrPreviewTooLarge = errors.New("report is too large to preview")
+
+// ReadPreview parses the header and up to limit rows of a report written in the format. Spooled formats are
+// copied to a temporary file, so r is never read into memory as a whole, and fail with ErrPreviewTooLarge
+// once more than maxSpoolBytes were read. A maxSpoolBytes of 0 doesn't limit the spool.
+func (f *Format) ReadPreview(r io.Reader, limit int, maxSpoolBytes int64) (*Preview, error) {
+	if f.Spooled && maxSpoolBytes > 0 {
+		r = &spoolLimitReader{r: r, remaining: maxSpoolBytes}
+	}
+	preview, err := f.readPreview(r, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s preview: %w", f.Name, err)
+	}
+	return preview, nil
+}
+
+// spoolLimitReader fails with ErrPreviewTooLarge once more than remaining bytes were read, where
+// io.LimitReader would end the file early and leave a truncated file to parse.
+type spoolLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *spoolLimitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrPreviewTooLarge
+	}
+	// one byte past the limit tells a file of exactly the limit from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrPreviewTooLarge
+	}
+	return n, err
+}
+
+// spool copies r to a temporary file. The returned function closes and removes it.
+func spool(r io.Reader) (*os.File, int64, func(), error) {
+	file, err := os.CreateTemp("", "report-preview-*")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	size, err := io.Copy(file, r)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("failed to spool report: %w", err)
+	}
+	return file, size, cleanup, nil
+}
+
+func readCsvPreview(r io.Reader, limit int) (*Preview, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return &Preview{Columns: []string{}, Rows: [][]any{}}, nil
+		}
+		return nil, err
+	}
+
+	preview := &Preview{Columns: header, Rows: [][]any{}}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return preview, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(preview.Rows) == limit {
+			preview.HasMore = true
+			return preview, nil
+		}
+		row := make([]any, len(record))
+		for i, value := range record {
+			row[i] = value
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+}
+
+// readObject decodes the next json object, keeping its keys in order.
+func readObject(decoder *json.Decoder) ([]string, []any, error) {
+	if token, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	} else if token != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected an object, got %v", token)
+	}
+
+	var keys []string
+	var values []any
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected an object key, got %v", token)
+		}
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+// readObjectPreview reads rows encoded as json objects until limit rows were read or the decoder has no
+// more values. The columns are the keys of the first object.
+func readObjectPreview(decoder *json.Decoder, limit int) (*Preview, error) {
+	preview := &Preview{Columns: []string{}, Rows: [][]any{}}
+	var columnIndex map[string]int
+	for decoder.More() {
+		if len(preview.Rows) == limit {
+			preview.HasMore = true
+			break
+		}
+
+		keys, values, err := readObject(decoder)
+		if err != nil {
+			return nil, err
+		}
+		if columnIndex == nil {
+			preview.Columns = keys
+			columnIndex = make(map[string]int, len(keys))
+			for i, key := range keys {
+				columnIndex[key] = i
+			}
+		}
+
+		row := make([]any, len(preview.Columns))
+		for i, key := range keys {
+			if index, ok := columnIndex[key]; ok {
+				row[index] = values[i]
+			}
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+	return preview, nil
+}
+
+func readJsonPreview(r io.Reader, limit int) (*Preview, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array, got %v", token)
+	}
+	return readObjectPreview(decoder, limit)
+}
+
+func readNdjsonPreview(r io.Reader, limit int) (*Preview, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return readObjectPreview(decoder, limit)
+}
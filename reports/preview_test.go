@@ -0,0 +1,67 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPreview(t *testing.T) {
+	codec, err := reports.CodecByName("zstd")
+	require.NoError(t, err)
+
+	expected := map[string][][]any{
+		"csv":     {{"Bokoblin", "1", "false"}},
+		"json":    {{"Bokoblin", json.Number("1"), false}},
+		"ndjson":  {{"Bokoblin", json.Number("1"), false}},
+		"xlsx":    {{"Bokoblin", int64(1), false}},
+		"parquet": {{false, int64(1), "Bokoblin"}},
+	}
+
+	for _, name := range reports.FormatNames() {
+		t.Run(name, func(t *testing.T) {
+			format, err := reports.FormatByName(name)
+			require.NoError(t, err)
+
+			var compressed bytes.Buffer
+			writer, err := codec.NewWriter(&compressed, nil)
+			require.NoError(t, err)
+			_, err = writer.Write(writeTestTable(t, name))
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			reader, err := codec.NewReader(&compressed)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			preview, err := format.ReadPreview(reader, 1, 0)
+			require.NoError(t, err)
+			// parquet orders columns by name
+			if name == "parquet" {
+				require.Equal(t, []string{"dlc", "id", "name"}, preview.Columns)
+			} else {
+				require.Equal(t, []string{"name", "id", "dlc"}, preview.Columns)
+			}
+			require.Equal(t, expected[name], preview.Rows)
+			require.True(t, preview.HasMore)
+
+			all, err := format.ReadPreview(bytes.NewReader(writeTestTable(t, name)), 10, 0)
+			require.NoError(t, err)
+			require.Len(t, all.Rows, 2)
+			require.False(t, all.HasMore)
+
+			table := writeTestTable(t, name)
+			_, err = format.ReadPreview(bytes.NewReader(table), 10, int64(len(table)))
+			require.NoError(t, err)
+			_, err = format.ReadPreview(bytes.NewReader(table), 10, int64(len(table))-1)
+			if format.Spooled {
+				require.ErrorIs(t, err, reports.ErrPreviewTooLarge)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"fmt"
+	"slices"
+)
+
+// Priorities of reports. Each has its own queue so the worker can take urgent reports before bulk ones.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+
+	DefaultPriority = PriorityNormal
+)
+
+// Priorities lists the priorities from highest to lowest.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+func ValidatePriority(priority string) error {
+	if !slices.Contains(Priorities, priority) {
+		return fmt.Errorf("priority must be one of %v", Priorities)
+	}
+	return nil
+}
+
+// PriorityAllowed reports whether a user with the role may request reports of the priority. High priority
+// is reserved for the roles in HIGH_PRIORITY_ROLES.
+func PriorityAllowed(config *config.Config, role string, priority string) bool {
+	if priority != PriorityHigh {
+		return true
+	}
+	return slices.Contains(config.HighPriorityRoles, role)
+}
+
+// ValidateQueues checks every priority has a queue of its own. Priorities sharing a queue would be taken in
+// the order they were sent, so high priority reports would wait behind the bulk ones.
+func ValidateQueues(config *config.Config) error {
+	queues := map[string]string{}
+	for _, priority := range Priorities {
+		name := queueName(config, priority)
+		if name == "" {
+			return fmt.Errorf("%s priority reports have no queue, set SQS_QUEUE, SQS_QUEUE_HIGH and SQS_QUEUE_LOW", priority)
+		}
+		if other, ok := queues[name]; ok {
+			return fmt.Errorf("%s and %s priority reports share the queue %s, each priority needs a queue of its own", other, priority, name)
+		}
+		queues[name] = priority
+	}
+	return nil
+}
+
+// queueName is the SQS queue of reports of the priority.
+func queueName(config *config.Config, priority string) string {
+	switch priority {
+	case PriorityHigh:
+		return config.SqsQueueHigh
+	case PriorityLow:
+		return config.SqsQueueLow
+	}
+	return config.SqsQueue
+}
+
+// PollSchedule picks the order the worker polls its priority queues in. Most polls start with the highest
+// priority, but every priority goes first in proportion to its weight, so lower priority reports are
+// still picked up while higher priority ones keep coming. It uses smooth weighted round robin, which
+// spreads the turns of each priority evenly instead of giving them in runs.
+type PollSchedule struct {
+	priorities []string
+	weights    []int
+	current    []int
+	total      int
+}
+
+// NewPollSchedule schedules the priorities, given from highest to lowest. Priorities without a positive
+// weight are only polled after the others.
+func NewPollSchedule(priorities []string, weights map[string]int) *PollSchedule {
+	s := &PollSchedule{
+		priorities: priorities,
+		weights:    make([]int, len(priorities)),
+		current:    make([]int, len(priorities)),
+	}
+	for i, priority := range priorities {
+		s.weights[i] = max(weights[priority], 0)
+		s.total += s.weights[i]
+	}
+	return s
+}
+
+// Next returns every priority, starting with the one whose turn it is followed by the others from highest
+// to lowest.
+func (s *PollSchedule) Next() []string {
+	first := 0
+	if s.total > 0 {
+		for i := range s.priorities {
+			s.current[i] += s.weights[i]
+			if s.current[i] > s.current[first] {
+				first = i
+			}
+		}
+		s.current[first] -= s.total
+	}
+
+	order := make([]string, 0, len(s.priorities))
+	order = append(order, s.priorities[first])
+	for i, priority := range s.priorities {
+		if i != first {
+			order = append(order, priority)
+		}
+	}
+	return order
+}
@@ -0,0 +1,69 @@
+package reports_test
+
+import (
+	"asyncapi/config"
+	"asyncapi/reports"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollSchedule(t *testing.T) {
+	schedule := reports.NewPollSchedule(reports.Priorities, map[string]int{"high": 6, "normal": 3, "low": 1})
+
+	firsts := map[string]int{}
+	sinceLow := 0
+	for range 100 {
+		order := schedule.Next()
+		require.ElementsMatch(t, reports.Priorities, order)
+		firsts[order[0]]++
+
+		// low priority goes first at least once every 10 polls however busy the other queues are
+		if order[0] == reports.PriorityLow {
+			sinceLow = 0
+		} else {
+			sinceLow++
+		}
+		require.Less(t, sinceLow, 10)
+
+		// after the one whose turn it is, queues are polled from highest to lowest
+		rest := []string{}
+		for _, priority := range reports.Priorities {
+			if priority != order[0] {
+				rest = append(rest, priority)
+			}
+		}
+		require.Equal(t, rest, order[1:])
+	}
+	require.Equal(t, map[string]int{"high": 60, "normal": 30, "low": 10}, firsts)
+
+	// without weights the highest priority always goes first
+	schedule = reports.NewPollSchedule(reports.Priorities, nil)
+	for range 3 {
+		require.Equal(t, reports.Priorities, schedule.Next())
+	}
+}
+
+func TestPriorityAllowed(t *testing.T) {
+	conf := &config.Config{HighPriorityRoles: []string{"admin"}}
+
+	require.True(t, reports.PriorityAllowed(conf, "standard", reports.PriorityLow))
+	require.True(t, reports.PriorityAllowed(conf, "standard", reports.PriorityNormal))
+	require.False(t, reports.PriorityAllowed(conf, "standard", reports.PriorityHigh))
+	require.True(t, reports.PriorityAllowed(conf, "admin", reports.PriorityHigh))
+
+	require.NoError(t, reports.ValidatePriority(reports.PriorityHigh))
+	require.Error(t, reports.ValidatePriority("urgent"))
+}
+
+func TestValidateQueues(t *testing.T) {
+	require.NoError(t, reports.ValidateQueues(&config.Config{SqsQueue: "reports", SqsQueueHigh: "reports-high", SqsQueueLow: "reports-low"}))
+
+	// every priority needs a queue
+	require.Error(t, reports.ValidateQueues(&config.Config{SqsQueue: "reports"}))
+	require.Error(t, reports.ValidateQueues(&config.Config{SqsQueue: "reports", SqsQueueHigh: "reports-high"}))
+
+	// and they can't share one
+	require.Error(t, reports.ValidateQueues(&config.Config{SqsQueue: "reports", SqsQueueHigh: "reports", SqsQueueLow: "reports-low"}))
+	require.Error(t, reports.ValidateQueues(&config.Config{SqsQueue: "reports", SqsQueueHigh: "reports-high", SqsQueueLow: "reports-high"}))
+}
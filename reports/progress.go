@@ -0,0 +1,111 @@
+package reports
+
+import (
+	"asyncapi/store"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Phases a report goes through while it is being built.
+const (
+	PhaseFetching  = "fetching"
+	PhaseWriting   = "writing"
+	PhaseUploading = "uploading"
+)
+
+const (
+	// progressUpdateInterval throttles how often row counts are stored while writing.
+	progressUpdateInterval = time.Second
+	// defaultHeartbeatInterval is how often progress is stored when nothing changed and HEARTBEAT_INTERVAL
+	// isn't set, so a report that is still being built can be told apart from one whose worker died.
+	defaultHeartbeatInterval = 10 * time.Second
+)
+
+// progressTracker stores the progress of a report being built and notifies streams about it.
+type progressTracker struct {
+	reportStore *store.ReportStore
+	logger      *slog.Logger
+
+	mu        sync.Mutex
+	progress  store.Report
+	flushedAt time.Time
+}
+
+func newProgressTracker(reportStore *store.ReportStore, logger *slog.Logger, report *store.Report) *progressTracker {
+	return &progressTracker{
+		reportStore: reportStore,
+		logger:      logger,
+		progress: store.Report{
+			Id:     report.Id,
+			UserId: report.UserId,
+		},
+	}
+}
+
+// start sends a heartbeat every interval until the returned function is called.
+func (t *progressTracker) start(ctx context.Context, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.mu.Lock()
+				t.flush(ctx)
+				t.mu.Unlock()
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// setRowsTotal records how many rows the report has once that is known. It is stored with the next update.
+func (t *progressTracker) setRowsTotal(total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.RowsTotal = &total
+}
+
+// setPhase moves the report to the next phase.
+func (t *progressTracker) setPhase(ctx context.Context, phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Phase = &phase
+	t.flush(ctx)
+}
+
+// addRows counts processed rows, storing them at most once per progressUpdateInterval.
+func (t *progressTracker) addRows(ctx context.Context, rows int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.RowsProcessed += rows
+	if time.Since(t.flushedAt) >= progressUpdateInterval {
+		t.flush(ctx)
+	}
+}
+
+// flush must be called with mu held. Errors are only logged since progress is informational.
+func (t *progressTracker) flush(ctx context.Context) {
+	now := time.Now()
+	t.flushedAt = now
+	t.progress.HeartbeatAt = &now
+	report, err := t.reportStore.UpdateProgress(ctx, &t.progress)
+	if err != nil {
+		t.logger.Error("failed to update report progress", "reportId", t.progress.Id, "error", err)
+		return
+	}
+	if err := t.reportStore.PublishEvent(ctx, report); err != nil {
+		t.logger.Error("failed to publish report event", "reportId", report.Id, "error", err)
+	}
+}
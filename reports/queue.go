@@ -0,0 +1,124 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+)
+
+// sqsMaxBatchSize is the most messages SQS accepts in a single SendMessageBatch call.
+const sqsMaxBatchSize = 10
+
+// Queue sends reports to the workers building them.
+type Queue struct {
+	config    *config.Config
+	sqsClient *sqs.Client
+}
+
+func NewQueue(config *config.Config, sqsClient *sqs.Client) *Queue {
+	return &Queue{
+		config:    config,
+		sqsClient: sqsClient,
+	}
+}
+
+func (q *Queue) queueUrl(ctx context.Context, priority string) (*string, error) {
+	name := queueName(q.config, priority)
+	queueUrlOutput, err := q.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url for queue %s: %w", name, err)
+	}
+	return queueUrlOutput.QueueUrl, nil
+}
+
+// Enqueue sends the message to the queue of its priority.
+func (q *Queue) Enqueue(ctx context.Context, message SqsMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message for report %s: %w", message.ReportId, err)
+	}
+
+	queueUrl, err := q.queueUrl(ctx, message.Priority)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    queueUrl,
+		MessageBody: aws.String(string(body)),
+	}); err != nil {
+		return fmt.Errorf("failed to enqueue report %s: %w", message.ReportId, err)
+	}
+
+	return nil
+}
+
+// EnqueueBatch sends the messages to the queues of their priorities in batches of sqsMaxBatchSize. The
+// returned map holds the error of every message that could not be sent, keyed by report id. An error is
+// only returned if a queue is unreachable.
+func (q *Queue) EnqueueBatch(ctx context.Context, messages []SqsMessage) (map[uuid.UUID]error, error) {
+	byQueue := make(map[string][]SqsMessage)
+	for _, message := range messages {
+		name := queueName(q.config, message.Priority)
+		byQueue[name] = append(byQueue[name], message)
+	}
+
+	failed := make(map[uuid.UUID]error)
+	for _, queueMessages := range byQueue {
+		queueUrl, err := q.queueUrl(ctx, queueMessages[0].Priority)
+		if err != nil {
+			return nil, err
+		}
+		q.sendBatches(ctx, queueUrl, queueMessages, failed)
+	}
+
+	return failed, nil
+}
+
+// sendBatches sends the messages to one queue, adding the ones that could not be sent to failed.
+func (q *Queue) sendBatches(ctx context.Context, queueUrl *string, messages []SqsMessage, failed map[uuid.UUID]error) {
+	for chunk := range slices.Chunk(messages, sqsMaxBatchSize) {
+		entries := make([]types.SendMessageBatchRequestEntry, 0, len(chunk))
+		for i, message := range chunk {
+			body, err := json.Marshal(message)
+			if err != nil {
+				failed[message.ReportId] = fmt.Errorf("failed to encode message for report %s: %w", message.ReportId, err)
+				continue
+			}
+			entries = append(entries, types.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(string(body)),
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		output, err := q.sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: queueUrl,
+			Entries:  entries,
+		})
+		if err != nil {
+			for _, entry := range entries {
+				index, _ := strconv.Atoi(*entry.Id)
+				failed[chunk[index].ReportId] = fmt.Errorf("failed to enqueue report %s: %w", chunk[index].ReportId, err)
+			}
+			continue
+		}
+		for _, entry := range output.Failed {
+			index, err := strconv.Atoi(aws.ToString(entry.Id))
+			if err != nil || index >= len(chunk) {
+				continue
+			}
+			failed[chunk[index].ReportId] = fmt.Errorf("failed to enqueue report %s: %s: %s", chunk[index].ReportId, aws.ToString(entry.Code), aws.ToString(entry.Message))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"asyncapi/store"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	staleReportReapInterval  = 30 * time.Second
+	staleReportReapBatchSize = 100
+	staleReportErrorMessage  = "report was abandoned by its worker"
+)
+
+// StaleReportReaper fails reports whose worker stopped storing heartbeats while building them, e.g. because
+// it crashed. Otherwise they would stay in flight forever, and count against their user's quota.
+type StaleReportReaper struct {
+	config        *config.Config
+	reportStore   *store.ReportStore
+	webhookEvents *store.WebhookEventStore
+	logger        *slog.Logger
+}
+
+func NewStaleReportReaper(config *config.Config, reportStore *store.ReportStore, webhookEvents *store.WebhookEventStore, logger *slog.Logger) *StaleReportReaper {
+	return &StaleReportReaper{
+		config:        config,
+		reportStore:   reportStore,
+		webhookEvents: webhookEvents,
+		logger:        logger,
+	}
+}
+
+func (r *StaleReportReaper) Start(ctx context.Context) error {
+	if r.config.StaleReportAfter <= heartbeatInterval(r.config) {
+		return fmt.Errorf("STALE_REPORT_AFTER of %s has to be longer than HEARTBEAT_INTERVAL of %s", r.config.StaleReportAfter, heartbeatInterval(r.config))
+	}
+
+	r.logger.Info("starting stale report reaper", "interval", staleReportReapInterval.String(), "stale_after", r.config.StaleReportAfter.String())
+	ticker := time.NewTicker(staleReportReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("stale report reaper stopped", "error", ctx.Err())
+			return nil
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+func (r *StaleReportReaper) reap(ctx context.Context) {
+	for ctx.Err() == nil {
+		failed, err := r.reportStore.FailStale(ctx, time.Now().Add(-r.config.StaleReportAfter), staleReportErrorMessage, staleReportReapBatchSize)
+		if err != nil {
+			r.logger.Error("failed to fail stale reports", "error", err)
+			return
+		}
+
+		for _, report := range failed {
+			r.logger.Warn("failed stale report", "reportId", report.Id, "userId", report.UserId, "heartbeat_at", report.HeartbeatAt)
+			if err := r.reportStore.PublishEvent(ctx, &report); err != nil {
+				r.logger.Error("failed to publish report event", "reportId", report.Id, "error", err)
+			}
+			event, err := NewWebhookEvent(&report)
+			if err != nil {
+				r.logger.Error("failed to create webhook event", "reportId", report.Id, "error", err)
+				continue
+			}
+			if _, err := r.webhookEvents.Publish(ctx, event); err != nil {
+				r.logger.Error("failed to publish webhook event", "reportId", report.Id, "error", err)
+			}
+		}
+
+		if len(failed) < staleReportReapBatchSize {
+			return
+		}
+	}
+}
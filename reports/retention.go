@@ -0,0 +1,78 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"asyncapi/store"
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	retentionSweepInterval  = time.Minute
+	retentionSweepBatchSize = 100
+)
+
+// RetentionSweeper expires reports that finished longer than their retention ago. Their files are queued
+// for deletion and removed by the ArtifactCleaner, the rows are kept so clients can see what happened.
+type RetentionSweeper struct {
+	config      *config.Config
+	reportStore *store.ReportStore
+	logger      *slog.Logger
+}
+
+func NewRetentionSweeper(config *config.Config, reportStore *store.ReportStore, logger *slog.Logger) *RetentionSweeper {
+	return &RetentionSweeper{
+		config:      config,
+		reportStore: reportStore,
+		logger:      logger,
+	}
+}
+
+func (s *RetentionSweeper) Start(ctx context.Context) error {
+	s.logger.Info("starting retention sweeper", "interval", retentionSweepInterval.String(), "retention", s.config.ReportRetention.String())
+	ticker := time.NewTicker(retentionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("retention sweeper stopped", "error", ctx.Err())
+			return nil
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *RetentionSweeper) sweep(ctx context.Context) {
+	// creations only count against the daily report limit
+	if _, err := s.reportStore.PruneCreations(ctx, time.Now().Add(-24*time.Hour)); err != nil {
+		s.logger.Error("failed to prune report creations", "error", err)
+	}
+	// files no report uses anymore whose reference count was left behind
+	if pruned, err := s.reportStore.PruneArtifacts(ctx); err != nil {
+		s.logger.Error("failed to prune artifacts", "error", err)
+	} else if pruned > 0 {
+		s.logger.Info("pruned artifacts", "count", pruned)
+	}
+
+	for ctx.Err() == nil {
+		expired, err := s.reportStore.Expire(ctx, time.Now(), s.config.ReportRetention, s.config.ReportTypeRetention, retentionSweepBatchSize)
+		if err != nil {
+			s.logger.Error("failed to expire reports", "error", err)
+			return
+		}
+
+		for _, report := range expired {
+			s.logger.Info("expired report", "reportId", report.Id, "userId", report.UserId)
+			if err := s.reportStore.PublishEvent(ctx, &report); err != nil {
+				s.logger.Error("failed to publish report event", "reportId", report.Id, "error", err)
+			}
+		}
+
+		if len(expired) < retentionSweepBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"asyncapi/store"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// CatchUpSkip drops runs missed while no scheduler was running.
+	CatchUpSkip = "skip"
+	// CatchUpRunOnce runs the most recent missed run only.
+	CatchUpRunOnce = "run_once"
+	// CatchUpRunAll runs every missed run, up to maxCatchUpRuns.
+	CatchUpRunAll = "run_all"
+
+	schedulerInterval     = 10 * time.Second
+	schedulerBatchSize    = 25
+	maxCatchUpRuns        = 100
+	missedRunThreshold    = time.Minute
+	enqueueRetryThreshold = time.Minute
+)
+
+var CatchUpPolicies = []string{CatchUpSkip, CatchUpRunOnce, CatchUpRunAll}
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ScheduledRunQuotaCheck applies the quotas of reports created through the api to a scheduled run, which
+// creates one report. Runs over a quota are skipped rather than delayed, the next run tries again.
+func ScheduledRunQuotaCheck(config *config.Config) store.QuotaCheck {
+	return func(usage *store.Usage) error {
+		switch {
+		case config.MaxInFlightReports > 0 && usage.InFlight >= config.MaxInFlightReports:
+			return fmt.Errorf("%w: in_flight_reports %d of %d used", ErrQuotaExceeded, usage.InFlight, config.MaxInFlightReports)
+		case config.MaxReportsPerHour > 0 && usage.CreatedLastHour >= config.MaxReportsPerHour:
+			return fmt.Errorf("%w: reports_last_hour %d of %d used", ErrQuotaExceeded, usage.CreatedLastHour, config.MaxReportsPerHour)
+		case config.MaxReportsPerDay > 0 && usage.CreatedLastDay >= config.MaxReportsPerDay:
+			return fmt.Errorf("%w: reports_last_day %d of %d used", ErrQuotaExceeded, usage.CreatedLastDay, config.MaxReportsPerDay)
+		case config.MaxStoredBytes > 0 && usage.StoredBytes >= config.MaxStoredBytes:
+			return fmt.Errorf("%w: stored_bytes %d of %d used", ErrQuotaExceeded, usage.StoredBytes, config.MaxStoredBytes)
+		}
+		return nil
+	}
+}
+
+func parseSchedule(expression string, timezone string) (cron.Schedule, *time.Location, error) {
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	return schedule, location, nil
+}
+
+// NextScheduleRun returns the first time after the given time the cron expression fires in timezone.
+func NextScheduleRun(expression string, timezone string, after time.Time) (time.Time, error) {
+	schedule, location, err := parseSchedule(expression, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(after.In(location))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", expression)
+	}
+	return next, nil
+}
+
+// PlanScheduleRuns returns the runs to create for a schedule due at nextRunAt and the time it is due next.
+// Runs more than missedRunThreshold older than now were missed, e.g. because no scheduler was running,
+// and are created according to the catch-up policy.
+func PlanScheduleRuns(expression string, timezone string, policy string, nextRunAt time.Time, now time.Time) ([]time.Time, time.Time, error) {
+	schedule, location, err := parseSchedule(expression, timezone)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var due []time.Time
+	next := nextRunAt.In(location)
+	for !next.IsZero() && !next.After(now) {
+		if len(due) < maxCatchUpRuns {
+			due = append(due, next)
+		} else {
+			due = append(due[1:], next)
+		}
+		next = schedule.Next(next)
+	}
+	if next.IsZero() {
+		return nil, time.Time{}, fmt.Errorf("cron expression %q never fires", expression)
+	}
+	if len(due) == 0 {
+		return nil, next, nil
+	}
+
+	latest := due[len(due)-1]
+	switch policy {
+	case CatchUpSkip:
+		if now.Sub(latest) > missedRunThreshold {
+			return nil, next, nil
+		}
+		return []time.Time{latest}, next, nil
+	case CatchUpRunOnce:
+		return []time.Time{latest}, next, nil
+	case CatchUpRunAll:
+		return due, next, nil
+	}
+	return nil, time.Time{}, fmt.Errorf("unknown catch-up policy %q", policy)
+}
+
+// Scheduler creates the reports of due schedules and queues them. Any number of schedulers can run
+// at once, the schedule store makes sure every run is only created by one of them.
+type Scheduler struct {
+	config    *config.Config
+	schedules *store.ReportScheduleStore
+	queue     *Queue
+	logger    *slog.Logger
+}
+
+func NewScheduler(config *config.Config, schedules *store.ReportScheduleStore, queue *Queue, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		config:    config,
+		schedules: schedules,
+		queue:     queue,
+		logger:    logger,
+	}
+}
+
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.logger.Info("starting report scheduler", "interval", schedulerInterval.String())
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("report scheduler stopped", "error", ctx.Err())
+			return nil
+		case <-ticker.C:
+			s.runDue(ctx)
+			s.retryEnqueue(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	runs, err := s.schedules.RunDue(ctx, time.Now(), schedulerBatchSize, func(schedule *store.ReportSchedule) ([]time.Time, time.Time, error) {
+		runs, nextRunAt, err := PlanScheduleRuns(schedule.CronExpression, schedule.Timezone, schedule.CatchUpPolicy, schedule.NextRunAt, time.Now())
+		if err != nil {
+			s.logger.Error("disabling report schedule", "schedule_id", schedule.Id, "error", err)
+		}
+		return runs, nextRunAt, err
+	}, ScheduledRunQuotaCheck(s.config))
+	if err != nil {
+		s.logger.Error("failed to run due report schedules", "error", err)
+		return
+	}
+
+	for _, run := range runs {
+		s.enqueue(ctx, run)
+	}
+}
+
+// retryEnqueue queues reports of runs that were created but never queued, e.g. because the queue was
+// unavailable. The builder ignores reports that were already started, so a report queued twice is harmless.
+func (s *Scheduler) retryEnqueue(ctx context.Context) {
+	runs, err := s.schedules.NotEnqueuedRuns(ctx, time.Now().Add(-enqueueRetryThreshold), schedulerBatchSize)
+	if err != nil {
+		s.logger.Error("failed to query schedule runs not enqueued", "error", err)
+		return
+	}
+
+	for _, run := range runs {
+		s.enqueue(ctx, run)
+	}
+}
+
+func (s *Scheduler) enqueue(ctx context.Context, run store.ScheduleRun) {
+	if err := s.queue.Enqueue(ctx, SqsMessage{UserId: run.UserId, ReportId: *run.ReportId}); err != nil {
+		s.logger.Error("failed to enqueue scheduled report", "schedule_id", run.ScheduleId, "report_id", run.ReportId, "error", err)
+		return
+	}
+	if err := s.schedules.MarkEnqueued(ctx, run.ScheduleId, run.ScheduledFor); err != nil {
+		s.logger.Error("failed to mark schedule run as enqueued", "schedule_id", run.ScheduleId, "error", err)
+		return
+	}
+	s.logger.Info("enqueued scheduled report", "schedule_id", run.ScheduleId, "report_id", run.ReportId, "scheduled_for", run.ScheduledFor)
+}
@@ -0,0 +1,95 @@
+package reports_test
+
+import (
+	"asyncapi/config"
+	"asyncapi/reports"
+	"asyncapi/store"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextScheduleRun(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// a Sunday evening in Berlin
+	after := time.Date(2024, time.March, 3, 20, 0, 0, 0, berlin)
+	next, err := reports.NextScheduleRun("0 8 * * MON", "Europe/Berlin", after)
+	require.NoError(t, err)
+	require.True(t, next.Equal(time.Date(2024, time.March, 4, 8, 0, 0, 0, berlin)))
+
+	_, err = reports.NextScheduleRun("not a cron", "UTC", after)
+	require.Error(t, err)
+
+	_, err = reports.NextScheduleRun("0 8 * * MON", "Mars/Olympus_Mons", after)
+	require.Error(t, err)
+}
+
+func TestPlanScheduleRuns(t *testing.T) {
+	hourly := "0 * * * *"
+	nextRunAt := time.Date(2024, time.March, 4, 8, 0, 0, 0, time.UTC)
+
+	t.Run("on time", func(t *testing.T) {
+		now := nextRunAt.Add(5 * time.Second)
+		for _, policy := range reports.CatchUpPolicies {
+			runs, next, err := reports.PlanScheduleRuns(hourly, "UTC", policy, nextRunAt, now)
+			require.NoError(t, err)
+			require.Len(t, runs, 1)
+			require.True(t, runs[0].Equal(nextRunAt))
+			require.True(t, next.Equal(nextRunAt.Add(time.Hour)))
+		}
+	})
+
+	t.Run("not due", func(t *testing.T) {
+		runs, next, err := reports.PlanScheduleRuns(hourly, "UTC", reports.CatchUpRunAll, nextRunAt, nextRunAt.Add(-time.Minute))
+		require.NoError(t, err)
+		require.Empty(t, runs)
+		require.True(t, next.Equal(nextRunAt))
+	})
+
+	// the scheduler was down from before 08:00 until 10:30
+	now := nextRunAt.Add(150 * time.Minute)
+	expectedNext := nextRunAt.Add(3 * time.Hour)
+
+	t.Run("skip", func(t *testing.T) {
+		runs, next, err := reports.PlanScheduleRuns(hourly, "UTC", reports.CatchUpSkip, nextRunAt, now)
+		require.NoError(t, err)
+		require.Empty(t, runs)
+		require.True(t, next.Equal(expectedNext))
+	})
+
+	t.Run("run once", func(t *testing.T) {
+		runs, next, err := reports.PlanScheduleRuns(hourly, "UTC", reports.CatchUpRunOnce, nextRunAt, now)
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		require.True(t, runs[0].Equal(nextRunAt.Add(2*time.Hour)))
+		require.True(t, next.Equal(expectedNext))
+	})
+
+	t.Run("run all", func(t *testing.T) {
+		runs, next, err := reports.PlanScheduleRuns(hourly, "UTC", reports.CatchUpRunAll, nextRunAt, now)
+		require.NoError(t, err)
+		require.Len(t, runs, 3)
+		for i, run := range runs {
+			require.True(t, run.Equal(nextRunAt.Add(time.Duration(i)*time.Hour)))
+		}
+		require.True(t, next.Equal(expectedNext))
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		_, _, err := reports.PlanScheduleRuns(hourly, "UTC", "sometimes", nextRunAt, now)
+		require.Error(t, err)
+	})
+}
+
+func TestScheduledRunQuotaCheck(t *testing.T) {
+	check := reports.ScheduledRunQuotaCheck(&config.Config{MaxInFlightReports: 2, MaxReportsPerHour: 5})
+
+	require.NoError(t, check(&store.Usage{InFlight: 1, CreatedLastHour: 4, CreatedLastDay: 100}))
+	require.ErrorIs(t, check(&store.Usage{InFlight: 2}), reports.ErrQuotaExceeded)
+	err := check(&store.Usage{CreatedLastHour: 5})
+	require.ErrorIs(t, err, reports.ErrQuotaExceeded)
+	require.Contains(t, err.Error(), "reports_last_hour")
+}
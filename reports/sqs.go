@@ -5,4 +5,6 @@ import "github.com/google/uuid"
 type SqsMessage struct {
 	UserId   uuid.UUID `json:"userId"`
 	ReportId uuid.UUID `json:"reportId"`
+	// Priority picks the queue the message is sent to, empty is DefaultPriority
+	Priority string `json:"priority,omitempty"`
 }
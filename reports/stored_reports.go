@@ -0,0 +1,65 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"asyncapi/store"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// StoredReports reads the files of completed reports back from storage, for generators that build on
+// earlier reports.
+type StoredReports struct {
+	config      *config.Config
+	reportStore *store.ReportStore
+	s3Client    *s3.Client
+}
+
+func NewStoredReports(config *config.Config, reportStore *store.ReportStore, s3Client *s3.Client) *StoredReports {
+	return &StoredReports{
+		config:      config,
+		reportStore: reportStore,
+		s3Client:    s3Client,
+	}
+}
+
+// Read parses up to limit rows of one of the user's completed reports.
+func (s *StoredReports) Read(ctx context.Context, userId uuid.UUID, reportId uuid.UUID, limit int) (*Preview, error) {
+	report, err := s.reportStore.ByPrimaryKey(ctx, userId, reportId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report %s: %w", reportId, err)
+	}
+	if report.OutputFilePath == nil || report.CompletedAt == nil {
+		return nil, fmt.Errorf("report %s is %s and has no file", reportId, report.Status())
+	}
+
+	format, err := FormatByName(report.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := CodecByName(report.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.S3Bucket),
+		Key:    report.OutputFilePath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file of report %s: %w", reportId, err)
+	}
+	defer output.Body.Close()
+
+	reader, err := codec.NewReader(output.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return format.ReadPreview(reader, limit, s.config.MaxPreviewSpoolBytes)
+}
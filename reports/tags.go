@@ -0,0 +1,38 @@
+package reports
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	MaxTags      = 20
+	MaxTagLength = 64
+)
+
+// NormalizeTags trims and lowercases tags and drops duplicates, keeping the first occurrence of each, so
+// that tags differing only in case or surrounding spaces are the same tag.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, fmt.Errorf("tags can't be empty")
+		}
+		if len([]rune(tag)) > MaxTagLength {
+			return nil, fmt.Errorf("tags can be at most %d characters", MaxTagLength)
+		}
+		if strings.IndexFunc(tag, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("tag %q contains control characters", tag)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("a report can have at most %d tags", MaxTags)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,39 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := reports.NormalizeTags([]string{" Finance ", "q3", "finance", "Q3", "monthly"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"finance", "q3", "monthly"}, tags)
+
+	tags, err = reports.NormalizeTags(nil)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	_, err = reports.NormalizeTags([]string{"finance", "  "})
+	require.Error(t, err)
+
+	_, err = reports.NormalizeTags([]string{strings.Repeat("a", reports.MaxTagLength+1)})
+	require.Error(t, err)
+
+	_, err = reports.NormalizeTags([]string{"tab\tbed"})
+	require.Error(t, err)
+
+	many := make([]string, 0, reports.MaxTags+1)
+	for i := range reports.MaxTags + 1 {
+		many = append(many, strings.Repeat("t", i+1))
+	}
+	_, err = reports.NormalizeTags(many)
+	require.Error(t, err)
+
+	// duplicates don't count against the limit
+	_, err = reports.NormalizeTags(append(many[:reports.MaxTags], "T"))
+	require.NoError(t, err)
+}
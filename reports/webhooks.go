@@ -0,0 +1,357 @@
+package reports
+
+import (
+	"asyncapi/config"
+	"asyncapi/store"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookReportCompleted = "report.completed"
+	WebhookReportFailed    = "report.failed"
+
+	WebhookIdHeader        = "Webhook-Id"
+	WebhookSignatureHeader = "Webhook-Signature"
+	// receivers should reject signatures older than this to prevent replays
+	WebhookSignatureTolerance = 5 * time.Minute
+
+	webhookDispatchInterval  = 5 * time.Second
+	webhookDispatchBatchSize = 25
+	webhookDeliveryLease     = time.Minute
+	webhookDeliveryTimeout   = 10 * time.Second
+	webhookDeliveryBackoff   = 30 * time.Second
+	webhookDeliveryMaxDelay  = 6 * time.Hour
+	webhookMaxAttempts       = 8
+	webhookResolveTimeout    = 5 * time.Second
+)
+
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrInternalWebhookAddress  = errors.New("webhook address is not publicly routable")
+)
+
+type WebhookPayload struct {
+	Id        uuid.UUID     `json:"id"`
+	Type      string        `json:"type"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      WebhookReport `json:"data"`
+}
+
+type WebhookReport struct {
+	Id           uuid.UUID  `json:"id"`
+	ReportType   string     `json:"report_type"`
+	Status       string     `json:"status"`
+	OutputFormat string     `json:"output_format"`
+	Compression  string     `json:"compression"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	FailedAt     *time.Time `json:"failed_at,omitempty"`
+}
+
+// NewWebhookEvent builds the event announcing that a report finished, either completed or failed.
+func NewWebhookEvent(report *store.Report) (*store.WebhookEvent, error) {
+	eventType := WebhookReportCompleted
+	if report.FailedAt != nil {
+		eventType = WebhookReportFailed
+	}
+
+	payload := WebhookPayload{
+		Id:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data: WebhookReport{
+			Id:           report.Id,
+			ReportType:   report.ReportType,
+			Status:       report.Status(),
+			OutputFormat: report.OutputFormat,
+			Compression:  report.Compression,
+			ErrorMessage: report.ErrorMessage,
+			CreatedAt:    report.CreatedAt,
+			CompletedAt:  report.CompletedAt,
+			FailedAt:     report.FailedAt,
+		},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	return &store.WebhookEvent{
+		Id:          payload.Id,
+		UserId:      report.UserId,
+		ReportId:    report.Id,
+		EventType:   eventType,
+		Payload:     body,
+		CallbackUrl: report.CallbackUrl,
+	}, nil
+}
+
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// CallbackSecret derives the secret used to sign deliveries to a report's callback url, so every user
+// gets their own secret without one having to be stored.
+func CallbackSecret(signingKey string, userId uuid.UUID) string {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(userId.String()))
+	return "whsec_" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateWebhookUrl checks that a url is an absolute http or https url whose host doesn't resolve to a
+// loopback, private, link-local or unspecified address, so users can't have the worker call internal services.
+func ValidateWebhookUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", rawUrl, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be an absolute http or https url", rawUrl)
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if isInternalIp(ip) {
+			return fmt.Errorf("url %q: %w", rawUrl, ErrInternalWebhookAddress)
+		}
+		return nil
+	}
+	if host = strings.ToLower(strings.TrimSuffix(host, ".")); host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("url %q: %w", rawUrl, ErrInternalWebhookAddress)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("url %q: failed to resolve host", rawUrl)
+	}
+	for _, addr := range addrs {
+		if isInternalIp(addr.IP) {
+			return fmt.Errorf("url %q: %w", rawUrl, ErrInternalWebhookAddress)
+		}
+	}
+	return nil
+}
+
+func isInternalIp(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// NewWebhookHttpClient returns the client deliveries are sent with. Addresses are checked again when
+// connecting, as a host that was public when the url was registered can later resolve to an internal one.
+func NewWebhookHttpClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIp(ip) {
+				return fmt.Errorf("dial %s: %w", address, ErrInternalWebhookAddress)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy would make the dialer check the proxy's address instead of the receiver's
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+func webhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignWebhook returns the Webhook-Signature header for a body sent at the given time. The timestamp is part
+// of the signed content so receivers can reject old deliveries being replayed.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	unix := timestamp.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", unix, webhookSignature(secret, unix, body))
+}
+
+// VerifyWebhookSignature checks a Webhook-Signature header against the body and rejects signatures
+// made more than tolerance away from now.
+func VerifyWebhookSignature(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid timestamp", ErrInvalidWebhookSignature)
+			}
+			timestamp = parsed
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return fmt.Errorf("%w: missing timestamp or signature", ErrInvalidWebhookSignature)
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp outside of tolerance", ErrInvalidWebhookSignature)
+	}
+
+	expected := webhookSignature(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidWebhookSignature
+}
+
+type WebhookClient struct {
+	httpClient HttpClient
+}
+
+func NewWebhookClient(httpClient HttpClient) *WebhookClient {
+	return &WebhookClient{httpClient: httpClient}
+}
+
+// Send posts a signed event body to url and returns the response status.
+func (c *WebhookClient) Send(ctx context.Context, url string, eventId uuid.UUID, secret string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIdHeader, eventId.String())
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, time.Now(), body))
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("webhook receiver responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// WebhookDispatcher sends queued webhook deliveries. Failed deliveries are retried with exponential
+// backoff until they succeed or run out of attempts.
+type WebhookDispatcher struct {
+	config *config.Config
+	events *store.WebhookEventStore
+	client *WebhookClient
+	logger *slog.Logger
+}
+
+func NewWebhookDispatcher(config *config.Config, events *store.WebhookEventStore, client *WebhookClient, logger *slog.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		config: config,
+		events: events,
+		client: client,
+		logger: logger,
+	}
+}
+
+func (d *WebhookDispatcher) Start(ctx context.Context) error {
+	d.logger.Info("starting webhook dispatcher", "interval", webhookDispatchInterval.String())
+	ticker := time.NewTicker(webhookDispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("webhook dispatcher stopped", "error", ctx.Err())
+			return nil
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) dispatch(ctx context.Context) {
+	deliveries, err := d.events.ClaimDeliveries(ctx, webhookDispatchBatchSize, time.Now().Add(webhookDeliveryLease))
+	if err != nil {
+		d.logger.Error("failed to claim webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		secret := CallbackSecret(d.config.WebhookSigningKey, delivery.UserId)
+		if delivery.EndpointSecret != nil {
+			secret = *delivery.EndpointSecret
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, webhookDeliveryTimeout)
+		responseStatus, err := d.client.Send(sendCtx, delivery.Url, delivery.EventId, secret, delivery.Payload)
+		cancel()
+
+		var status *int
+		if responseStatus != 0 {
+			status = &responseStatus
+		}
+
+		if err == nil {
+			if err := d.events.RecordAttempt(ctx, delivery.Id, store.WebhookDeliverySucceeded, status, nil, time.Now()); err != nil {
+				d.logger.Error("failed to record webhook delivery", "error", err)
+			}
+			d.logger.Info("delivered webhook", "delivery_id", delivery.Id, "event_id", delivery.EventId, "url", delivery.Url)
+			continue
+		}
+
+		errMsg := err.Error()
+		deliveryStatus := store.WebhookDeliveryPending
+		nextAttemptAt := time.Now().Add(backoffDelay(webhookDeliveryBackoff, webhookDeliveryMaxDelay, delivery.Attempts))
+		if delivery.Attempts >= webhookMaxAttempts {
+			deliveryStatus = store.WebhookDeliveryFailed
+		}
+		d.logger.Warn("failed to deliver webhook", "delivery_id", delivery.Id, "url", delivery.Url, "attempts", delivery.Attempts, "status", deliveryStatus, "error", err)
+		if err := d.events.RecordAttempt(ctx, delivery.Id, deliveryStatus, status, &errMsg, nextAttemptAt); err != nil {
+			d.logger.Error("failed to record webhook delivery failure", "error", err)
+		}
+	}
+}
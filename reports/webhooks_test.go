@@ -0,0 +1,114 @@
+package reports_test
+
+import (
+	"asyncapi/reports"
+	"asyncapi/store"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"type":"report.completed"}`)
+	now := time.Now()
+	header := reports.SignWebhook("whsec_test", now, body)
+
+	require.NoError(t, reports.VerifyWebhookSignature("whsec_test", header, body, reports.WebhookSignatureTolerance, now))
+	require.ErrorIs(t, reports.VerifyWebhookSignature("whsec_other", header, body, reports.WebhookSignatureTolerance, now), reports.ErrInvalidWebhookSignature)
+	require.ErrorIs(t, reports.VerifyWebhookSignature("whsec_test", header, []byte(`{}`), reports.WebhookSignatureTolerance, now), reports.ErrInvalidWebhookSignature)
+	require.ErrorIs(t, reports.VerifyWebhookSignature("whsec_test", header, body, reports.WebhookSignatureTolerance, now.Add(10*time.Minute)), reports.ErrInvalidWebhookSignature)
+	require.ErrorIs(t, reports.VerifyWebhookSignature("whsec_test", "v1=abc", body, reports.WebhookSignatureTolerance, now), reports.ErrInvalidWebhookSignature)
+}
+
+func TestWebhookClient(t *testing.T) {
+	completedAt := time.Now()
+	event, err := reports.NewWebhookEvent(&store.Report{
+		UserId:       uuid.New(),
+		Id:           uuid.New(),
+		ReportType:   "monsters",
+		OutputFormat: "csv",
+		Compression:  "gzip",
+		StartedAt:    &completedAt,
+		CompletedAt:  &completedAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, reports.WebhookReportCompleted, event.EventType)
+
+	received := make(chan reports.WebhookPayload, 1)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, event.Id.String(), r.Header.Get(reports.WebhookIdHeader))
+		if err := reports.VerifyWebhookSignature("whsec_test", r.Header.Get(reports.WebhookSignatureHeader), body, reports.WebhookSignatureTolerance, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var payload reports.WebhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		received <- payload
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client := reports.NewWebhookClient(server.Client())
+	responseStatus, err := client.Send(context.Background(), server.URL, event.Id, "whsec_test", event.Payload)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, responseStatus)
+
+	payload := <-received
+	require.Equal(t, event.Id, payload.Id)
+	require.Equal(t, reports.WebhookReportCompleted, payload.Type)
+	require.Equal(t, event.ReportId, payload.Data.Id)
+	require.Equal(t, "completed", payload.Data.Status)
+
+	responseStatus, err = client.Send(context.Background(), server.URL, event.Id, "whsec_wrong", event.Payload)
+	require.Error(t, err)
+	require.Equal(t, http.StatusUnauthorized, responseStatus)
+
+	status = http.StatusInternalServerError
+	responseStatus, err = client.Send(context.Background(), server.URL, event.Id, "whsec_test", event.Payload)
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, responseStatus)
+	<-received
+}
+
+func TestValidateWebhookUrl(t *testing.T) {
+	require.NoError(t, reports.ValidateWebhookUrl("https://93.184.216.34/hooks"))
+	require.Error(t, reports.ValidateWebhookUrl("ftp://93.184.216.34/hooks"))
+	require.Error(t, reports.ValidateWebhookUrl("/hooks"))
+
+	for _, internal := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://10.0.0.1/hooks",
+		"http://192.168.1.10/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hooks",
+		"http://[::1]/hooks",
+		"http://[fe80::1]/hooks",
+		"http://localhost:8080/hooks",
+		"http://api.localhost/hooks",
+	} {
+		require.ErrorIs(t, reports.ValidateWebhookUrl(internal), reports.ErrInternalWebhookAddress, internal)
+	}
+}
+
+func TestWebhookHttpClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := reports.NewWebhookClient(reports.NewWebhookHttpClient(time.Second))
+	responseStatus, err := client.Send(context.Background(), server.URL, uuid.New(), "whsec_test", []byte(`{}`))
+	require.ErrorIs(t, err, reports.ErrInternalWebhookAddress)
+	require.Zero(t, responseStatus)
+}
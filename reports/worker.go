@@ -3,7 +3,9 @@ package reports
 import (
 	"asyncapi/config"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -13,12 +15,29 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
+// idlePollWaitSeconds is how long the worker long polls the highest priority queue once every queue was
+// found empty. The other queues are short polled so an empty queue never holds up the next one.
+const idlePollWaitSeconds = 1
+
+// receiveBackoff is how long the worker waits after a poll that received nothing because SQS failed. It
+// doubles with every failed poll in a row, up to receiveMaxDelay.
+const (
+	receiveBackoff  = time.Second
+	receiveMaxDelay = time.Minute
+)
+
+type receivedMessage struct {
+	queueUrl *string
+	message  types.Message
+}
+
 type Worker struct {
 	config      *config.Config
 	builder     *ReportBuilder
 	logger      *slog.Logger
 	sqsClient   *sqs.Client
-	channel     chan types.Message
+	channel     chan receivedMessage
+	slots       chan struct{}
 	concurrency int
 }
 
@@ -28,20 +47,37 @@ func NewWorker(config *config.Config, logger *slog.Logger, builder *ReportBuilde
 		logger:      logger,
 		builder:     builder,
 		sqsClient:   sqsClient,
-		channel:     make(chan types.Message, maxConcurrency),
+		channel:     make(chan receivedMessage, maxConcurrency),
+		slots:       make(chan struct{}, maxConcurrency),
 		concurrency: maxConcurrency,
 	}
 }
 
+// Start consumes the queues of every priority. Messages are only received for idle goroutines, so a
+// high priority report never waits behind lower priority messages the worker is holding, and the queues
+// are polled in the order of a PollSchedule so low priority reports keep being built under load.
 func (w *Worker) Start(ctx context.Context) error {
-	queueUrlOutput, err := w.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
-		QueueName: aws.String(w.config.SqsQueue),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get url for queue %s: %w", w.config.SqsQueue, err)
+	if err := ValidateQueues(w.config); err != nil {
+		return err
+	}
+	if w.config.BuildTimeout > 0 && w.config.BuildTimeout <= heartbeatInterval(w.config) {
+		return fmt.Errorf("BUILD_TIMEOUT of %s has to be longer than HEARTBEAT_INTERVAL of %s", w.config.BuildTimeout, heartbeatInterval(w.config))
+	}
+
+	queueUrls := make(map[string]*string, len(Priorities))
+	for _, priority := range Priorities {
+		name := queueName(w.config, priority)
+		queueUrlOutput, err := w.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+			QueueName: aws.String(name),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get url for queue %s: %w", name, err)
+		}
+		queueUrls[priority] = queueUrlOutput.QueueUrl
+		w.logger.Info("consuming queue", "priority", priority, "queue", name, "queue_url", queueUrlOutput.QueueUrl)
 	}
 
-	w.logger.Info("starting worker", "queue", w.config.SqsQueue, "queue_url", queueUrlOutput.QueueUrl)
+	w.logger.Info("starting worker", "concurrency", w.concurrency, "priority_weights", w.config.PriorityWeights)
 	for i := 0; i < w.concurrency; i++ {
 		go func(id int) {
 			w.logger.Info(fmt.Sprintf("starting goroutine #%d", id))
@@ -50,44 +86,124 @@ func (w *Worker) Start(ctx context.Context) error {
 				case <-ctx.Done():
 					w.logger.Error("worker stopped", "goroutine_id", id, "error", ctx.Err())
 					return
-				case message := <-w.channel:
-					if err := w.processMessage(ctx, message); err != nil {
-						w.logger.Error("failed to process message", "error", err, "goroutine_id", id)
-						continue
-					}
-
-					if _, err = w.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-						QueueUrl:      queueUrlOutput.QueueUrl,
-						ReceiptHandle: message.ReceiptHandle,
-					}); err != nil {
-						w.logger.Error("failed to delete message", "error", err, "goroutine_id", id)
-					}
+				case received := <-w.channel:
+					w.handleMessage(ctx, id, received)
+					<-w.slots
 				}
 			}
 		}(i)
 	}
 
+	schedule := NewPollSchedule(Priorities, w.config.PriorityWeights)
+	failedPolls := 0
 	for {
-		output, err := w.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			QueueUrl:            queueUrlOutput.QueueUrl,
-			MaxNumberOfMessages: int32(w.concurrency + 1),
-		})
+		free, err := w.acquireSlots(ctx)
 		if err != nil {
-			w.logger.Error("failed to receive message", "error", err)
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
+			return err
+		}
+
+		messages, err := w.receive(ctx, schedule.Next(), queueUrls, free)
+		for range free - len(messages) {
+			<-w.slots
+		}
+		for _, message := range messages {
+			w.channel <- message
 		}
 
-		if len(output.Messages) == 0 {
+		if err == nil || len(messages) > 0 {
+			failedPolls = 0
 			continue
 		}
+		failedPolls++
+		delay := backoffDelay(receiveBackoff, receiveMaxDelay, failedPolls)
+		w.logger.Error("failed to receive messages, backing off", "failed_polls", failedPolls, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
 
-		for _, message := range output.Messages {
-			w.channel <- message
+// acquireSlots waits for an idle goroutine and returns how many are idle, up to the most messages SQS
+// returns at once. The slots are released as the goroutines finish their messages.
+func (w *Worker) acquireSlots(ctx context.Context) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case w.slots <- struct{}{}:
+	}
+
+	acquired := 1
+	for acquired < sqsMaxBatchSize {
+		select {
+		case w.slots <- struct{}{}:
+			acquired++
+		default:
+			return acquired, nil
 		}
 	}
+	return acquired, nil
+}
 
+// receive polls the queues of the priorities in order until it has n messages. It returns the errors of
+// the polls that failed along with whatever the others received.
+func (w *Worker) receive(ctx context.Context, order []string, queueUrls map[string]*string, n int) ([]receivedMessage, error) {
+	var received []receivedMessage
+	var errs []error
+	for _, priority := range order {
+		messages, err := w.receiveFrom(ctx, queueUrls[priority], n-len(received), 0)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		received = append(received, messages...)
+		if len(received) == n {
+			return received, nil
+		}
+	}
+
+	if len(received) == 0 {
+		messages, err := w.receiveFrom(ctx, queueUrls[Priorities[0]], n, idlePollWaitSeconds)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		received = messages
+	}
+	return received, errors.Join(errs...)
+}
+
+func (w *Worker) receiveFrom(ctx context.Context, queueUrl *string, n int, waitSeconds int32) ([]receivedMessage, error) {
+	output, err := w.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            queueUrl,
+		MaxNumberOfMessages: int32(n),
+		WaitTimeSeconds:     waitSeconds,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to receive from %s: %w", *queueUrl, err)
+	}
+
+	received := make([]receivedMessage, 0, len(output.Messages))
+	for _, message := range output.Messages {
+		received = append(received, receivedMessage{queueUrl: queueUrl, message: message})
+	}
+	return received, nil
+}
+
+func (w *Worker) handleMessage(ctx context.Context, id int, received receivedMessage) {
+	if err := w.processMessage(ctx, received.message); err != nil {
+		w.logger.Error("failed to process message", "error", err, "goroutine_id", id)
+		return
+	}
+
+	if _, err := w.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      received.queueUrl,
+		ReceiptHandle: received.message.ReceiptHandle,
+	}); err != nil {
+		w.logger.Error("failed to delete message", "error", err, "goroutine_id", id)
+	}
 }
 
 func (w *Worker) processMessage(ctx context.Context, message types.Message) error {
@@ -104,9 +220,19 @@ func (w *Worker) processMessage(ctx context.Context, message types.Message) erro
 		return nil
 	}
 
-	builderCtx, builderCancel := context.WithTimeout(ctx, time.Second*10)
-	defer builderCancel()
+	// the timeout is well above the heartbeat interval, builds that outlive their worker are failed by the
+	// StaleReportReaper instead
+	builderCtx := ctx
+	if w.config.BuildTimeout > 0 {
+		var builderCancel context.CancelFunc
+		builderCtx, builderCancel = context.WithTimeout(ctx, w.config.BuildTimeout)
+		defer builderCancel()
+	}
 	_, err := w.builder.Build(builderCtx, msg.UserId, msg.ReportId)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.logger.Warn("report no longer exists", "message_id", *message.MessageId, "report_id", msg.ReportId)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to build report: %w", err)
 	}
@@ -0,0 +1,73 @@
+package schema_test
+
+import (
+	"asyncapi/schema"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type embedded struct {
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type example struct {
+	embedded
+	Id         uuid.UUID         `json:"id"`
+	Name       string            `json:"name" description:"display name"`
+	Order      string            `json:"order,omitempty" enum:"asc,desc"`
+	Count      *int              `json:"count"`
+	Tags       []string          `json:"tags,omitempty"`
+	Labels     map[string]bool   `json:"labels,omitempty"`
+	Parameters json.RawMessage   `json:"parameters,omitempty"`
+	Ignored    string            `json:"-"`
+	Nested     *struct{ A bool } `json:"nested,omitempty"`
+}
+
+func TestFor(t *testing.T) {
+	s := schema.For[example]()
+	require.Equal(t, "object", s.Type)
+	require.ElementsMatch(t, []string{"created_at", "id", "name"}, s.Required)
+
+	require.Equal(t, &schema.Schema{Type: "string", Format: "date-time"}, s.Properties["created_at"])
+	require.Equal(t, &schema.Schema{Type: "string", Format: "uuid"}, s.Properties["id"])
+	require.Equal(t, &schema.Schema{Type: "string", Description: "display name"}, s.Properties["name"])
+	require.Equal(t, []string{"asc", "desc"}, s.Properties["order"].Enum)
+	require.Equal(t, "integer", s.Properties["count"].Type)
+	require.Equal(t, &schema.Schema{Type: "array", Items: &schema.Schema{Type: "string"}}, s.Properties["tags"])
+	require.Equal(t, &schema.Schema{Type: "boolean"}, s.Properties["labels"].AdditionalProperties)
+	require.Equal(t, &schema.Schema{}, s.Properties["parameters"])
+	require.Equal(t, "boolean", s.Properties["nested"].Properties["A"].Type)
+	require.NotContains(t, s.Properties, "Ignored")
+}
+
+func TestValidate(t *testing.T) {
+	s := schema.For[example]()
+
+	// the required fields, followed by the ones a case adds
+	required := `"created_at": "2024-01-02T15:04:05Z", "id": "` + uuid.NewString() + `", "name": "x"`
+
+	valid := `{` + required + `, "count": null, "order": "asc", "tags": ["a"], "labels": {"a": true},
+		"parameters": {"anything": [1]}, "unknown": 1}`
+	require.NoError(t, s.Validate([]byte(valid)))
+
+	for document, message := range map[string]string{
+		`[]`: "body must be an object",
+		`{"id": "` + uuid.NewString() + `", "name": "x"}`:                            "body.created_at is required",
+		`{"created_at": "yesterday", "id": "` + uuid.NewString() + `", "name": "x"}`: "body.created_at must be an RFC 3339 date-time",
+		`{"created_at": "2024-01-02T15:04:05Z", "id": "1", "name": "x"}`:             "body.id must be a uuid",
+		`{` + required + `, "name": null}`:                                           "body.name is required",
+		`{` + required + `, "count": 1.5}`:                                           "body.count must be an integer",
+		`{` + required + `, "order": "up"}`:                                          "body.order must be one of [asc desc]",
+		`{` + required + `, "tags": ["a", 1]}`:                                       "body.tags[1] must be a string",
+		`{` + required + `, "labels": {"a": "yes"}}`:                                 "body.labels.a must be a boolean",
+		`{` + required + `, "nested": {"A": 1}}`:                                     "body.nested.A must be a boolean",
+	} {
+		require.EqualError(t, s.Validate([]byte(document)), message, document)
+	}
+
+	require.ErrorContains(t, s.Validate([]byte(`{`)), "invalid json")
+}
@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Validate checks a json document against the schema. Properties the schema doesn't list are allowed, as
+// encoding/json ignores them, and a null property counts as missing.
+func (s *Schema) Validate(document []byte) error {
+	var value any
+	if err := json.Unmarshal(document, &value); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	return s.validate("body", value)
+}
+
+func (s *Schema) validate(path string, value any) error {
+	if len(s.Enum) > 0 {
+		if str, ok := value.(string); !ok || !slices.Contains(s.Enum, str) {
+			return fmt.Errorf("%s must be one of %v", path, s.Enum)
+		}
+	}
+
+	switch s.Type {
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+		return s.validateFormat(path, str)
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		for i, item := range items {
+			if item == nil || s.Items == nil {
+				continue
+			}
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		return s.validateObject(path, object)
+	}
+	return nil
+}
+
+func (s *Schema) validateFormat(path string, str string) error {
+	switch s.Format {
+	case "uuid":
+		if _, err := uuid.Parse(str); err != nil {
+			return fmt.Errorf("%s must be a uuid", path)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return fmt.Errorf("%s must be an RFC 3339 date-time", path)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(path string, object map[string]any) error {
+	for _, name := range s.Required {
+		if object[name] == nil {
+			return fmt.Errorf("%s.%s is required", path, name)
+		}
+	}
+
+	// sorted so the same document always reports the same error
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			property = s.AdditionalProperties
+		}
+		if property == nil || object[name] == nil {
+			continue
+		}
+		if err := property.validate(path+"."+name, object[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type ArtifactDeletionStore struct {
+	db *sqlx.DB
+}
+
+func NewArtifactDeletionStore(db *sql.DB) *ArtifactDeletionStore {
+	return &ArtifactDeletionStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type ArtifactDeletion struct {
+	Id            uuid.UUID `db:"id"`
+	ObjectKey     string    `db:"object_key"`
+	Attempts      int       `db:"attempts"`
+	LastError     *string   `db:"last_error"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+func (s *ArtifactDeletionStore) Create(ctx context.Context, objectKey string) (*ArtifactDeletion, error) {
+	const insert = `INSERT INTO artifact_deletions (object_key) VALUES ($1) RETURNING *`
+	var deletion ArtifactDeletion
+	if err := s.db.GetContext(ctx, &deletion, insert, objectKey); err != nil {
+		return nil, fmt.Errorf("failed to insert artifact deletion for %s: %w", objectKey, err)
+	}
+
+	return &deletion, nil
+}
+
+// Claim locks up to limit due deletions by pushing their next attempt to leaseUntil, so that
+// concurrent cleaners skip them and a crashed cleaner's work is picked up again once the lease runs out.
+func (s *ArtifactDeletionStore) Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]ArtifactDeletion, error) {
+	const update = `UPDATE artifact_deletions SET
+                   attempts = attempts + 1,
+                   next_attempt_at = $2
+                   WHERE id IN (
+                       SELECT id FROM artifact_deletions
+                       WHERE next_attempt_at <= CURRENT_TIMESTAMP
+                       ORDER BY next_attempt_at
+                       LIMIT $1
+                       FOR UPDATE SKIP LOCKED
+                   ) RETURNING *`
+
+	var deletions []ArtifactDeletion
+	if err := s.db.SelectContext(ctx, &deletions, update, limit, leaseUntil); err != nil {
+		return nil, fmt.Errorf("failed to claim artifact deletions: %w", err)
+	}
+
+	return deletions, nil
+}
+
+// Complete removes a deletion whose file is gone, and the file's reference count if it had one.
+func (s *ArtifactDeletionStore) Complete(ctx context.Context, id uuid.UUID) error {
+	const deleteStatement = `WITH completed AS (
+                   DELETE FROM artifact_deletions WHERE id = $1 RETURNING object_key
+               )
+               DELETE FROM artifacts WHERE object_key IN (SELECT object_key FROM completed) AND ref_count <= 0`
+	if _, err := s.db.ExecContext(ctx, deleteStatement, id); err != nil {
+		return fmt.Errorf("failed to complete artifact deletion %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *ArtifactDeletionStore) Fail(ctx context.Context, id uuid.UUID, errorMessage string, nextAttemptAt time.Time) error {
+	const update = `UPDATE artifact_deletions SET last_error = $1, next_attempt_at = $2 WHERE id = $3`
+	if _, err := s.db.ExecContext(ctx, update, errorMessage, nextAttemptAt, id); err != nil {
+		return fmt.Errorf("failed to record artifact deletion failure %s: %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactDeletionStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	artifactDeletionStore := store.NewArtifactDeletionStore(env.Db)
+
+	deletion, err := artifactDeletionStore.Create(ctx, "/users/test/report/test.csv.gz")
+	require.NoError(t, err)
+	require.Equal(t, "/users/test/report/test.csv.gz", deletion.ObjectKey)
+	require.Equal(t, 0, deletion.Attempts)
+
+	leaseUntil := time.Now().Add(time.Minute)
+	claimed, err := artifactDeletionStore.Claim(ctx, 10, leaseUntil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, deletion.Id, claimed[0].Id)
+	require.Equal(t, 1, claimed[0].Attempts)
+
+	claimed, err = artifactDeletionStore.Claim(ctx, 10, leaseUntil)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	require.NoError(t, artifactDeletionStore.Fail(ctx, deletion.Id, "storage unavailable", time.Now().Add(-time.Second)))
+	claimed, err = artifactDeletionStore.Claim(ctx, 10, leaseUntil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, 2, claimed[0].Attempts)
+	require.Equal(t, "storage unavailable", *claimed[0].LastError)
+
+	require.NoError(t, artifactDeletionStore.Complete(ctx, deletion.Id))
+	require.NoError(t, artifactDeletionStore.Fail(ctx, deletion.Id, "gone", time.Now().Add(-time.Second)))
+	claimed, err = artifactDeletionStore.Claim(ctx, 10, leaseUntil)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+}
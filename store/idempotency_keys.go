@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type IdempotencyKeyStore struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyKeyStore(db *sql.DB) *IdempotencyKeyStore {
+	return &IdempotencyKeyStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type IdempotencyKey struct {
+	UserId             uuid.UUID  `db:"user_id"`
+	Key                string     `db:"idempotency_key"`
+	RequestFingerprint string     `db:"request_fingerprint"`
+	ResponseStatus     *int       `db:"response_status"`
+	ResponseBody       []byte     `db:"response_body"`
+	CreatedAt          time.Time  `db:"created_at"`
+	CompletedAt        *time.Time `db:"completed_at"`
+	ExpiresAt          time.Time  `db:"expires_at"`
+}
+
+// Acquire claims the key for a new request. If the key is already held by an unexpired request, the
+// existing record is returned with acquired set to false. Keys whose request never completed and that
+// were claimed before staleBefore are taken over, so a crashed request doesn't block retries until expiry.
+func (s *IdempotencyKeyStore) Acquire(ctx context.Context, userId uuid.UUID, key string, fingerprint string, expiresAt time.Time, staleBefore time.Time) (record *IdempotencyKey, acquired bool, err error) {
+	const insert = `INSERT INTO idempotency_keys (user_id, idempotency_key, request_fingerprint, expires_at)
+                   VALUES ($1, $2, $3, $4)
+                   ON CONFLICT (user_id, idempotency_key) DO UPDATE SET
+                   request_fingerprint = EXCLUDED.request_fingerprint,
+                   response_status = NULL,
+                   response_body = NULL,
+                   created_at = CURRENT_TIMESTAMP,
+                   completed_at = NULL,
+                   expires_at = EXCLUDED.expires_at
+                   WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+                   OR (idempotency_keys.completed_at IS NULL AND idempotency_keys.created_at < $5)
+                   RETURNING *`
+
+	var idempotencyKey IdempotencyKey
+	err = s.db.GetContext(ctx, &idempotencyKey, insert, userId, key, fingerprint, expiresAt, staleBefore)
+	if err == nil {
+		return &idempotencyKey, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to acquire idempotency key for user %s: %w", userId, err)
+	}
+
+	const query = `SELECT * FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2`
+	if err := s.db.GetContext(ctx, &idempotencyKey, query, userId, key); err != nil {
+		return nil, false, fmt.Errorf("failed to query idempotency key for user %s: %w", userId, err)
+	}
+
+	return &idempotencyKey, false, nil
+}
+
+func (s *IdempotencyKeyStore) Complete(ctx context.Context, userId uuid.UUID, key string, responseStatus int, responseBody []byte) error {
+	const update = `UPDATE idempotency_keys SET
+                   response_status = $1,
+                   response_body = $2,
+                   completed_at = CURRENT_TIMESTAMP
+                   WHERE user_id = $3 AND idempotency_key = $4`
+	if _, err := s.db.ExecContext(ctx, update, responseStatus, responseBody, userId, key); err != nil {
+		return fmt.Errorf("failed to complete idempotency key for user %s: %w", userId, err)
+	}
+
+	return nil
+}
+
+// Release forgets a key whose request failed, so that the client can retry it.
+func (s *IdempotencyKeyStore) Release(ctx context.Context, userId uuid.UUID, key string) error {
+	const deleteStatement = `DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2`
+	if _, err := s.db.ExecContext(ctx, deleteStatement, userId, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key for user %s: %w", userId, err)
+	}
+
+	return nil
+}
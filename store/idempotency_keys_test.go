@@ -0,0 +1,68 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyKeyStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	idempotencyKeyStore := store.NewIdempotencyKeyStore(env.Db)
+	userStore := store.NewUserStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	staleBefore := now.Add(-time.Minute)
+
+	record, acquired, err := idempotencyKeyStore.Acquire(ctx, user.Id, "key-1", "fingerprint-1", expiresAt, staleBefore)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.Equal(t, "fingerprint-1", record.RequestFingerprint)
+	require.Nil(t, record.CompletedAt)
+
+	record, acquired, err = idempotencyKeyStore.Acquire(ctx, user.Id, "key-1", "fingerprint-2", expiresAt, staleBefore)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	require.Equal(t, "fingerprint-1", record.RequestFingerprint)
+	require.Nil(t, record.CompletedAt)
+
+	require.NoError(t, idempotencyKeyStore.Complete(ctx, user.Id, "key-1", 201, []byte(`{"data":{}}`)))
+	record, acquired, err = idempotencyKeyStore.Acquire(ctx, user.Id, "key-1", "fingerprint-1", expiresAt, staleBefore)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	require.NotNil(t, record.CompletedAt)
+	require.Equal(t, 201, *record.ResponseStatus)
+	require.Equal(t, []byte(`{"data":{}}`), record.ResponseBody)
+
+	// an in flight request older than the lock timeout can be taken over
+	_, acquired, err = idempotencyKeyStore.Acquire(ctx, user.Id, "key-2", "fingerprint-1", expiresAt, staleBefore)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	_, acquired, err = idempotencyKeyStore.Acquire(ctx, user.Id, "key-2", "fingerprint-1", expiresAt, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	require.NoError(t, idempotencyKeyStore.Release(ctx, user.Id, "key-2"))
+	_, acquired, err = idempotencyKeyStore.Acquire(ctx, user.Id, "key-2", "fingerprint-3", expiresAt, staleBefore)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	_, acquired, err = idempotencyKeyStore.Acquire(ctx, user.Id, "key-3", "fingerprint-1", now.Add(-time.Second), staleBefore)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	record, acquired, err = idempotencyKeyStore.Acquire(ctx, user.Id, "key-3", "fingerprint-2", expiresAt, staleBefore)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.Equal(t, "fingerprint-2", record.RequestFingerprint)
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// Actions recorded in the report access log.
+const (
+	ReportAccessView     = "view"
+	ReportAccessDownload = "download"
+)
+
+// ReportAccessLogStore records every access to a report by someone other than its owner, through a grant
+// or a share link.
+type ReportAccessLogStore struct {
+	db *sqlx.DB
+}
+
+func NewReportAccessLogStore(db *sql.DB) *ReportAccessLogStore {
+	return &ReportAccessLogStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type ReportAccess struct {
+	Id          int64      `db:"id"`
+	OwnerId     uuid.UUID  `db:"owner_id"`
+	ReportId    uuid.UUID  `db:"report_id"`
+	Action      string     `db:"action"`
+	AccessedBy  *uuid.UUID `db:"accessed_by"`
+	ShareLinkId *uuid.UUID `db:"share_link_id"`
+	RemoteAddr  *string    `db:"remote_addr"`
+	UserAgent   *string    `db:"user_agent"`
+	CreatedAt   time.Time  `db:"created_at"`
+}
+
+func (s *ReportAccessLogStore) Log(ctx context.Context, access *ReportAccess) error {
+	const insert = `INSERT INTO report_access_log (owner_id, report_id, action, accessed_by, share_link_id, remote_addr, user_agent)
+                   VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := s.db.ExecContext(ctx, insert,
+		access.OwnerId,
+		access.ReportId,
+		access.Action,
+		access.AccessedBy,
+		access.ShareLinkId,
+		access.RemoteAddr,
+		access.UserAgent); err != nil {
+		return fmt.Errorf("failed to log access to report %s: %w", access.ReportId, err)
+	}
+
+	return nil
+}
+
+// ByReport returns the latest accesses to the owner's report, newest first.
+func (s *ReportAccessLogStore) ByReport(ctx context.Context, ownerId uuid.UUID, reportId uuid.UUID, limit int) ([]ReportAccess, error) {
+	const query = `SELECT * FROM report_access_log WHERE owner_id = $1 AND report_id = $2 ORDER BY created_at DESC, id DESC LIMIT $3`
+	var accesses []ReportAccess
+	if err := s.db.SelectContext(ctx, &accesses, query, ownerId, reportId, limit); err != nil {
+		return nil, fmt.Errorf("failed to query access log of report %s: %w", reportId, err)
+	}
+
+	return accesses, nil
+}
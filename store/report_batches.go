@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// ReportBatchStore groups reports that were requested together so their progress can be checked as one.
+type ReportBatchStore struct {
+	db *sqlx.DB
+}
+
+func NewReportBatchStore(db *sql.DB) *ReportBatchStore {
+	return &ReportBatchStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type ReportBatch struct {
+	Id        uuid.UUID `db:"id"`
+	UserId    uuid.UUID `db:"user_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Create inserts a batch and its reports in one transaction, so either all of them are stored or none.
+// The reports are returned in the order they were given. A non-nil check must accept the user's usage
+// first, see checkQuota.
+func (s *ReportBatchStore) Create(ctx context.Context, userId uuid.UUID, reports []*Report, check QuotaCheck) (*ReportBatch, []Report, error) {
+	const insertBatch = `INSERT INTO report_batches (user_id) VALUES ($1) RETURNING *`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkQuota(ctx, tx, userId, check); err != nil {
+		return nil, nil, err
+	}
+
+	var batch ReportBatch
+	if err := tx.GetContext(ctx, &batch, insertBatch, userId); err != nil {
+		return nil, nil, fmt.Errorf("failed to insert report batch for user %s: %w", userId, err)
+	}
+
+	created := make([]Report, 0, len(reports))
+	for _, report := range reports {
+		batched := *report
+		batched.UserId = userId
+		batched.BatchId = &batch.Id
+		inserted, err := createReport(ctx, tx, &batched)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to insert report of batch %s: %w", batch.Id, err)
+		}
+		created = append(created, *inserted)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit report batch %s: %w", batch.Id, err)
+	}
+
+	return &batch, created, nil
+}
+
+func (s *ReportBatchStore) ByPrimaryKey(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*ReportBatch, error) {
+	const query = `SELECT * FROM report_batches WHERE user_id = $1 AND id = $2`
+	var batch ReportBatch
+	if err := s.db.GetContext(ctx, &batch, query, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to query report batch %s for user %s: %w", id, userId, err)
+	}
+
+	return &batch, nil
+}
+
+// Reports returns the reports of a batch that haven't been deleted.
+func (s *ReportBatchStore) Reports(ctx context.Context, userId uuid.UUID, batchId uuid.UUID) ([]Report, error) {
+	const query = `SELECT * FROM reports WHERE user_id = $1 AND batch_id = $2 ORDER BY created_at, id`
+	var reports []Report
+	if err := s.db.SelectContext(ctx, &reports, query, userId, batchId); err != nil {
+		return nil, fmt.Errorf("failed to query reports of batch %s for user %s: %w", batchId, userId, err)
+	}
+
+	return reports, nil
+}
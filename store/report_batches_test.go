@@ -0,0 +1,60 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportBatchStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	batchStore := store.NewReportBatchStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	template, err := store.NewReportTemplateStore(env.Db).Create(ctx, &store.ReportTemplate{UserId: user.Id, Name: "monsters", ReportType: "monsters"})
+	require.NoError(t, err)
+
+	batch, created, err := batchStore.Create(ctx, user.Id, []*store.Report{
+		{ReportType: "monsters", Parameters: types.JSONText(`{"category": "monsters"}`)},
+		{ReportType: "monsters", OutputFormat: "json", Compression: "zstd", TemplateId: &template.Id},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, user.Id, batch.UserId)
+	require.Len(t, created, 2)
+	require.Equal(t, "csv", created[0].OutputFormat)
+	require.Equal(t, "json", created[1].OutputFormat)
+	require.Nil(t, created[0].TemplateId)
+	require.Equal(t, template.Id, *created[1].TemplateId)
+	for _, report := range created {
+		require.Equal(t, user.Id, report.UserId)
+		require.Equal(t, batch.Id, *report.BatchId)
+	}
+
+	found, err := batchStore.ByPrimaryKey(ctx, user.Id, batch.Id)
+	require.NoError(t, err)
+	require.Equal(t, batch.Id, found.Id)
+
+	batchReports, err := batchStore.Reports(ctx, user.Id, batch.Id)
+	require.NoError(t, err)
+	require.Len(t, batchReports, 2)
+
+	// a failing insert rolls the whole batch back
+	_, _, err = batchStore.Create(ctx, user.Id, []*store.Report{
+		{ReportType: "monsters"},
+		{ReportType: "monsters", Parameters: types.JSONText(`not json`)},
+	}, nil)
+	require.Error(t, err)
+	var count int
+	require.NoError(t, env.Db.QueryRow(`SELECT COUNT(*) FROM reports`).Scan(&count))
+	require.Equal(t, 2, count)
+}
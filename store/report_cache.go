@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CachedReport returns the user's latest report with the fingerprint that built its own file after
+// completedAfter and still has it. Reports that reused another report's file are never returned, so a
+// file is only reused for as long as the report that built it is recent enough. Files are never shared
+// between users, their keys and existence would tell one user about another's reports.
+func (s *ReportStore) CachedReport(ctx context.Context, userId uuid.UUID, fingerprint string, completedAfter time.Time) (*Report, error) {
+	const query = `SELECT * FROM reports
+                   WHERE user_id = $1 AND fingerprint = $2 AND NOT cache_hit AND completed_at > $3
+                   AND output_file_path IS NOT NULL AND expired_at IS NULL
+                   ORDER BY completed_at DESC LIMIT 1`
+	var report Report
+	if err := s.db.GetContext(ctx, &report, query, userId, fingerprint, completedAfter); err != nil {
+		return nil, fmt.Errorf("failed to query cached report: %w", err)
+	}
+
+	return &report, nil
+}
+
+// CompleteFromCache completes a report being built with the file of source and counts the new reference
+// to the file. Source is locked while the reference is added, so deleting or expiring it at the same time
+// waits for the reference and then releases the file in a statement that counts it, see releaseFiles.
+// sql.ErrNoRows is returned if source no longer has its file or isn't a report of the same user.
+func (s *ReportStore) CompleteFromCache(ctx context.Context, report *Report, source *Report, now time.Time) (*Report, error) {
+	const update = `WITH source AS (
+                   SELECT output_file_path, uncompressed_size_bytes, compressed_size_bytes, row_count, content_type, sha256
+                   FROM reports WHERE user_id = $1 AND id = $2 AND output_file_path IS NOT NULL
+                   FOR SHARE
+               ), referenced AS (
+                   -- a file without a row was only referenced by source
+                   INSERT INTO artifacts (object_key, ref_count) SELECT output_file_path, 2 FROM source
+                   ON CONFLICT (object_key) DO UPDATE SET ref_count = artifacts.ref_count + 1
+                   RETURNING object_key
+               )
+               UPDATE reports SET
+                   output_file_path = referenced.object_key,
+                   uncompressed_size_bytes = source.uncompressed_size_bytes,
+                   compressed_size_bytes = source.compressed_size_bytes,
+                   row_count = source.row_count,
+                   content_type = source.content_type,
+                   sha256 = source.sha256,
+                   fingerprint = $3,
+                   cache_hit = TRUE,
+                   completed_at = $4,
+                   updated_at = CURRENT_TIMESTAMP
+               FROM source, referenced
+               WHERE reports.user_id = $5 AND reports.id = $6
+               RETURNING reports.*`
+	var completed Report
+	if err := s.db.GetContext(ctx, &completed, update,
+		report.UserId,
+		source.Id,
+		report.Fingerprint,
+		now,
+		report.UserId,
+		report.Id); err != nil {
+		return nil, fmt.Errorf("failed to complete report %s from cached report %s: %w", report.Id, source.Id, err)
+	}
+
+	return &completed, nil
+}
+
+// PruneArtifacts deletes the reference counts of files no report uses anymore that aren't waiting for
+// their deletion, which removes them itself, and queues the files for deletion from storage in case they
+// never were.
+func (s *ReportStore) PruneArtifacts(ctx context.Context) (int64, error) {
+	const prune = `WITH pruned AS (
+                   DELETE FROM artifacts WHERE ref_count <= 0 AND NOT EXISTS (
+                       SELECT 1 FROM artifact_deletions WHERE artifact_deletions.object_key = artifacts.object_key
+                   ) RETURNING object_key
+               )
+               INSERT INTO artifact_deletions (object_key) SELECT object_key FROM pruned`
+	res, err := s.db.ExecContext(ctx, prune)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune artifacts: %w", err)
+	}
+	pruned, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pruned artifacts: %w", err)
+	}
+
+	return pruned, nil
+}
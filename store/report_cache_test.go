@@ -0,0 +1,224 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportStoreCache(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	artifactDeletionStore := store.NewArtifactDeletionStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+	other, err := userStore.CreateUser(ctx, "other@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	fingerprint := "d2a84f4b8b650937ec8f73cd8be2c74add5a911ba64df27458ed8229da804a26"
+	now := time.Now()
+
+	_, err = reportStore.CachedReport(ctx, user.Id, fingerprint, now.Add(-time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	built, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	key := "/users/" + user.Id.String() + "/report/" + built.Id.String() + ".csv.gz"
+	size := int64(1024)
+	built.StartedAt = &now
+	built.CompletedAt = &now
+	built.OutputFilePath = &key
+	built.CompressedSizeBytes = &size
+	built.Fingerprint = &fingerprint
+	built, err = reportStore.Update(ctx, built)
+	require.NoError(t, err)
+
+	cached, err := reportStore.CachedReport(ctx, user.Id, fingerprint, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, built.Id, cached.Id)
+	_, err = reportStore.CachedReport(ctx, user.Id, fingerprint, now.Add(time.Second))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// files aren't shared between users
+	_, err = reportStore.CachedReport(ctx, other.Id, fingerprint, now.Add(-time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	otherReport, err := reportStore.Create(ctx, &store.Report{UserId: other.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	_, err = reportStore.CompleteFromCache(ctx, otherReport, cached, now)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// two more reports of the user reuse the file
+	reuses := make([]*store.Report, 0, 2)
+	for range 2 {
+		reuse, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+		require.NoError(t, err)
+		reuse.StartedAt = &now
+		reuse, err = reportStore.Update(ctx, reuse)
+		require.NoError(t, err)
+		reuse.Fingerprint = &fingerprint
+
+		reuse, err = reportStore.CompleteFromCache(ctx, reuse, cached, now)
+		require.NoError(t, err)
+		require.True(t, reuse.CacheHit)
+		require.Equal(t, key, *reuse.OutputFilePath)
+		require.Equal(t, size, *reuse.CompressedSizeBytes)
+		require.Equal(t, fingerprint, *reuse.Fingerprint)
+		require.NotNil(t, reuse.CompletedAt)
+		reuses = append(reuses, reuse)
+	}
+
+	// reports that reused a file aren't reused themselves
+	cached, err = reportStore.CachedReport(ctx, user.Id, fingerprint, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, built.Id, cached.Id)
+
+	claimDeletions := func() []store.ArtifactDeletion {
+		deletions, err := artifactDeletionStore.Claim(ctx, 10, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		return deletions
+	}
+
+	// the file is only deleted once no report uses it
+	_, err = reportStore.Delete(ctx, user.Id, built.Id)
+	require.NoError(t, err)
+	require.Empty(t, claimDeletions())
+
+	// the report that built the file is gone, so it can't be reused anymore
+	_, err = reportStore.CachedReport(ctx, user.Id, fingerprint, now.Add(-time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = reportStore.CompleteFromCache(ctx, reuses[0], built, now)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = reportStore.Delete(ctx, user.Id, reuses[0].Id)
+	require.NoError(t, err)
+	require.Empty(t, claimDeletions())
+
+	deleted, err := reportStore.DeleteMatching(ctx, user.Id, store.ReportFilter{Status: "completed"})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	deletions := claimDeletions()
+	require.Len(t, deletions, 1)
+	require.Equal(t, key, deletions[0].ObjectKey)
+	require.NoError(t, artifactDeletionStore.Complete(ctx, deletions[0].Id))
+}
+
+// A report completed from the cache while the report that built the file is being deleted keeps the file:
+// the deletion waits for the lock on the source and must then count the reference added meanwhile.
+func TestReportStoreCacheConcurrentDelete(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	artifactDeletionStore := store.NewArtifactDeletionStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	fingerprint := "d2a84f4b8b650937ec8f73cd8be2c74add5a911ba64df27458ed8229da804a26"
+	now := time.Now()
+	built, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	key := "/users/" + user.Id.String() + "/report/" + built.Id.String() + ".csv.gz"
+	built.StartedAt = &now
+	built.CompletedAt = &now
+	built.OutputFilePath = &key
+	built.Fingerprint = &fingerprint
+	built, err = reportStore.Update(ctx, built)
+	require.NoError(t, err)
+
+	reuse, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	reuse.StartedAt = &now
+	reuse, err = reportStore.Update(ctx, reuse)
+	require.NoError(t, err)
+	reuse.Fingerprint = &fingerprint
+
+	// hold a lock on the source so the deletion starts and then waits, like it would for CompleteFromCache
+	lock, err := env.Db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer lock.Rollback()
+	_, err = lock.ExecContext(ctx, `SELECT 1 FROM reports WHERE id = $1 FOR SHARE`, built.Id)
+	require.NoError(t, err)
+
+	deleteErr := make(chan error, 1)
+	go func() {
+		_, err := reportStore.Delete(ctx, user.Id, built.Id)
+		deleteErr <- err
+	}()
+	require.Eventually(t, func() bool {
+		var waiting int
+		require.NoError(t, env.Db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pg_stat_activity
+                   WHERE wait_event_type = 'Lock' AND query LIKE 'DELETE FROM reports%'`).Scan(&waiting))
+		return waiting > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the reference is added while the deletion waits
+	reuse, err = reportStore.CompleteFromCache(ctx, reuse, built, now)
+	require.NoError(t, err)
+	require.Equal(t, key, *reuse.OutputFilePath)
+	require.NoError(t, lock.Rollback())
+	require.NoError(t, <-deleteErr)
+
+	deletions, err := artifactDeletionStore.Claim(ctx, 10, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, deletions)
+	var refCount int
+	require.NoError(t, env.Db.QueryRowContext(ctx, `SELECT ref_count FROM artifacts WHERE object_key = $1`, key).Scan(&refCount))
+	require.Equal(t, 1, refCount)
+
+	_, err = reportStore.Delete(ctx, user.Id, reuse.Id)
+	require.NoError(t, err)
+	deletions, err = artifactDeletionStore.Claim(ctx, 10, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, deletions, 1)
+	require.Equal(t, key, deletions[0].ObjectKey)
+}
+
+func TestReportStorePruneArtifacts(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	reportStore := store.NewReportStore(env.Db)
+	artifactDeletionStore := store.NewArtifactDeletionStore(env.Db)
+
+	// a count left behind, one whose deletion is still pending and one of a file in use
+	_, err := env.Db.ExecContext(ctx, `INSERT INTO artifacts (object_key, ref_count) VALUES ('left.csv', 0), ('pending.csv', 0), ('used.csv', 2)`)
+	require.NoError(t, err)
+	_, err = artifactDeletionStore.Create(ctx, "pending.csv")
+	require.NoError(t, err)
+
+	pruned, err := reportStore.PruneArtifacts(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+
+	var keys []string
+	require.NoError(t, sqlx.NewDb(env.Db, "postgres").SelectContext(ctx, &keys, `SELECT object_key FROM artifacts ORDER BY object_key`))
+	require.Equal(t, []string{"pending.csv", "used.csv"}, keys)
+
+	deletions, err := artifactDeletionStore.Claim(ctx, 10, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	var deleted []string
+	for _, deletion := range deletions {
+		deleted = append(deleted, deletion.ObjectKey)
+	}
+	require.ElementsMatch(t, []string{"left.csv", "pending.csv"}, deleted)
+
+	pruned, err = reportStore.PruneArtifacts(ctx)
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+}
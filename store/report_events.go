@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ReportEventsChannel is the Postgres NOTIFY channel report status changes are published on.
+const ReportEventsChannel = "report_events"
+
+type ReportEvent struct {
+	UserId   uuid.UUID `json:"user_id"`
+	ReportId uuid.UUID `json:"report_id"`
+	Status   string    `json:"status"`
+}
+
+// PublishEvent notifies every listener on ReportEventsChannel of the report's current status.
+func (s *ReportStore) PublishEvent(ctx context.Context, report *Report) error {
+	payload, err := json.Marshal(ReportEvent{
+		UserId:   report.UserId,
+		ReportId: report.Id,
+		Status:   report.Status(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode event for report %s: %w", report.Id, err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, ReportEventsChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to publish event for report %s: %w", report.Id, err)
+	}
+
+	return nil
+}
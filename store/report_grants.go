@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// ReportGrantStore holds the users a report's owner shared it with. Grants are read-only, grantees can
+// see and download the report but not change or delete it.
+type ReportGrantStore struct {
+	db *sqlx.DB
+}
+
+func NewReportGrantStore(db *sql.DB) *ReportGrantStore {
+	return &ReportGrantStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type ReportGrant struct {
+	OwnerId      uuid.UUID `db:"owner_id"`
+	ReportId     uuid.UUID `db:"report_id"`
+	GranteeId    uuid.UUID `db:"grantee_id"`
+	GranteeEmail string    `db:"grantee_email"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// Create shares the owner's report with the grantee. Granting it again returns the existing grant.
+func (s *ReportGrantStore) Create(ctx context.Context, ownerId uuid.UUID, reportId uuid.UUID, granteeId uuid.UUID) (*ReportGrant, error) {
+	const insert = `WITH granted AS (
+                   INSERT INTO report_grants (owner_id, report_id, grantee_id) VALUES ($1, $2, $3)
+                   ON CONFLICT (owner_id, report_id, grantee_id) DO UPDATE SET grantee_id = EXCLUDED.grantee_id
+                   RETURNING *
+               )
+               SELECT granted.*, users.email AS grantee_email FROM granted JOIN users ON users.id = granted.grantee_id`
+	var grant ReportGrant
+	if err := s.db.GetContext(ctx, &grant, insert, ownerId, reportId, granteeId); err != nil {
+		return nil, fmt.Errorf("failed to grant report %s to user %s: %w", reportId, granteeId, err)
+	}
+
+	return &grant, nil
+}
+
+func (s *ReportGrantStore) ByReport(ctx context.Context, ownerId uuid.UUID, reportId uuid.UUID) ([]ReportGrant, error) {
+	const query = `SELECT report_grants.*, users.email AS grantee_email FROM report_grants
+                   JOIN users ON users.id = report_grants.grantee_id
+                   WHERE report_grants.owner_id = $1 AND report_grants.report_id = $2 ORDER BY report_grants.created_at`
+	var grants []ReportGrant
+	if err := s.db.SelectContext(ctx, &grants, query, ownerId, reportId); err != nil {
+		return nil, fmt.Errorf("failed to query grants of report %s: %w", reportId, err)
+	}
+
+	return grants, nil
+}
+
+func (s *ReportGrantStore) Delete(ctx context.Context, ownerId uuid.UUID, reportId uuid.UUID, granteeId uuid.UUID) error {
+	const deleteStatement = `DELETE FROM report_grants WHERE owner_id = $1 AND report_id = $2 AND grantee_id = $3 RETURNING grantee_id`
+	var deletedId uuid.UUID
+	if err := s.db.GetContext(ctx, &deletedId, deleteStatement, ownerId, reportId, granteeId); err != nil {
+		return fmt.Errorf("failed to revoke grant of report %s for user %s: %w", reportId, granteeId, err)
+	}
+
+	return nil
+}
+
+// SharedReport returns a report another user granted the grantee access to.
+func (s *ReportGrantStore) SharedReport(ctx context.Context, granteeId uuid.UUID, reportId uuid.UUID) (*Report, error) {
+	const query = `SELECT reports.* FROM reports
+                   JOIN report_grants ON report_grants.owner_id = reports.user_id AND report_grants.report_id = reports.id
+                   WHERE report_grants.grantee_id = $1 AND report_grants.report_id = $2`
+	var report Report
+	if err := s.db.GetContext(ctx, &report, query, granteeId, reportId); err != nil {
+		return nil, fmt.Errorf("failed to query report %s shared with user %s: %w", reportId, granteeId, err)
+	}
+
+	return &report, nil
+}
+
+// SharedReports returns the reports shared with the grantee, most recently shared first.
+func (s *ReportGrantStore) SharedReports(ctx context.Context, granteeId uuid.UUID) ([]Report, error) {
+	const query = `SELECT reports.* FROM reports
+                   JOIN report_grants ON report_grants.owner_id = reports.user_id AND report_grants.report_id = reports.id
+                   WHERE report_grants.grantee_id = $1 ORDER BY report_grants.created_at DESC`
+	var reports []Report
+	if err := s.db.SelectContext(ctx, &reports, query, granteeId); err != nil {
+		return nil, fmt.Errorf("failed to query reports shared with user %s: %w", granteeId, err)
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	_ "github.com/lib/pq"
+)
+
+type ReportScheduleStore struct {
+	db *sqlx.DB
+}
+
+func NewReportScheduleStore(db *sql.DB) *ReportScheduleStore {
+	return &ReportScheduleStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type ReportSchedule struct {
+	Id               uuid.UUID      `db:"id"`
+	UserId           uuid.UUID      `db:"user_id"`
+	CronExpression   string         `db:"cron_expression"`
+	Timezone         string         `db:"timezone"`
+	ReportType       string         `db:"report_type"`
+	Parameters       types.JSONText `db:"parameters"`
+	OutputFormat     string         `db:"output_format"`
+	Compression      string         `db:"compression"`
+	CompressionLevel *int           `db:"compression_level"`
+	CallbackUrl      *string        `db:"callback_url"`
+	Enabled          bool           `db:"enabled"`
+	CatchUpPolicy    string         `db:"catch_up_policy"`
+	NextRunAt        time.Time      `db:"next_run_at"`
+	LastRunAt        *time.Time     `db:"last_run_at"`
+	CreatedAt        time.Time      `db:"created_at"`
+	UpdatedAt        time.Time      `db:"updated_at"`
+}
+
+type ScheduleRun struct {
+	ScheduleId   uuid.UUID  `db:"schedule_id"`
+	ScheduledFor time.Time  `db:"scheduled_for"`
+	UserId       uuid.UUID  `db:"user_id"`
+	ReportId     *uuid.UUID `db:"report_id"`
+	EnqueuedAt   *time.Time `db:"enqueued_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+	// SkippedReason is why no report was created for the run, ReportId is nil then
+	SkippedReason *string `db:"skipped_reason"`
+}
+
+// SchedulePlanner decides which runs of a due schedule to create and when it is due next.
+type SchedulePlanner func(schedule *ReportSchedule) (runs []time.Time, nextRunAt time.Time, err error)
+
+func (s *ReportScheduleStore) Create(ctx context.Context, schedule *ReportSchedule) (*ReportSchedule, error) {
+	const insert = `INSERT INTO report_schedules (user_id, cron_expression, timezone, report_type, parameters, output_format,
+                   compression, compression_level, callback_url, enabled, catch_up_policy, next_run_at)
+                   VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'csv'), COALESCE(NULLIF($7, ''), 'gzip'), $8, $9, $10, $11, $12)
+                   RETURNING *`
+	var created ReportSchedule
+	if err := s.db.GetContext(ctx, &created, insert,
+		schedule.UserId,
+		schedule.CronExpression,
+		schedule.Timezone,
+		schedule.ReportType,
+		schedule.Parameters,
+		schedule.OutputFormat,
+		schedule.Compression,
+		schedule.CompressionLevel,
+		schedule.CallbackUrl,
+		schedule.Enabled,
+		schedule.CatchUpPolicy,
+		schedule.NextRunAt); err != nil {
+		return nil, fmt.Errorf("failed to insert report schedule for user %s: %w", schedule.UserId, err)
+	}
+
+	return &created, nil
+}
+
+func (s *ReportScheduleStore) Update(ctx context.Context, schedule *ReportSchedule) (*ReportSchedule, error) {
+	const update = `UPDATE report_schedules SET
+                   cron_expression = $1,
+                   timezone = $2,
+                   report_type = $3,
+                   parameters = $4,
+                   output_format = COALESCE(NULLIF($5, ''), 'csv'),
+                   compression = COALESCE(NULLIF($6, ''), 'gzip'),
+                   compression_level = $7,
+                   callback_url = $8,
+                   enabled = $9,
+                   catch_up_policy = $10,
+                   next_run_at = $11,
+                   updated_at = CURRENT_TIMESTAMP
+                   WHERE user_id = $12 AND id = $13 RETURNING *`
+
+	var updated ReportSchedule
+	if err := s.db.GetContext(ctx, &updated, update,
+		schedule.CronExpression,
+		schedule.Timezone,
+		schedule.ReportType,
+		schedule.Parameters,
+		schedule.OutputFormat,
+		schedule.Compression,
+		schedule.CompressionLevel,
+		schedule.CallbackUrl,
+		schedule.Enabled,
+		schedule.CatchUpPolicy,
+		schedule.NextRunAt,
+		schedule.UserId,
+		schedule.Id); err != nil {
+		return nil, fmt.Errorf("failed to update report schedule %s for user %s: %w", schedule.Id, schedule.UserId, err)
+	}
+
+	return &updated, nil
+}
+
+func (s *ReportScheduleStore) ByPrimaryKey(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*ReportSchedule, error) {
+	const query = `SELECT * FROM report_schedules WHERE user_id = $1 AND id = $2`
+	var schedule ReportSchedule
+	if err := s.db.GetContext(ctx, &schedule, query, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to query report schedule for user %s: %w", userId, err)
+	}
+
+	return &schedule, nil
+}
+
+func (s *ReportScheduleStore) ByUser(ctx context.Context, userId uuid.UUID) ([]ReportSchedule, error) {
+	const query = `SELECT * FROM report_schedules WHERE user_id = $1 ORDER BY created_at`
+	var schedules []ReportSchedule
+	if err := s.db.SelectContext(ctx, &schedules, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to query report schedules for user %s: %w", userId, err)
+	}
+
+	return schedules, nil
+}
+
+func (s *ReportScheduleStore) Delete(ctx context.Context, userId uuid.UUID, id uuid.UUID) error {
+	const deleteStatement = `DELETE FROM report_schedules WHERE user_id = $1 AND id = $2 RETURNING id`
+	var deletedId uuid.UUID
+	if err := s.db.GetContext(ctx, &deletedId, deleteStatement, userId, id); err != nil {
+		return fmt.Errorf("failed to delete report schedule %s for user %s: %w", id, userId, err)
+	}
+
+	return nil
+}
+
+func (s *ReportScheduleStore) RunsBySchedule(ctx context.Context, userId uuid.UUID, scheduleId uuid.UUID, limit int) ([]ScheduleRun, error) {
+	const query = `SELECT * FROM schedule_runs WHERE user_id = $1 AND schedule_id = $2 ORDER BY scheduled_for DESC LIMIT $3`
+	var runs []ScheduleRun
+	if err := s.db.SelectContext(ctx, &runs, query, userId, scheduleId, limit); err != nil {
+		return nil, fmt.Errorf("failed to query runs of report schedule %s: %w", scheduleId, err)
+	}
+
+	return runs, nil
+}
+
+// RunDue creates the reports of up to limit schedules due at now, as decided by plan, and moves the schedules
+// to their next run. Due schedules are locked for the transaction and skipped by concurrent schedulers, and
+// a run is created at most once per schedule and time, so every run produces exactly one report.
+// Schedules the plan fails for are disabled instead of blocking the others. Scheduled reports count against
+// the user's quotas like any other: a non-nil check is run for every run, see checkQuota, and runs it
+// rejects are recorded without a report, with the error as the reason. Only created runs are returned.
+func (s *ReportScheduleStore) RunDue(ctx context.Context, now time.Time, limit int, plan SchedulePlanner, check QuotaCheck) ([]ScheduleRun, error) {
+	const selectDue = `SELECT * FROM report_schedules WHERE enabled AND next_run_at <= $1
+                   ORDER BY next_run_at LIMIT $2 FOR UPDATE SKIP LOCKED`
+	const insertRun = `WITH run AS (
+                   INSERT INTO schedule_runs (schedule_id, scheduled_for, user_id, report_id)
+                   VALUES ($1, $2, $3, gen_random_uuid())
+                   ON CONFLICT DO NOTHING RETURNING *
+               ), report AS (
+                   INSERT INTO reports (id, user_id, report_type, parameters, output_format, compression, compression_level, callback_url, schedule_id)
+                   SELECT run.report_id, run.user_id, $4::VARCHAR, $5::JSONB, $6::VARCHAR, $7::VARCHAR, $8::INT, $9::VARCHAR, run.schedule_id FROM run
+                   RETURNING user_id, created_at
+               ), logged AS (
+                   INSERT INTO report_creations (user_id, created_at) SELECT user_id, created_at FROM report
+               )
+               SELECT * FROM run`
+	const insertSkippedRun = `INSERT INTO schedule_runs (schedule_id, scheduled_for, user_id, skipped_reason)
+                   VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
+	const updateSchedule = `UPDATE report_schedules SET next_run_at = $1, last_run_at = COALESCE($2, last_run_at) WHERE id = $3`
+	const disableSchedule = `UPDATE report_schedules SET enabled = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var schedules []ReportSchedule
+	if err := tx.SelectContext(ctx, &schedules, selectDue, now, limit); err != nil {
+		return nil, fmt.Errorf("failed to query due report schedules: %w", err)
+	}
+
+	var created []ScheduleRun
+	for _, schedule := range schedules {
+		runTimes, nextRunAt, err := plan(&schedule)
+		if err != nil {
+			if _, err := tx.ExecContext(ctx, disableSchedule, schedule.Id); err != nil {
+				return nil, fmt.Errorf("failed to disable report schedule %s: %w", schedule.Id, err)
+			}
+			continue
+		}
+
+		var lastRunAt *time.Time
+		for _, runTime := range runTimes {
+			if check != nil {
+				usage, err := lockUsage(ctx, tx, schedule.UserId)
+				if err != nil {
+					return nil, err
+				}
+				if err := check(usage); err != nil {
+					if _, err := tx.ExecContext(ctx, insertSkippedRun, schedule.Id, runTime, schedule.UserId, err.Error()); err != nil {
+						return nil, fmt.Errorf("failed to record skipped run of report schedule %s: %w", schedule.Id, err)
+					}
+					continue
+				}
+			}
+
+			var runs []ScheduleRun
+			if err := tx.SelectContext(ctx, &runs, insertRun,
+				schedule.Id,
+				runTime,
+				schedule.UserId,
+				schedule.ReportType,
+				schedule.Parameters,
+				schedule.OutputFormat,
+				schedule.Compression,
+				schedule.CompressionLevel,
+				schedule.CallbackUrl); err != nil {
+				return nil, fmt.Errorf("failed to create run of report schedule %s: %w", schedule.Id, err)
+			}
+			if len(runs) > 0 {
+				created = append(created, runs...)
+				lastRunAt = &runTime
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, updateSchedule, nextRunAt, lastRunAt, schedule.Id); err != nil {
+			return nil, fmt.Errorf("failed to update report schedule %s: %w", schedule.Id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit report schedule runs: %w", err)
+	}
+
+	return created, nil
+}
+
+// NotEnqueuedRuns returns runs created before createdBefore whose reports were never successfully queued.
+func (s *ReportScheduleStore) NotEnqueuedRuns(ctx context.Context, createdBefore time.Time, limit int) ([]ScheduleRun, error) {
+	const query = `SELECT * FROM schedule_runs WHERE enqueued_at IS NULL AND report_id IS NOT NULL AND created_at < $1
+                   ORDER BY created_at LIMIT $2`
+	var runs []ScheduleRun
+	if err := s.db.SelectContext(ctx, &runs, query, createdBefore, limit); err != nil {
+		return nil, fmt.Errorf("failed to query schedule runs not enqueued: %w", err)
+	}
+
+	return runs, nil
+}
+
+func (s *ReportScheduleStore) MarkEnqueued(ctx context.Context, scheduleId uuid.UUID, scheduledFor time.Time) error {
+	const update = `UPDATE schedule_runs SET enqueued_at = CURRENT_TIMESTAMP WHERE schedule_id = $1 AND scheduled_for = $2`
+	if _, err := s.db.ExecContext(ctx, update, scheduleId, scheduledFor); err != nil {
+		return fmt.Errorf("failed to mark run of report schedule %s as enqueued: %w", scheduleId, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportScheduleStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	scheduleStore := store.NewReportScheduleStore(env.Db)
+
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	now := time.Now()
+	schedule, err := scheduleStore.Create(ctx, &store.ReportSchedule{
+		UserId:         user.Id,
+		CronExpression: "0 * * * *",
+		Timezone:       "UTC",
+		ReportType:     "monsters",
+		Parameters:     []byte(`{"category":"monsters"}`),
+		Enabled:        true,
+		CatchUpPolicy:  "skip",
+		NextRunAt:      now.Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "csv", schedule.OutputFormat)
+	require.Equal(t, "gzip", schedule.Compression)
+
+	runAt := schedule.NextRunAt
+	nextRunAt := now.Add(time.Hour)
+	plan := func(schedule *store.ReportSchedule) ([]time.Time, time.Time, error) {
+		return []time.Time{schedule.NextRunAt}, nextRunAt, nil
+	}
+
+	runs, err := scheduleStore.RunDue(ctx, now, 10, plan, nil)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, schedule.Id, runs[0].ScheduleId)
+	require.True(t, runs[0].ScheduledFor.Equal(runAt))
+
+	report, err := reportStore.ByPrimaryKey(ctx, user.Id, *runs[0].ReportId)
+	require.NoError(t, err)
+	require.Equal(t, "monsters", report.ReportType)
+	require.JSONEq(t, `{"category":"monsters"}`, report.Parameters.String())
+	require.Equal(t, schedule.Id, *report.ScheduleId)
+
+	// scheduled reports count against the quotas like the others
+	usage, err := reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, usage.CreatedLastHour)
+
+	// the schedule isn't due anymore so a second scheduler doesn't create the run again
+	runs, err = scheduleStore.RunDue(ctx, now, 10, plan, nil)
+	require.NoError(t, err)
+	require.Empty(t, runs)
+
+	schedule, err = scheduleStore.ByPrimaryKey(ctx, user.Id, schedule.Id)
+	require.NoError(t, err)
+	require.WithinDuration(t, nextRunAt, schedule.NextRunAt, time.Millisecond)
+	require.WithinDuration(t, runAt, *schedule.LastRunAt, time.Millisecond)
+
+	notEnqueued, err := scheduleStore.NotEnqueuedRuns(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, notEnqueued, 1)
+	require.NoError(t, scheduleStore.MarkEnqueued(ctx, notEnqueued[0].ScheduleId, notEnqueued[0].ScheduledFor))
+	notEnqueued, err = scheduleStore.NotEnqueuedRuns(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Empty(t, notEnqueued)
+
+	// schedules the plan fails for are disabled
+	schedule.NextRunAt = now.Add(-time.Minute)
+	schedule, err = scheduleStore.Update(ctx, schedule)
+	require.NoError(t, err)
+	runs, err = scheduleStore.RunDue(ctx, now, 10, func(schedule *store.ReportSchedule) ([]time.Time, time.Time, error) {
+		return nil, time.Time{}, errors.New("invalid cron expression")
+	}, nil)
+	require.NoError(t, err)
+	require.Empty(t, runs)
+	schedule, err = scheduleStore.ByPrimaryKey(ctx, user.Id, schedule.Id)
+	require.NoError(t, err)
+	require.False(t, schedule.Enabled)
+
+	scheduleRuns, err := scheduleStore.RunsBySchedule(ctx, user.Id, schedule.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, scheduleRuns, 1)
+
+	require.NoError(t, scheduleStore.Delete(ctx, user.Id, schedule.Id))
+
+	// runs over a quota are recorded without a report
+	overQuota, err := scheduleStore.Create(ctx, &store.ReportSchedule{
+		UserId:         user.Id,
+		CronExpression: "0 * * * *",
+		Timezone:       "UTC",
+		ReportType:     "monsters",
+		Enabled:        true,
+		CatchUpPolicy:  "skip",
+		NextRunAt:      now.Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	runs, err = scheduleStore.RunDue(ctx, now, 10, plan, func(usage *store.Usage) error {
+		require.EqualValues(t, 1, usage.InFlight)
+		return errors.New("quota in_flight_reports exceeded")
+	})
+	require.NoError(t, err)
+	require.Empty(t, runs)
+
+	scheduleRuns, err = scheduleStore.RunsBySchedule(ctx, user.Id, overQuota.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, scheduleRuns, 1)
+	require.Nil(t, scheduleRuns[0].ReportId)
+	require.Equal(t, "quota in_flight_reports exceeded", *scheduleRuns[0].SkippedReason)
+	notEnqueued, err = scheduleStore.NotEnqueuedRuns(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Empty(t, notEnqueued)
+
+	overQuota, err = scheduleStore.ByPrimaryKey(ctx, user.Id, overQuota.Id)
+	require.NoError(t, err)
+	require.WithinDuration(t, nextRunAt, overQuota.NextRunAt, time.Millisecond)
+	require.Nil(t, overQuota.LastRunAt)
+}
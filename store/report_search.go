@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// reportSearchDocument is the text searched by a report search. It has to match the expression of the
+// reports_search_idx index for the index to be used.
+const reportSearchDocument = `to_tsvector('english', COALESCE(title, '') || ' ' || COALESCE(description, ''))`
+
+type ReportSearch struct {
+	ReportFilter
+	// Query is matched against the title and description, in web search syntax: quoted phrases, OR and
+	// -excluded words
+	Query string
+	// Tags only matches reports that have all of them
+	Tags   []string
+	Limit  int
+	Offset int
+}
+
+// Search returns the user's reports matching the search. Reports matching a query are ordered by how well
+// they match, the others by newest first.
+func (s *ReportStore) Search(ctx context.Context, userId uuid.UUID, search ReportSearch) ([]Report, error) {
+	conditions, args, err := search.conditions([]string{"user_id = $1"}, []any{userId})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(search.Tags) > 0 {
+		args = append(args, pq.StringArray(search.Tags))
+		conditions = append(conditions, fmt.Sprintf("tags @> $%d::TEXT[]", len(args)))
+	}
+	orderBy := "created_at DESC, id"
+	if search.Query != "" {
+		args = append(args, search.Query)
+		tsQuery := fmt.Sprintf("websearch_to_tsquery('english', $%d)", len(args))
+		conditions = append(conditions, reportSearchDocument+" @@ "+tsQuery)
+		orderBy = "ts_rank(" + reportSearchDocument + ", " + tsQuery + ") DESC, " + orderBy
+	}
+
+	args = append(args, search.Limit, search.Offset)
+	query := `SELECT * FROM reports WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY ` + orderBy + fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	var reports []Report
+	if err := s.db.SelectContext(ctx, &reports, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to search reports for user %s: %w", userId, err)
+	}
+
+	return reports, nil
+}
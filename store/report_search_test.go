@@ -0,0 +1,152 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportStoreSearch(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+	other, err := userStore.CreateUser(ctx, "other@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	title := "Quarterly revenue by region"
+	revenue, err := reportStore.Create(ctx, &store.Report{
+		UserId:     user.Id,
+		ReportType: "monsters",
+		Title:      &title,
+		Tags:       pq.StringArray{"finance", "q3"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, title, *revenue.Title)
+	require.Equal(t, pq.StringArray{"finance", "q3"}, revenue.Tags)
+
+	description := "Monthly churn of paying customers"
+	churn, err := reportStore.Create(ctx, &store.Report{
+		UserId:      user.Id,
+		ReportType:  "monsters",
+		Description: &description,
+		Tags:        pq.StringArray{"finance"},
+	})
+	require.NoError(t, err)
+
+	untagged, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	require.Empty(t, untagged.Tags)
+
+	_, err = reportStore.Create(ctx, &store.Report{UserId: other.Id, ReportType: "monsters", Title: &title, Tags: pq.StringArray{"finance"}})
+	require.NoError(t, err)
+
+	search := func(search store.ReportSearch) []string {
+		search.Limit = 10
+		found, err := reportStore.Search(ctx, user.Id, search)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(found))
+		for _, report := range found {
+			ids = append(ids, report.Id.String())
+		}
+		return ids
+	}
+
+	// newest first without a query
+	require.Equal(t, []string{untagged.Id.String(), churn.Id.String(), revenue.Id.String()}, search(store.ReportSearch{}))
+	require.Equal(t, []string{churn.Id.String(), revenue.Id.String()}, search(store.ReportSearch{Tags: []string{"finance"}}))
+	require.Equal(t, []string{revenue.Id.String()}, search(store.ReportSearch{Tags: []string{"finance", "q3"}}))
+
+	// words are stemmed, and descriptions are searched too
+	require.Equal(t, []string{revenue.Id.String()}, search(store.ReportSearch{Query: "revenues"}))
+	require.Equal(t, []string{churn.Id.String()}, search(store.ReportSearch{Query: "customer churn"}))
+	require.Empty(t, search(store.ReportSearch{Query: "revenue -region"}))
+
+	future := time.Now().Add(time.Hour)
+	require.Empty(t, search(store.ReportSearch{ReportFilter: store.ReportFilter{CreatedAfter: &future}, Tags: []string{"finance"}}))
+	require.Len(t, search(store.ReportSearch{ReportFilter: store.ReportFilter{Status: "requested"}}), 3)
+
+	untagged.Title = &title
+	untagged.Tags = pq.StringArray{"q3"}
+	updated, err := reportStore.SetMetadata(ctx, untagged)
+	require.NoError(t, err)
+	require.True(t, updated.UpdatedAt.After(untagged.UpdatedAt))
+	require.Equal(t, []string{untagged.Id.String(), revenue.Id.String()}, search(store.ReportSearch{Tags: []string{"q3"}}))
+
+	updated.Title = nil
+	updated.Tags = nil
+	updated, err = reportStore.SetMetadata(ctx, updated)
+	require.NoError(t, err)
+	require.Nil(t, updated.Title)
+	require.Empty(t, updated.Tags)
+}
+
+func TestReportStoreSearchStatus(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	finish := func(finishedAt time.Time, failed bool) *store.Report {
+		report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+		require.NoError(t, err)
+		report.StartedAt = &finishedAt
+		if failed {
+			report.FailedAt = &finishedAt
+		} else {
+			report.CompletedAt = &finishedAt
+		}
+		report, err = reportStore.Update(ctx, report)
+		require.NoError(t, err)
+		return report
+	}
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	expiredCompleted := finish(longAgo, false)
+	expiredFailed := finish(longAgo, true)
+	expired, err := reportStore.Expire(ctx, time.Now(), 24*time.Hour, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 2)
+
+	completed := finish(time.Now(), false)
+	failed := finish(time.Now(), true)
+
+	search := func(status string) []uuid.UUID {
+		found, err := reportStore.Search(ctx, user.Id, store.ReportSearch{ReportFilter: store.ReportFilter{Status: status}, Limit: 10})
+		require.NoError(t, err)
+		ids := make([]uuid.UUID, 0, len(found))
+		for _, report := range found {
+			require.Equal(t, status, report.Status())
+			ids = append(ids, report.Id)
+		}
+		return ids
+	}
+
+	// expired reports only match their own status, as in Report.Status
+	require.ElementsMatch(t, []uuid.UUID{completed.Id}, search("completed"))
+	require.ElementsMatch(t, []uuid.UUID{failed.Id}, search("failed"))
+	require.ElementsMatch(t, []uuid.UUID{expiredCompleted.Id, expiredFailed.Id}, search("expired"))
+
+	deleted, err := reportStore.DeleteMatching(ctx, user.Id, store.ReportFilter{Status: "completed"})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.Equal(t, completed.Id, deleted[0].Id)
+	_, err = reportStore.ByPrimaryKey(ctx, user.Id, expiredCompleted.Id)
+	require.NoError(t, err)
+}
@@ -0,0 +1,156 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportGrantStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	grantStore := store.NewReportGrantStore(env.Db)
+	owner, err := userStore.CreateUser(ctx, "owner@test.com", "secretpswd")
+	require.NoError(t, err)
+	grantee, err := userStore.CreateUser(ctx, "grantee@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	report, err := reportStore.Create(ctx, &store.Report{UserId: owner.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+
+	_, err = grantStore.SharedReport(ctx, grantee.Id, report.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	grant, err := grantStore.Create(ctx, owner.Id, report.Id, grantee.Id)
+	require.NoError(t, err)
+	require.Equal(t, grantee.Id, grant.GranteeId)
+	require.Equal(t, "grantee@test.com", grant.GranteeEmail)
+
+	// granting again keeps the original grant
+	again, err := grantStore.Create(ctx, owner.Id, report.Id, grantee.Id)
+	require.NoError(t, err)
+	require.Equal(t, grant.CreatedAt, again.CreatedAt)
+
+	grants, err := grantStore.ByReport(ctx, owner.Id, report.Id)
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+
+	shared, err := grantStore.SharedReport(ctx, grantee.Id, report.Id)
+	require.NoError(t, err)
+	require.Equal(t, report.Id, shared.Id)
+	require.Equal(t, owner.Id, shared.UserId)
+
+	sharedReports, err := grantStore.SharedReports(ctx, grantee.Id)
+	require.NoError(t, err)
+	require.Len(t, sharedReports, 1)
+
+	// nothing is shared with the owner
+	sharedReports, err = grantStore.SharedReports(ctx, owner.Id)
+	require.NoError(t, err)
+	require.Empty(t, sharedReports)
+
+	require.NoError(t, grantStore.Delete(ctx, owner.Id, report.Id, grantee.Id))
+	require.ErrorIs(t, grantStore.Delete(ctx, owner.Id, report.Id, grantee.Id), sql.ErrNoRows)
+	_, err = grantStore.SharedReport(ctx, grantee.Id, report.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// grants go away with the report
+	_, err = grantStore.Create(ctx, owner.Id, report.Id, grantee.Id)
+	require.NoError(t, err)
+	now := time.Now()
+	report.StartedAt = &now
+	report.CompletedAt = &now
+	_, err = reportStore.Update(ctx, report)
+	require.NoError(t, err)
+	_, err = reportStore.Delete(ctx, owner.Id, report.Id)
+	require.NoError(t, err)
+	sharedReports, err = grantStore.SharedReports(ctx, grantee.Id)
+	require.NoError(t, err)
+	require.Empty(t, sharedReports)
+}
+
+func TestShareLinkStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	linkStore := store.NewShareLinkStore(env.Db)
+	accessLogStore := store.NewReportAccessLogStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	maxDownloads := 2
+	link, err := linkStore.Create(ctx, &store.ShareLink{
+		UserId:       user.Id,
+		ReportId:     report.Id,
+		ExpiresAt:    now.Add(time.Hour),
+		MaxDownloads: &maxDownloads,
+	}, "shr_token")
+	require.NoError(t, err)
+	require.NotEqual(t, "shr_token", link.HashedToken)
+	require.Zero(t, link.DownloadCount)
+
+	found, err := linkStore.ByToken(ctx, "shr_token")
+	require.NoError(t, err)
+	require.Equal(t, link.Id, found.Id)
+	_, err = linkStore.ByToken(ctx, "shr_other")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	used, err := linkStore.Use(ctx, link.Id, now)
+	require.NoError(t, err)
+	require.Equal(t, 1, used.DownloadCount)
+	used, err = linkStore.Use(ctx, link.Id, now)
+	require.NoError(t, err)
+	require.Equal(t, 2, used.DownloadCount)
+	_, err = linkStore.Use(ctx, link.Id, now)
+	require.ErrorIs(t, err, store.ErrShareLinkInactive)
+
+	unlimited, err := linkStore.Create(ctx, &store.ShareLink{
+		UserId:    user.Id,
+		ReportId:  report.Id,
+		ExpiresAt: now.Add(time.Hour),
+	}, "shr_unlimited")
+	require.NoError(t, err)
+	_, err = linkStore.Use(ctx, unlimited.Id, now.Add(2*time.Hour))
+	require.ErrorIs(t, err, store.ErrShareLinkInactive)
+
+	revoked, err := linkStore.Revoke(ctx, user.Id, report.Id, unlimited.Id)
+	require.NoError(t, err)
+	require.NotNil(t, revoked.RevokedAt)
+	_, err = linkStore.Use(ctx, unlimited.Id, now)
+	require.ErrorIs(t, err, store.ErrShareLinkInactive)
+
+	links, err := linkStore.ByReport(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+
+	require.NoError(t, accessLogStore.Log(ctx, &store.ReportAccess{
+		OwnerId:     user.Id,
+		ReportId:    report.Id,
+		Action:      store.ReportAccessDownload,
+		ShareLinkId: &link.Id,
+	}))
+	accesses, err := accessLogStore.ByReport(ctx, user.Id, report.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, accesses, 1)
+	require.Equal(t, store.ReportAccessDownload, accesses[0].Action)
+	require.Equal(t, link.Id, *accesses[0].ShareLinkId)
+	require.Nil(t, accesses[0].AccessedBy)
+}
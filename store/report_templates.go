@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+var ErrReportTemplateNameTaken = errors.New("a report template with this name already exists")
+
+// uniqueViolation is the Postgres error code of unique constraint violations.
+const uniqueViolation = "23505"
+
+type ReportTemplateStore struct {
+	db *sqlx.DB
+}
+
+func NewReportTemplateStore(db *sql.DB) *ReportTemplateStore {
+	return &ReportTemplateStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type ReportTemplate struct {
+	Id               uuid.UUID      `db:"id"`
+	UserId           uuid.UUID      `db:"user_id"`
+	Name             string         `db:"name"`
+	ReportType       string         `db:"report_type"`
+	Parameters       types.JSONText `db:"parameters"`
+	OutputFormat     string         `db:"output_format"`
+	Compression      string         `db:"compression"`
+	CompressionLevel *int           `db:"compression_level"`
+	CallbackUrl      *string        `db:"callback_url"`
+	CreatedAt        time.Time      `db:"created_at"`
+	UpdatedAt        time.Time      `db:"updated_at"`
+	Priority         string         `db:"priority"`
+}
+
+// nameTaken turns violations of the unique template name per user into ErrReportTemplateNameTaken.
+func nameTaken(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrReportTemplateNameTaken
+	}
+	return err
+}
+
+// Create stores a template. It returns ErrReportTemplateNameTaken if the user has a template of that name.
+func (s *ReportTemplateStore) Create(ctx context.Context, template *ReportTemplate) (*ReportTemplate, error) {
+	const insert = `INSERT INTO report_templates (user_id, name, report_type, parameters, output_format, compression, compression_level, callback_url, priority)
+                   VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'csv'), COALESCE(NULLIF($6, ''), 'gzip'), $7, $8, COALESCE(NULLIF($9, ''), 'normal'))
+                   RETURNING *`
+	var created ReportTemplate
+	if err := s.db.GetContext(ctx, &created, insert,
+		template.UserId,
+		template.Name,
+		template.ReportType,
+		template.Parameters,
+		template.OutputFormat,
+		template.Compression,
+		template.CompressionLevel,
+		template.CallbackUrl,
+		template.Priority); err != nil {
+		return nil, fmt.Errorf("failed to insert report template for user %s: %w", template.UserId, nameTaken(err))
+	}
+
+	return &created, nil
+}
+
+// Update replaces a template. It returns ErrReportTemplateNameTaken if the user has another template of that name.
+func (s *ReportTemplateStore) Update(ctx context.Context, template *ReportTemplate) (*ReportTemplate, error) {
+	const update = `UPDATE report_templates SET
+                   name = $1,
+                   report_type = $2,
+                   parameters = $3,
+                   output_format = COALESCE(NULLIF($4, ''), 'csv'),
+                   compression = COALESCE(NULLIF($5, ''), 'gzip'),
+                   compression_level = $6,
+                   callback_url = $7,
+                   priority = COALESCE(NULLIF($8, ''), 'normal'),
+                   updated_at = CURRENT_TIMESTAMP
+                   WHERE user_id = $9 AND id = $10 RETURNING *`
+
+	var updated ReportTemplate
+	if err := s.db.GetContext(ctx, &updated, update,
+		template.Name,
+		template.ReportType,
+		template.Parameters,
+		template.OutputFormat,
+		template.Compression,
+		template.CompressionLevel,
+		template.CallbackUrl,
+		template.Priority,
+		template.UserId,
+		template.Id); err != nil {
+		return nil, fmt.Errorf("failed to update report template %s for user %s: %w", template.Id, template.UserId, nameTaken(err))
+	}
+
+	return &updated, nil
+}
+
+func (s *ReportTemplateStore) ByPrimaryKey(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*ReportTemplate, error) {
+	const query = `SELECT * FROM report_templates WHERE user_id = $1 AND id = $2`
+	var template ReportTemplate
+	if err := s.db.GetContext(ctx, &template, query, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to query report template for user %s: %w", userId, err)
+	}
+
+	return &template, nil
+}
+
+func (s *ReportTemplateStore) ByUser(ctx context.Context, userId uuid.UUID) ([]ReportTemplate, error) {
+	const query = `SELECT * FROM report_templates WHERE user_id = $1 ORDER BY name`
+	var templates []ReportTemplate
+	if err := s.db.SelectContext(ctx, &templates, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to query report templates for user %s: %w", userId, err)
+	}
+
+	return templates, nil
+}
+
+func (s *ReportTemplateStore) Delete(ctx context.Context, userId uuid.UUID, id uuid.UUID) error {
+	const deleteStatement = `DELETE FROM report_templates WHERE user_id = $1 AND id = $2 RETURNING id`
+	var deletedId uuid.UUID
+	if err := s.db.GetContext(ctx, &deletedId, deleteStatement, userId, id); err != nil {
+		return fmt.Errorf("failed to delete report template %s for user %s: %w", id, userId, err)
+	}
+
+	return nil
+}
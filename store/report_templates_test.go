@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportTemplateStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	templateStore := store.NewReportTemplateStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	template, err := templateStore.Create(ctx, &store.ReportTemplate{
+		UserId:     user.Id,
+		Name:       "weekly monsters",
+		ReportType: "monsters",
+		Parameters: types.JSONText(`{"category": "monsters"}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "csv", template.OutputFormat)
+	require.Equal(t, "gzip", template.Compression)
+
+	_, err = templateStore.Create(ctx, &store.ReportTemplate{UserId: user.Id, Name: "weekly monsters", ReportType: "monsters"})
+	require.ErrorIs(t, err, store.ErrReportTemplateNameTaken)
+
+	other, err := templateStore.Create(ctx, &store.ReportTemplate{UserId: user.Id, Name: "all monsters", ReportType: "monsters"})
+	require.NoError(t, err)
+
+	template.OutputFormat = "json"
+	updated, err := templateStore.Update(ctx, template)
+	require.NoError(t, err)
+	require.Equal(t, "json", updated.OutputFormat)
+	require.True(t, updated.UpdatedAt.After(template.UpdatedAt))
+
+	other.Name = template.Name
+	_, err = templateStore.Update(ctx, other)
+	require.ErrorIs(t, err, store.ErrReportTemplateNameTaken)
+
+	templates, err := templateStore.ByUser(ctx, user.Id)
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+	require.Equal(t, "all monsters", templates[0].Name)
+
+	report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters", TemplateId: &template.Id})
+	require.NoError(t, err)
+	require.Equal(t, template.Id, *report.TemplateId)
+
+	// deleting a template keeps the reports created from it
+	require.NoError(t, templateStore.Delete(ctx, user.Id, template.Id))
+	_, err = templateStore.ByPrimaryKey(ctx, user.Id, template.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, templateStore.Delete(ctx, user.Id, template.Id), sql.ErrNoRows)
+
+	report, err = reportStore.ByPrimaryKey(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.Nil(t, report.TemplateId)
+}
@@ -4,9 +4,12 @@ import (
 	"asyncapi/fixtures"
 	"asyncapi/store"
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -22,10 +25,15 @@ func TestReportStore(t *testing.T) {
 	require.NoError(t, err)
 
 	now := time.Now()
-	report, err := reportStore.Create(ctx, user.Id, "monsters")
+	report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters", Parameters: types.JSONText(`{"category": "monsters"}`)})
 	require.NoError(t, err)
 	require.Equal(t, user.Id, report.UserId)
 	require.Equal(t, "monsters", report.ReportType)
+	require.JSONEq(t, `{"category": "monsters"}`, report.Parameters.String())
+	require.Equal(t, "csv", report.OutputFormat)
+	require.Equal(t, "gzip", report.Compression)
+	require.Nil(t, report.CompressionLevel)
+	require.Equal(t, "normal", report.Priority)
 	timeDiff := report.CreatedAt.Sub(now).Abs()
 	require.Less(t, timeDiff, time.Second) // Ensure created within 1 second of now
 
@@ -36,6 +44,11 @@ func TestReportStore(t *testing.T) {
 	downloadUrl := "http://localhost:8080/reports"
 	outputPath := "s3://reports-test/reports"
 	downloadUrlExpiresAt := report.CreatedAt.Add(4 * time.Second)
+	uncompressedSize := int64(2048)
+	compressedSize := int64(512)
+	rowCount := int64(42)
+	contentType := "text/csv; charset=utf-8"
+	sha256 := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
 
 	report.ReportType = "food"
 	report.StartedAt = &startedAt
@@ -45,6 +58,11 @@ func TestReportStore(t *testing.T) {
 	report.ErrorMessage = &errorMsg
 	report.OutputFilePath = &outputPath
 	report.DownloadUrlExpiresAt = &downloadUrlExpiresAt
+	report.UncompressedSizeBytes = &uncompressedSize
+	report.CompressedSizeBytes = &compressedSize
+	report.RowCount = &rowCount
+	report.ContentType = &contentType
+	report.Sha256 = &sha256
 
 	report2, err := reportStore.Update(ctx, report)
 	require.NoError(t, err)
@@ -60,6 +78,11 @@ func TestReportStore(t *testing.T) {
 	require.Equal(t, report.DownloadUrl, report2.DownloadUrl)
 	require.Equal(t, report.OutputFilePath, report2.OutputFilePath)
 	require.Equal(t, report.DownloadUrlExpiresAt, report2.DownloadUrlExpiresAt)
+	require.Equal(t, report.UncompressedSizeBytes, report2.UncompressedSizeBytes)
+	require.Equal(t, report.RowCount, report2.RowCount)
+	require.Equal(t, report.ContentType, report2.ContentType)
+	require.Equal(t, report.Sha256, report2.Sha256)
+	require.Equal(t, report.CompressedSizeBytes, report2.CompressedSizeBytes)
 
 	report3, err := reportStore.ByPrimaryKey(ctx, user.Id, report.Id)
 	require.NoError(t, err)
@@ -75,3 +98,344 @@ func TestReportStore(t *testing.T) {
 	require.Equal(t, report.OutputFilePath, report3.OutputFilePath)
 	require.Equal(t, report.DownloadUrlExpiresAt, report3.DownloadUrlExpiresAt)
 }
+
+func TestReportStoreDelete(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	reportStore := store.NewReportStore(env.Db)
+	userStore := store.NewUserStore(env.Db)
+	artifactDeletionStore := store.NewArtifactDeletionStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	completed, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	now := time.Now()
+	outputPath := "/users/" + user.Id.String() + "/report/" + completed.Id.String() + ".csv.gz"
+	completed.StartedAt = &now
+	completed.CompletedAt = &now
+	completed.OutputFilePath = &outputPath
+	completed, err = reportStore.Update(ctx, completed)
+	require.NoError(t, err)
+
+	processing, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	processing.StartedAt = &now
+	processing, err = reportStore.Update(ctx, processing)
+	require.NoError(t, err)
+
+	requested, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "food"})
+	require.NoError(t, err)
+
+	_, err = reportStore.Delete(ctx, user.Id, processing.Id)
+	require.ErrorIs(t, err, store.ErrReportProcessing)
+
+	deleted, err := reportStore.Delete(ctx, user.Id, completed.Id)
+	require.NoError(t, err)
+	require.Equal(t, completed.Id, deleted.Id)
+
+	_, err = reportStore.Delete(ctx, user.Id, completed.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	deletions, err := artifactDeletionStore.Claim(ctx, 10, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, deletions, 1)
+	require.Equal(t, outputPath, deletions[0].ObjectKey)
+
+	deletedReports, err := reportStore.DeleteMatching(ctx, user.Id, store.ReportFilter{ReportType: "monsters"})
+	require.NoError(t, err)
+	require.Empty(t, deletedReports)
+
+	deletedReports, err = reportStore.DeleteMatching(ctx, user.Id, store.ReportFilter{Status: "requested"})
+	require.NoError(t, err)
+	require.Len(t, deletedReports, 1)
+	require.Equal(t, requested.Id, deletedReports[0].Id)
+
+	_, err = reportStore.ByPrimaryKey(ctx, user.Id, processing.Id)
+	require.NoError(t, err)
+}
+
+func TestReportStoreExpire(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	reportStore := store.NewReportStore(env.Db)
+	userStore := store.NewUserStore(env.Db)
+	retentionStore := store.NewRetentionOverrideStore(env.Db)
+	artifactDeletionStore := store.NewArtifactDeletionStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	completedAt := time.Now().Add(-48 * time.Hour)
+	complete := func(reportType string) *store.Report {
+		report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: reportType})
+		require.NoError(t, err)
+		outputPath := "/users/" + user.Id.String() + "/report/" + report.Id.String() + ".csv.gz"
+		report.StartedAt = &completedAt
+		report.CompletedAt = &completedAt
+		report.OutputFilePath = &outputPath
+		report, err = reportStore.Update(ctx, report)
+		require.NoError(t, err)
+		return report
+	}
+
+	old := complete("monsters")
+	pinned := complete("monsters")
+	_, err = reportStore.SetPinned(ctx, user.Id, pinned.Id, true)
+	require.NoError(t, err)
+	kept := complete("food")
+	fresh, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+
+	typeRetention := map[string]time.Duration{"food": 0}
+	now := time.Now()
+	expired, err := reportStore.Expire(ctx, now, 24*time.Hour, typeRetention, 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	require.Equal(t, old.Id, expired[0].Id)
+	require.Equal(t, "expired", expired[0].Status())
+	require.Nil(t, expired[0].OutputFilePath)
+
+	deletions, err := artifactDeletionStore.Claim(ctx, 10, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, deletions, 1)
+	require.Equal(t, *old.OutputFilePath, deletions[0].ObjectKey)
+
+	// a user's override takes precedence over the retention of the report type
+	_, err = retentionStore.Set(ctx, user.Id, time.Hour)
+	require.NoError(t, err)
+	expired, err = reportStore.Expire(ctx, now, 24*time.Hour, typeRetention, 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	require.Equal(t, kept.Id, expired[0].Id)
+
+	// pinned and unfinished reports are never expired
+	for _, id := range []uuid.UUID{pinned.Id, fresh.Id} {
+		report, err := reportStore.ByPrimaryKey(ctx, user.Id, id)
+		require.NoError(t, err)
+		require.Nil(t, report.ExpiredAt)
+	}
+
+	require.NoError(t, retentionStore.Delete(ctx, user.Id))
+	_, err = retentionStore.ByUser(ctx, user.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, retentionStore.Delete(ctx, user.Id), sql.ErrNoRows)
+}
+
+func TestReportStoreExpireRetentionOverride(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	reportStore := store.NewReportStore(env.Db)
+	userStore := store.NewUserStore(env.Db)
+	retentionStore := store.NewRetentionOverrideStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+	other, err := userStore.CreateUser(ctx, "other@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	complete := func(userId uuid.UUID, completedAt time.Time) *store.Report {
+		report, err := reportStore.Create(ctx, &store.Report{UserId: userId, ReportType: "monsters"})
+		require.NoError(t, err)
+		report.StartedAt = &completedAt
+		report.CompletedAt = &completedAt
+		report, err = reportStore.Update(ctx, report)
+		require.NoError(t, err)
+		return report
+	}
+	expire := func() []uuid.UUID {
+		expired, err := reportStore.Expire(ctx, time.Now(), 24*time.Hour, nil, 10)
+		require.NoError(t, err)
+		ids := make([]uuid.UUID, 0, len(expired))
+		for _, report := range expired {
+			ids = append(ids, report.Id)
+		}
+		return ids
+	}
+
+	// an override of 0 keeps the user's reports forever while other users get the default
+	override, err := retentionStore.Set(ctx, user.Id, 0)
+	require.NoError(t, err)
+	require.Zero(t, override.Retention())
+	kept := complete(user.Id, time.Now().Add(-48*time.Hour))
+	otherOld := complete(other.Id, time.Now().Add(-48*time.Hour))
+	require.Equal(t, []uuid.UUID{otherOld.Id}, expire())
+
+	// a shorter override expires reports the default would keep
+	override, err = retentionStore.Set(ctx, user.Id, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, override.Retention())
+	recent := complete(user.Id, time.Now().Add(-2*time.Hour))
+	otherRecent := complete(other.Id, time.Now().Add(-2*time.Hour))
+	require.ElementsMatch(t, []uuid.UUID{kept.Id, recent.Id}, expire())
+
+	// without the override the default applies again
+	require.NoError(t, retentionStore.Delete(ctx, user.Id))
+	complete(user.Id, time.Now().Add(-2*time.Hour))
+	require.Empty(t, expire())
+	report, err := reportStore.ByPrimaryKey(ctx, other.Id, otherRecent.Id)
+	require.NoError(t, err)
+	require.Nil(t, report.ExpiredAt)
+}
+
+func TestReportStoreUpdateProgress(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	reportStore := store.NewReportStore(env.Db)
+	userStore := store.NewUserStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	require.Zero(t, report.RowsProcessed)
+	require.Nil(t, report.Phase)
+
+	now := time.Now()
+	phase := "writing"
+	total := int64(200)
+	report.StartedAt = &now
+	report, err = reportStore.Update(ctx, report)
+	require.NoError(t, err)
+
+	report.Phase = &phase
+	report.RowsProcessed = 50
+	report.RowsTotal = &total
+	report.HeartbeatAt = &now
+	report, err = reportStore.UpdateProgress(ctx, report)
+	require.NoError(t, err)
+	require.Equal(t, "writing", *report.Phase)
+	require.Equal(t, int64(50), report.RowsProcessed)
+	require.Equal(t, int64(200), *report.RowsTotal)
+	require.WithinDuration(t, now, *report.HeartbeatAt, time.Millisecond)
+
+	// progress of finished reports is left alone
+	report.CompletedAt = &now
+	report, err = reportStore.Update(ctx, report)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), report.RowsProcessed)
+	report.RowsProcessed = 100
+	_, err = reportStore.UpdateProgress(ctx, report)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestReportStoreFailStale(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	reportStore := store.NewReportStore(env.Db)
+	userStore := store.NewUserStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	now := time.Now()
+	longAgo := now.Add(-time.Hour)
+	create := func(startedAt *time.Time, heartbeatAt *time.Time) *store.Report {
+		report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+		require.NoError(t, err)
+		report.StartedAt = startedAt
+		report, err = reportStore.Update(ctx, report)
+		require.NoError(t, err)
+		if heartbeatAt != nil {
+			report.HeartbeatAt = heartbeatAt
+			report, err = reportStore.UpdateProgress(ctx, report)
+			require.NoError(t, err)
+		}
+		return report
+	}
+
+	queued := create(nil, nil)
+	alive := create(&longAgo, &now)
+	stale := create(&longAgo, &longAgo)
+	neverBeat := create(&longAgo, nil)
+	justStarted := create(&now, nil)
+	finished := create(&longAgo, &longAgo)
+	finished.CompletedAt = &now
+	_, err = reportStore.Update(ctx, finished)
+	require.NoError(t, err)
+
+	failed, err := reportStore.FailStale(ctx, now.Add(-time.Minute), "abandoned", 10)
+	require.NoError(t, err)
+	ids := []uuid.UUID{}
+	for _, report := range failed {
+		require.NotNil(t, report.FailedAt)
+		require.Equal(t, "abandoned", *report.ErrorMessage)
+		ids = append(ids, report.Id)
+	}
+	require.ElementsMatch(t, []uuid.UUID{stale.Id, neverBeat.Id}, ids)
+
+	for _, report := range []*store.Report{queued, alive, justStarted} {
+		report, err = reportStore.ByPrimaryKey(ctx, user.Id, report.Id)
+		require.NoError(t, err)
+		require.Nil(t, report.FailedAt)
+	}
+
+	// failed reports aren't failed again
+	failed, err = reportStore.FailStale(ctx, now.Add(-time.Minute), "abandoned", 10)
+	require.NoError(t, err)
+	require.Empty(t, failed)
+}
+
+func TestReportProgress(t *testing.T) {
+	startedAt := time.Date(2024, time.March, 4, 8, 0, 0, 0, time.UTC)
+	heartbeatAt := startedAt.Add(time.Minute)
+	total := int64(400)
+	report := &store.Report{StartedAt: &startedAt, HeartbeatAt: &heartbeatAt, RowsProcessed: 100}
+
+	require.Nil(t, report.Progress())
+	require.Nil(t, report.EstimatedCompletion())
+
+	report.RowsTotal = &total
+	require.InDelta(t, 0.25, *report.Progress(), 0.0001)
+	require.True(t, report.EstimatedCompletion().Equal(heartbeatAt.Add(3*time.Minute)))
+
+	report.CompletedAt = &heartbeatAt
+	require.Nil(t, report.EstimatedCompletion())
+}
+
+func TestReportStoreUpdatedAt(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	reportStore := store.NewReportStore(env.Db)
+	userStore := store.NewUserStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	report, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	require.Equal(t, report.CreatedAt, report.UpdatedAt)
+
+	now := time.Now()
+	report.StartedAt = &now
+	report.CompletedAt = &now
+	updated, err := reportStore.Update(ctx, report)
+	require.NoError(t, err)
+	require.True(t, updated.UpdatedAt.After(report.UpdatedAt))
+
+	// refreshing the download url isn't a change of the report
+	expiresAt := now.Add(time.Hour)
+	refreshed, err := reportStore.SetDownloadUrl(ctx, user.Id, report.Id, "http://localhost/report.csv", expiresAt)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost/report.csv", *refreshed.DownloadUrl)
+	require.WithinDuration(t, expiresAt, *refreshed.DownloadUrlExpiresAt, time.Millisecond)
+	require.Equal(t, updated.UpdatedAt, refreshed.UpdatedAt)
+
+	pinned, err := reportStore.SetPinned(ctx, user.Id, report.Id, true)
+	require.NoError(t, err)
+	require.True(t, pinned.UpdatedAt.After(refreshed.UpdatedAt))
+}
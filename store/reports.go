@@ -3,14 +3,20 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
 )
 
+var ErrReportProcessing = errors.New("report is still processing")
+
 type ReportStore struct {
 	db *sqlx.DB
 }
@@ -22,17 +28,44 @@ func NewReportStore(db *sql.DB) *ReportStore {
 }
 
 type Report struct {
-	UserId               uuid.UUID  `db:"user_id"`
-	Id                   uuid.UUID  `db:"id"`
-	ReportType           string     `db:"report_type"`
-	OutputFilePath       *string    `db:"output_file_path"`
-	DownloadUrl          *string    `db:"download_url"`
-	DownloadUrlExpiresAt *time.Time `db:"download_url_expires_at"`
-	ErrorMessage         *string    `db:"error_message"`
-	CreatedAt            time.Time  `db:"created_at"`
-	StartedAt            *time.Time `db:"started_at"`
-	CompletedAt          *time.Time `db:"completed_at"`
-	FailedAt             *time.Time `db:"failed_at"`
+	UserId                uuid.UUID      `db:"user_id"`
+	Id                    uuid.UUID      `db:"id"`
+	ReportType            string         `db:"report_type"`
+	OutputFilePath        *string        `db:"output_file_path"`
+	DownloadUrl           *string        `db:"download_url"`
+	DownloadUrlExpiresAt  *time.Time     `db:"download_url_expires_at"`
+	ErrorMessage          *string        `db:"error_message"`
+	CreatedAt             time.Time      `db:"created_at"`
+	StartedAt             *time.Time     `db:"started_at"`
+	CompletedAt           *time.Time     `db:"completed_at"`
+	FailedAt              *time.Time     `db:"failed_at"`
+	Parameters            types.JSONText `db:"parameters"`
+	OutputFormat          string         `db:"output_format"`
+	Compression           string         `db:"compression"`
+	CompressionLevel      *int           `db:"compression_level"`
+	UncompressedSizeBytes *int64         `db:"uncompressed_size_bytes"`
+	CompressedSizeBytes   *int64         `db:"compressed_size_bytes"`
+	CallbackUrl           *string        `db:"callback_url"`
+	ScheduleId            *uuid.UUID     `db:"schedule_id"`
+	BatchId               *uuid.UUID     `db:"batch_id"`
+	TemplateId            *uuid.UUID     `db:"template_id"`
+	Pinned                bool           `db:"pinned"`
+	ExpiredAt             *time.Time     `db:"expired_at"`
+	RowsProcessed         int64          `db:"rows_processed"`
+	RowsTotal             *int64         `db:"rows_total"`
+	Phase                 *string        `db:"phase"`
+	HeartbeatAt           *time.Time     `db:"heartbeat_at"`
+	Priority              string         `db:"priority"`
+	RowCount              *int64         `db:"row_count"`
+	ContentType           *string        `db:"content_type"`
+	Sha256                *string        `db:"sha256"`
+	UpdatedAt             time.Time      `db:"updated_at"`
+	Title                 *string        `db:"title"`
+	Description           *string        `db:"description"`
+	Tags                  pq.StringArray `db:"tags"`
+	Fingerprint           *string        `db:"fingerprint"`
+	SkipCache             bool           `db:"skip_cache"`
+	CacheHit              bool           `db:"cache_hit"`
 }
 
 func (r *Report) IsDone() bool {
@@ -41,6 +74,8 @@ func (r *Report) IsDone() bool {
 
 func (r *Report) Status() string {
 	switch {
+	case r.ExpiredAt != nil:
+		return "expired"
 	case r.StartedAt == nil:
 		return "requested"
 	case r.StartedAt != nil && !r.IsDone():
@@ -53,14 +88,85 @@ func (r *Report) Status() string {
 	return "unknown"
 }
 
-func (s *ReportStore) Create(ctx context.Context, userId uuid.UUID, reportType string) (*Report, error) {
-	const insert = `INSERT INTO reports (user_id, report_type) VALUES ($1, $2) RETURNING *`
-	var report Report
-	if err := s.db.GetContext(ctx, &report, insert, userId, reportType); err != nil {
-		return nil, fmt.Errorf("failed to insert report for user %s: %w", userId, err)
+// Progress returns the fraction of rows processed, or nil while the total number of rows isn't known.
+func (r *Report) Progress() *float64 {
+	if r.RowsTotal == nil {
+		return nil
+	}
+	progress := 1.0
+	if *r.RowsTotal > 0 {
+		progress = min(float64(r.RowsProcessed)/float64(*r.RowsTotal), 1)
+	}
+	return &progress
+}
+
+// EstimatedCompletion extrapolates when a report being built will be done, assuming the remaining rows
+// take as long as the ones processed since it started. It is nil until there is a rate to go by.
+func (r *Report) EstimatedCompletion() *time.Time {
+	if r.IsDone() || r.StartedAt == nil || r.HeartbeatAt == nil || r.RowsTotal == nil || r.RowsProcessed == 0 {
+		return nil
 	}
+	elapsed := r.HeartbeatAt.Sub(*r.StartedAt)
+	remaining := max(*r.RowsTotal-r.RowsProcessed, 0)
+	estimate := r.HeartbeatAt.Add(time.Duration(float64(elapsed) * float64(remaining) / float64(r.RowsProcessed)))
+	return &estimate
+}
 
-	return &report, nil
+func (s *ReportStore) Create(ctx context.Context, report *Report) (*Report, error) {
+	return createReport(ctx, s.db, report)
+}
+
+// CreateWithinQuota creates a report once check accepted the user's usage, see checkQuota.
+func (s *ReportStore) CreateWithinQuota(ctx context.Context, report *Report, check QuotaCheck) (*Report, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkQuota(ctx, tx, report.UserId, check); err != nil {
+		return nil, err
+	}
+	created, err := createReport(ctx, tx, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit report for user %s: %w", report.UserId, err)
+	}
+
+	return created, nil
+}
+
+func createReport(ctx context.Context, q sqlx.QueryerContext, report *Report) (*Report, error) {
+	const insert = `WITH created AS (
+                   INSERT INTO reports (user_id, report_type, parameters, output_format, compression, compression_level, callback_url, template_id, batch_id, priority, title, description, tags, skip_cache)
+                   VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), 'csv'), COALESCE(NULLIF($5, ''), 'gzip'), $6, $7, $8, $9, COALESCE(NULLIF($10, ''), 'normal'), $11, $12, COALESCE($13::TEXT[], '{}'), $14) RETURNING *
+               ), logged AS (
+                   INSERT INTO report_creations (user_id, created_at) SELECT user_id, created_at FROM created
+               )
+               SELECT * FROM created`
+	var created Report
+	if err := sqlx.GetContext(ctx, q, &created, insert,
+		report.UserId,
+		report.ReportType,
+		report.Parameters,
+		report.OutputFormat,
+		report.Compression,
+		report.CompressionLevel,
+		report.CallbackUrl,
+		report.TemplateId,
+		report.BatchId,
+		report.Priority,
+		report.Title,
+		report.Description,
+		report.Tags,
+		report.SkipCache); err != nil {
+		return nil, fmt.Errorf("failed to insert report for user %s: %w", report.UserId, err)
+	}
+
+	return &created, nil
 }
 
 func (s *ReportStore) Update(ctx context.Context, report *Report) (*Report, error) {
@@ -71,8 +177,15 @@ func (s *ReportStore) Update(ctx context.Context, report *Report) (*Report, erro
                    error_message = $4,
                    started_at = $5,
                    completed_at = $6,
-                   failed_at = $7
-                   WHERE user_id = $8 AND id = $9 RETURNING *`
+                   failed_at = $7,
+                   uncompressed_size_bytes = $8,
+                   compressed_size_bytes = $9,
+                   row_count = $10,
+                   content_type = $11,
+                   sha256 = $12,
+                   fingerprint = $13,
+                   updated_at = CURRENT_TIMESTAMP
+                   WHERE user_id = $14 AND id = $15 RETURNING *`
 
 	var updated Report
 
@@ -84,6 +197,12 @@ func (s *ReportStore) Update(ctx context.Context, report *Report) (*Report, erro
 		report.StartedAt,
 		report.CompletedAt,
 		report.FailedAt,
+		report.UncompressedSizeBytes,
+		report.CompressedSizeBytes,
+		report.RowCount,
+		report.ContentType,
+		report.Sha256,
+		report.Fingerprint,
 		report.UserId,
 		report.Id); err != nil {
 		return nil, fmt.Errorf("failed to update report %s for user %s: %w", report.Id, report.UserId, err)
@@ -92,6 +211,67 @@ func (s *ReportStore) Update(ctx context.Context, report *Report) (*Report, erro
 	return &updated, nil
 }
 
+// UpdateProgress stores the progress of a report that is being built. Reports that already completed or
+// failed are left alone, in which case sql.ErrNoRows is returned.
+func (s *ReportStore) UpdateProgress(ctx context.Context, report *Report) (*Report, error) {
+	const update = `UPDATE reports SET
+                   rows_processed = $1,
+                   rows_total = $2,
+                   phase = $3,
+                   heartbeat_at = $4,
+                   updated_at = CURRENT_TIMESTAMP
+                   WHERE user_id = $5 AND id = $6 AND completed_at IS NULL AND failed_at IS NULL RETURNING *`
+
+	var updated Report
+	if err := s.db.GetContext(ctx, &updated, update,
+		report.RowsProcessed,
+		report.RowsTotal,
+		report.Phase,
+		report.HeartbeatAt,
+		report.UserId,
+		report.Id); err != nil {
+		return nil, fmt.Errorf("failed to update progress of report %s for user %s: %w", report.Id, report.UserId, err)
+	}
+
+	return &updated, nil
+}
+
+// FailStale fails up to limit reports that are being built but haven't stored a heartbeat since
+// heartbeatBefore, because their worker crashed or was stopped, so they stop counting as in flight.
+func (s *ReportStore) FailStale(ctx context.Context, heartbeatBefore time.Time, errorMessage string, limit int) ([]Report, error) {
+	const update = `UPDATE reports SET
+                   failed_at = CURRENT_TIMESTAMP,
+                   error_message = $2,
+                   updated_at = CURRENT_TIMESTAMP
+                   WHERE id IN (
+                       SELECT id FROM reports
+                       WHERE started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL
+                       AND COALESCE(heartbeat_at, started_at) < $1
+                       ORDER BY COALESCE(heartbeat_at, started_at)
+                       LIMIT $3
+                       FOR UPDATE SKIP LOCKED
+                   ) AND completed_at IS NULL AND failed_at IS NULL
+                   RETURNING *`
+
+	var failed []Report
+	if err := s.db.SelectContext(ctx, &failed, update, heartbeatBefore, errorMessage, limit); err != nil {
+		return nil, fmt.Errorf("failed to fail stale reports: %w", err)
+	}
+	return failed, nil
+}
+
+// SetDownloadUrl stores a new presigned url of a report's file. Unlike Update it leaves updated_at alone,
+// since refreshing the url doesn't change the report.
+func (s *ReportStore) SetDownloadUrl(ctx context.Context, userId uuid.UUID, id uuid.UUID, downloadUrl string, expiresAt time.Time) (*Report, error) {
+	const update = `UPDATE reports SET download_url = $1, download_url_expires_at = $2 WHERE user_id = $3 AND id = $4 RETURNING *`
+	var report Report
+	if err := s.db.GetContext(ctx, &report, update, downloadUrl, expiresAt, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to set download url of report %s for user %s: %w", id, userId, err)
+	}
+
+	return &report, nil
+}
+
 func (s *ReportStore) ByPrimaryKey(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*Report, error) {
 	const query = `SELECT * FROM reports WHERE user_id = $1 AND id = $2`
 	var report Report
@@ -101,3 +281,260 @@ func (s *ReportStore) ByPrimaryKey(ctx context.Context, userId uuid.UUID, id uui
 
 	return &report, nil
 }
+
+// reportNotProcessing matches reports that are safe to remove: either not yet picked up by a worker or already done.
+const reportNotProcessing = `(started_at IS NULL OR completed_at IS NOT NULL OR failed_at IS NOT NULL)`
+
+// reportStatusCondition matches the reports whose Status is status.
+func reportStatusCondition(status string) (string, error) {
+	switch status {
+	case "requested":
+		return "started_at IS NULL", nil
+	case "processing":
+		return "started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL", nil
+	case "completed":
+		return "completed_at IS NOT NULL AND expired_at IS NULL", nil
+	case "failed":
+		return "failed_at IS NOT NULL AND completed_at IS NULL AND expired_at IS NULL", nil
+	case "expired":
+		return "expired_at IS NOT NULL", nil
+	}
+	return "", fmt.Errorf("unknown report status %q", status)
+}
+
+// releaseFiles drops a reference to the output file of each of the reports and queues the files no report
+// references anymore for deletion from storage. Files shared through the cache have a row in artifacts
+// counting their reports, other files only belong to the report. It must run as its own statement after the
+// reports were deleted or expired in tx: a statement's snapshot is taken before it waits for row locks, so a
+// reference added by CompleteFromCache while it held the report's lock is only visible to a later statement.
+func releaseFiles(ctx context.Context, tx *sqlx.Tx, paths []string) error {
+	const release = `WITH released_files AS (
+                   SELECT unnest($1::TEXT[]) AS output_file_path
+               ), released AS (
+                   UPDATE artifacts SET ref_count = artifacts.ref_count - counts.count
+                   FROM (
+                       SELECT output_file_path, COUNT(*) AS count FROM released_files GROUP BY output_file_path
+                   ) counts
+                   WHERE artifacts.object_key = counts.output_file_path
+                   RETURNING artifacts.object_key, artifacts.ref_count
+               )
+               INSERT INTO artifact_deletions (object_key)
+               SELECT DISTINCT output_file_path FROM released_files
+               WHERE output_file_path NOT IN (SELECT object_key FROM released WHERE ref_count > 0)`
+	if len(paths) == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, release, pq.StringArray(paths)); err != nil {
+		return fmt.Errorf("failed to release report files: %w", err)
+	}
+
+	return nil
+}
+
+// outputFilePaths returns the output files of the reports that have one.
+func outputFilePaths(reports ...Report) []string {
+	var paths []string
+	for _, report := range reports {
+		if report.OutputFilePath != nil {
+			paths = append(paths, *report.OutputFilePath)
+		}
+	}
+	return paths
+}
+
+// Delete removes the report and queues its output file for deletion from storage in the same transaction,
+// unless other reports still use the file. It returns ErrReportProcessing if a worker is currently
+// building the report.
+func (s *ReportStore) Delete(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*Report, error) {
+	const deleteStatement = `DELETE FROM reports WHERE user_id = $1 AND id = $2 AND ` + reportNotProcessing + ` RETURNING *`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var report Report
+	if err := tx.GetContext(ctx, &report, deleteStatement, userId, id); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to delete report %s for user %s: %w", id, userId, err)
+		}
+		if _, err := s.ByPrimaryKey(ctx, userId, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrReportProcessing
+	}
+
+	if err := releaseFiles(ctx, tx, outputFilePaths(report)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit deletion of report %s: %w", id, err)
+	}
+
+	return &report, nil
+}
+
+type ReportFilter struct {
+	Status        string
+	ReportType    string
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+}
+
+// conditions adds the filter's conditions to the ones given, appending their arguments to args.
+func (f ReportFilter) conditions(conditions []string, args []any) ([]string, []any, error) {
+	if f.Status != "" {
+		condition, err := reportStatusCondition(f.Status)
+		if err != nil {
+			return nil, nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	if f.ReportType != "" {
+		args = append(args, f.ReportType)
+		conditions = append(conditions, fmt.Sprintf("report_type = $%d", len(args)))
+	}
+	if f.CreatedBefore != nil {
+		args = append(args, *f.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if f.CreatedAfter != nil {
+		args = append(args, *f.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at > $%d", len(args)))
+	}
+	return conditions, args, nil
+}
+
+// DeleteMatching removes every report of the user matching the filter, skipping reports that are still processing.
+func (s *ReportStore) DeleteMatching(ctx context.Context, userId uuid.UUID, filter ReportFilter) ([]Report, error) {
+	conditions, args, err := filter.conditions([]string{"user_id = $1", reportNotProcessing}, []any{userId})
+	if err != nil {
+		return nil, err
+	}
+
+	deleteStatement := `DELETE FROM reports WHERE ` + strings.Join(conditions, " AND ") + ` RETURNING *`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deleted []Report
+	if err := tx.SelectContext(ctx, &deleted, deleteStatement, args...); err != nil {
+		return nil, fmt.Errorf("failed to delete reports for user %s: %w", userId, err)
+	}
+
+	if err := releaseFiles(ctx, tx, outputFilePaths(deleted...)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit deletion of reports for user %s: %w", userId, err)
+	}
+
+	return deleted, nil
+}
+
+// SetPinned pins or unpins a report. Pinned reports are never expired.
+func (s *ReportStore) SetPinned(ctx context.Context, userId uuid.UUID, id uuid.UUID, pinned bool) (*Report, error) {
+	const update = `UPDATE reports SET pinned = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2 AND id = $3 RETURNING *`
+	var report Report
+	if err := s.db.GetContext(ctx, &report, update, pinned, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to pin report %s for user %s: %w", id, userId, err)
+	}
+
+	return &report, nil
+}
+
+// SetMetadata stores the report's title, description and tags, the parts of a report its owner can change.
+func (s *ReportStore) SetMetadata(ctx context.Context, report *Report) (*Report, error) {
+	const update = `UPDATE reports SET
+                   title = $1,
+                   description = $2,
+                   tags = COALESCE($3::TEXT[], '{}'),
+                   updated_at = CURRENT_TIMESTAMP
+                   WHERE user_id = $4 AND id = $5 RETURNING *`
+	var updated Report
+	if err := s.db.GetContext(ctx, &updated, update,
+		report.Title,
+		report.Description,
+		report.Tags,
+		report.UserId,
+		report.Id); err != nil {
+		return nil, fmt.Errorf("failed to set metadata of report %s for user %s: %w", report.Id, report.UserId, err)
+	}
+
+	return &updated, nil
+}
+
+// Expire marks up to limit unpinned reports finished longer than their retention ago as expired and queues
+// their output files for deletion. A user's retention override takes precedence over the retention of the
+// report type, which takes precedence over defaultRetention. A retention of 0 keeps reports forever.
+func (s *ReportStore) Expire(ctx context.Context, now time.Time, defaultRetention time.Duration, typeRetention map[string]time.Duration, limit int) ([]Report, error) {
+	const update = `WITH candidates AS (
+                   SELECT reports.user_id, reports.id, reports.output_file_path FROM reports
+                   LEFT JOIN retention_overrides overrides ON overrides.user_id = reports.user_id
+                   CROSS JOIN LATERAL (
+                       SELECT COALESCE(overrides.retention_seconds, ($1::JSONB ->> reports.report_type)::BIGINT, $2) AS seconds
+                   ) retention
+                   WHERE reports.expired_at IS NULL AND NOT reports.pinned
+                   AND (reports.completed_at IS NOT NULL OR reports.failed_at IS NOT NULL)
+                   AND retention.seconds > 0
+                   AND COALESCE(reports.completed_at, reports.failed_at) < $3 - make_interval(secs => retention.seconds)
+                   LIMIT $4
+                   FOR UPDATE OF reports SKIP LOCKED
+               ), expired AS (
+                   UPDATE reports SET
+                   expired_at = $3,
+                   updated_at = $3,
+                   output_file_path = NULL,
+                   download_url = NULL,
+                   download_url_expires_at = NULL
+                   FROM candidates
+                   WHERE reports.user_id = candidates.user_id AND reports.id = candidates.id
+                   RETURNING reports.*
+               )
+               SELECT expired.*, candidates.output_file_path AS released_file_path
+               FROM expired JOIN candidates ON candidates.user_id = expired.user_id AND candidates.id = expired.id`
+
+	typeRetentionSeconds := make(map[string]int64, len(typeRetention))
+	for reportType, retention := range typeRetention {
+		typeRetentionSeconds[reportType] = int64(retention.Seconds())
+	}
+	typeRetentionJson, err := json.Marshal(typeRetentionSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report type retention: %w", err)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rows []struct {
+		Report
+		ReleasedFilePath *string `db:"released_file_path"`
+	}
+	if err := tx.SelectContext(ctx, &rows, update, string(typeRetentionJson), int64(defaultRetention.Seconds()), now, limit); err != nil {
+		return nil, fmt.Errorf("failed to expire reports: %w", err)
+	}
+
+	expired := make([]Report, 0, len(rows))
+	var paths []string
+	for _, row := range rows {
+		expired = append(expired, row.Report)
+		if row.ReleasedFilePath != nil {
+			paths = append(paths, *row.ReleasedFilePath)
+		}
+	}
+	if err := releaseFiles(ctx, tx, paths); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit expired reports: %w", err)
+	}
+
+	return expired, nil
+}
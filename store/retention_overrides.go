@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// RetentionOverrideStore holds per user report retention that replaces the configured retention. Users don't
+// belong to organizations, so there is no organization level between a user and the configured defaults.
+type RetentionOverrideStore struct {
+	db *sqlx.DB
+}
+
+func NewRetentionOverrideStore(db *sql.DB) *RetentionOverrideStore {
+	return &RetentionOverrideStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type RetentionOverride struct {
+	UserId           uuid.UUID `db:"user_id"`
+	RetentionSeconds int64     `db:"retention_seconds"`
+	CreatedAt        time.Time `db:"created_at"`
+	UpdatedAt        time.Time `db:"updated_at"`
+}
+
+func (o *RetentionOverride) Retention() time.Duration {
+	return time.Duration(o.RetentionSeconds) * time.Second
+}
+
+// Set overrides the retention of the user's reports. A retention of 0 keeps them forever.
+func (s *RetentionOverrideStore) Set(ctx context.Context, userId uuid.UUID, retention time.Duration) (*RetentionOverride, error) {
+	const upsert = `INSERT INTO retention_overrides (user_id, retention_seconds) VALUES ($1, $2)
+                   ON CONFLICT (user_id) DO UPDATE SET retention_seconds = EXCLUDED.retention_seconds, updated_at = CURRENT_TIMESTAMP
+                   RETURNING *`
+	var override RetentionOverride
+	if err := s.db.GetContext(ctx, &override, upsert, userId, int64(retention.Seconds())); err != nil {
+		return nil, fmt.Errorf("failed to set retention override for user %s: %w", userId, err)
+	}
+
+	return &override, nil
+}
+
+func (s *RetentionOverrideStore) ByUser(ctx context.Context, userId uuid.UUID) (*RetentionOverride, error) {
+	const query = `SELECT * FROM retention_overrides WHERE user_id = $1`
+	var override RetentionOverride
+	if err := s.db.GetContext(ctx, &override, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to query retention override for user %s: %w", userId, err)
+	}
+
+	return &override, nil
+}
+
+// Delete removes the user's override, so their reports are kept for the configured retention again. It returns
+// sql.ErrNoRows when the user has no override.
+func (s *RetentionOverrideStore) Delete(ctx context.Context, userId uuid.UUID) error {
+	const deleteStatement = `DELETE FROM retention_overrides WHERE user_id = $1 RETURNING user_id`
+	var deletedId uuid.UUID
+	if err := s.db.GetContext(ctx, &deletedId, deleteStatement, userId); err != nil {
+		return fmt.Errorf("failed to delete retention override for user %s: %w", userId, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// ErrShareLinkInactive is returned for share links that were revoked, expired or used up.
+var ErrShareLinkInactive = errors.New("share link is no longer active")
+
+// ShareLinkStore holds public links to a report's file. Only a hash of a link's token is stored.
+type ShareLinkStore struct {
+	db *sqlx.DB
+}
+
+func NewShareLinkStore(db *sql.DB) *ShareLinkStore {
+	return &ShareLinkStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type ShareLink struct {
+	Id            uuid.UUID  `db:"id"`
+	UserId        uuid.UUID  `db:"user_id"`
+	ReportId      uuid.UUID  `db:"report_id"`
+	HashedToken   string     `db:"hashed_token"`
+	ExpiresAt     time.Time  `db:"expires_at"`
+	MaxDownloads  *int       `db:"max_downloads"`
+	DownloadCount int        `db:"download_count"`
+	RevokedAt     *time.Time `db:"revoked_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores a link to the report that can be used with token.
+func (s *ShareLinkStore) Create(ctx context.Context, link *ShareLink, token string) (*ShareLink, error) {
+	const insert = `INSERT INTO share_links (user_id, report_id, hashed_token, expires_at, max_downloads)
+                   VALUES ($1, $2, $3, $4, $5) RETURNING *`
+	var created ShareLink
+	if err := s.db.GetContext(ctx, &created, insert,
+		link.UserId,
+		link.ReportId,
+		hashShareToken(token),
+		link.ExpiresAt,
+		link.MaxDownloads); err != nil {
+		return nil, fmt.Errorf("failed to insert share link of report %s: %w", link.ReportId, err)
+	}
+
+	return &created, nil
+}
+
+func (s *ShareLinkStore) ByReport(ctx context.Context, userId uuid.UUID, reportId uuid.UUID) ([]ShareLink, error) {
+	const query = `SELECT * FROM share_links WHERE user_id = $1 AND report_id = $2 ORDER BY created_at`
+	var links []ShareLink
+	if err := s.db.SelectContext(ctx, &links, query, userId, reportId); err != nil {
+		return nil, fmt.Errorf("failed to query share links of report %s: %w", reportId, err)
+	}
+
+	return links, nil
+}
+
+func (s *ShareLinkStore) ByToken(ctx context.Context, token string) (*ShareLink, error) {
+	const query = `SELECT * FROM share_links WHERE hashed_token = $1`
+	var link ShareLink
+	if err := s.db.GetContext(ctx, &link, query, hashShareToken(token)); err != nil {
+		return nil, fmt.Errorf("failed to query share link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// Revoke stops a link from being used. Revoking a revoked link keeps its original revocation time.
+func (s *ShareLinkStore) Revoke(ctx context.Context, userId uuid.UUID, reportId uuid.UUID, id uuid.UUID) (*ShareLink, error) {
+	const update = `UPDATE share_links SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+                   WHERE user_id = $1 AND report_id = $2 AND id = $3 RETURNING *`
+	var link ShareLink
+	if err := s.db.GetContext(ctx, &link, update, userId, reportId, id); err != nil {
+		return nil, fmt.Errorf("failed to revoke share link %s: %w", id, err)
+	}
+
+	return &link, nil
+}
+
+// Use counts a download through the link. The check and the count are one statement, so concurrent
+// downloads can't go over the link's limit. ErrShareLinkInactive is returned if the link can't be used
+// anymore.
+func (s *ShareLinkStore) Use(ctx context.Context, id uuid.UUID, now time.Time) (*ShareLink, error) {
+	const update = `UPDATE share_links SET download_count = download_count + 1
+                   WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2
+                   AND (max_downloads IS NULL OR download_count < max_downloads)
+                   RETURNING *`
+	var link ShareLink
+	if err := s.db.GetContext(ctx, &link, update, id, now); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrShareLinkInactive
+		}
+		return nil, fmt.Errorf("failed to use share link %s: %w", id, err)
+	}
+
+	return &link, nil
+}
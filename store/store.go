@@ -6,6 +6,17 @@ type Store struct {
 	Users             *UserStore
 	RefreshTokenStore *RefreshTokenStore
 	ReportStore       *ReportStore
+	ArtifactDeletions *ArtifactDeletionStore
+	IdempotencyKeys   *IdempotencyKeyStore
+	WebhookEndpoints  *WebhookEndpointStore
+	WebhookEvents     *WebhookEventStore
+	ReportSchedules   *ReportScheduleStore
+	Retention         *RetentionOverrideStore
+	ReportBatches     *ReportBatchStore
+	ReportTemplates   *ReportTemplateStore
+	ReportGrants      *ReportGrantStore
+	ShareLinks        *ShareLinkStore
+	ReportAccessLog   *ReportAccessLogStore
 }
 
 func New(db *sql.DB) *Store {
@@ -13,5 +24,16 @@ func New(db *sql.DB) *Store {
 		Users:             NewUserStore(db),
 		RefreshTokenStore: NewRefreshTokenStore(db),
 		ReportStore:       NewReportStore(db),
+		ArtifactDeletions: NewArtifactDeletionStore(db),
+		IdempotencyKeys:   NewIdempotencyKeyStore(db),
+		WebhookEndpoints:  NewWebhookEndpointStore(db),
+		WebhookEvents:     NewWebhookEventStore(db),
+		ReportSchedules:   NewReportScheduleStore(db),
+		Retention:         NewRetentionOverrideStore(db),
+		ReportBatches:     NewReportBatchStore(db),
+		ReportTemplates:   NewReportTemplateStore(db),
+		ReportGrants:      NewReportGrantStore(db),
+		ShareLinks:        NewShareLinkStore(db),
+		ReportAccessLog:   NewReportAccessLogStore(db),
 	}
 }
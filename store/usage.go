@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Usage is what a user's reports count against their quotas.
+type Usage struct {
+	InFlight        int64      `db:"in_flight"`
+	StoredBytes     int64      `db:"stored_bytes"`
+	CreatedLastHour int64      `db:"created_last_hour"`
+	CreatedLastDay  int64      `db:"created_last_day"`
+	OldestLastHour  *time.Time `db:"oldest_last_hour"`
+	OldestLastDay   *time.Time `db:"oldest_last_day"`
+}
+
+// Usage counts the user's reports that aren't done, the bytes of their stored report files and the reports
+// they created in the hour and day before now. Creations are counted from report_creations, so they still
+// count after the report is deleted. Reports whose worker died stop counting as in flight once FailStale
+// failed them.
+func (s *ReportStore) Usage(ctx context.Context, userId uuid.UUID, now time.Time) (*Usage, error) {
+	return queryUsage(ctx, s.db, userId, now)
+}
+
+func queryUsage(ctx context.Context, q sqlx.QueryerContext, userId uuid.UUID, now time.Time) (*Usage, error) {
+	const query = `SELECT
+                   (SELECT COUNT(*) FROM reports WHERE user_id = $1 AND completed_at IS NULL AND failed_at IS NULL) AS in_flight,
+                   (SELECT COALESCE(SUM(compressed_size_bytes), 0) FROM reports WHERE user_id = $1 AND expired_at IS NULL) AS stored_bytes,
+                   COUNT(*) FILTER (WHERE created_at > $2::TIMESTAMPTZ - INTERVAL '1 hour') AS created_last_hour,
+                   COUNT(*) AS created_last_day,
+                   MIN(created_at) FILTER (WHERE created_at > $2::TIMESTAMPTZ - INTERVAL '1 hour') AS oldest_last_hour,
+                   MIN(created_at) AS oldest_last_day
+                   FROM report_creations WHERE user_id = $1 AND created_at > $2::TIMESTAMPTZ - INTERVAL '1 day'`
+	var usage Usage
+	if err := sqlx.GetContext(ctx, q, &usage, query, userId, now); err != nil {
+		return nil, fmt.Errorf("failed to query usage for user %s: %w", userId, err)
+	}
+
+	return &usage, nil
+}
+
+// QuotaCheck decides from a user's usage whether reports may be created for them. An error stops the
+// creation and is returned as is.
+type QuotaCheck func(usage *Usage) error
+
+// checkQuota holds the user's creation lock until tx ends and runs check against the usage read after
+// taking it, so concurrent creations for one user are checked one after the other and each one counts
+// the reports created by the previous ones. A nil check skips both.
+func checkQuota(ctx context.Context, tx *sqlx.Tx, userId uuid.UUID, check QuotaCheck) error {
+	if check == nil {
+		return nil
+	}
+	usage, err := lockUsage(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+	return check(usage)
+}
+
+// lockUsage takes the user's creation lock for the rest of tx and reads their usage.
+func lockUsage(ctx context.Context, tx *sqlx.Tx, userId uuid.UUID) (*Usage, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1::TEXT))`, userId); err != nil {
+		return nil, fmt.Errorf("failed to lock report creations of user %s: %w", userId, err)
+	}
+	return queryUsage(ctx, tx, userId, time.Now())
+}
+
+// PruneCreations deletes the report creations older than before, they no longer count against any limit.
+func (s *ReportStore) PruneCreations(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM report_creations WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune report creations: %w", err)
+	}
+	pruned, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pruned report creations: %w", err)
+	}
+
+	return pruned, nil
+}
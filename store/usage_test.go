@@ -0,0 +1,147 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportStoreUsage(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	usage, err := reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, store.Usage{}, *usage)
+
+	done, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	now := time.Now()
+	size := int64(1024)
+	done.StartedAt = &now
+	done.CompletedAt = &now
+	done.CompressedSizeBytes = &size
+	_, err = reportStore.Update(ctx, done)
+	require.NoError(t, err)
+
+	inFlight, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+
+	usage, err = reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, usage.InFlight)
+	require.EqualValues(t, 1024, usage.StoredBytes)
+	require.EqualValues(t, 2, usage.CreatedLastHour)
+	require.EqualValues(t, 2, usage.CreatedLastDay)
+	require.NotNil(t, usage.OldestLastHour)
+
+	// deleted reports still count as created
+	_, err = reportStore.Delete(ctx, user.Id, inFlight.Id)
+	require.NoError(t, err)
+	usage, err = reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 0, usage.InFlight)
+	require.EqualValues(t, 2, usage.CreatedLastHour)
+
+	// a report whose worker died counts as in flight until it is failed
+	abandoned, err := reportStore.Create(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"})
+	require.NoError(t, err)
+	startedAt := time.Now().Add(-time.Hour)
+	abandoned.StartedAt = &startedAt
+	_, err = reportStore.Update(ctx, abandoned)
+	require.NoError(t, err)
+	usage, err = reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, usage.InFlight)
+	_, err = reportStore.FailStale(ctx, time.Now().Add(-time.Minute), "abandoned", 10)
+	require.NoError(t, err)
+	usage, err = reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 0, usage.InFlight)
+
+	// creations leave the hourly window before the daily one
+	usage, err = reportStore.Usage(ctx, user.Id, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 0, usage.CreatedLastHour)
+	require.Nil(t, usage.OldestLastHour)
+	require.EqualValues(t, 3, usage.CreatedLastDay)
+
+	pruned, err := reportStore.PruneCreations(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.EqualValues(t, 3, pruned)
+	usage, err = reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 0, usage.CreatedLastDay)
+}
+
+func TestReportStoreCreateWithinQuota(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	batchStore := store.NewReportBatchStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	errOverQuota := errors.New("over quota")
+	atMost := func(limit int64) store.QuotaCheck {
+		return func(usage *store.Usage) error {
+			if usage.InFlight >= limit {
+				return errOverQuota
+			}
+			return nil
+		}
+	}
+
+	// concurrent creations are checked one after the other, so only the first three fit
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := reportStore.CreateWithinQuota(ctx, &store.Report{UserId: user.Id, ReportType: "monsters"}, atMost(3))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.ErrorIs(t, err, errOverQuota)
+	}
+	require.Equal(t, 3, created)
+
+	usage, err := reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 3, usage.InFlight)
+	require.EqualValues(t, 3, usage.CreatedLastHour)
+
+	// a rejected batch creates nothing
+	_, _, err = batchStore.Create(ctx, user.Id, []*store.Report{{ReportType: "monsters"}}, atMost(3))
+	require.ErrorIs(t, err, errOverQuota)
+	usage, err = reportStore.Usage(ctx, user.Id, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 3, usage.InFlight)
+}
@@ -28,6 +28,7 @@ type User struct {
 	Email                string    `db:"email"`
 	HashedPasswordBase64 string    `db:"hashed_password"`
 	CreatedAt            time.Time `db:"created_at"`
+	Role                 string    `db:"role"`
 }
 
 func (u *User) ComparePassword(password string) error {
@@ -65,6 +66,16 @@ func (s *UserStore) ByEmail(ctx context.Context, email string) (*User, error) {
 	return &user, nil
 }
 
+// SetRole changes the user's role, which decides e.g. the report priorities they may use.
+func (s *UserStore) SetRole(ctx context.Context, id uuid.UUID, role string) (*User, error) {
+	const dml = `UPDATE users SET role = $1 WHERE id = $2 RETURNING *`
+	var user User
+	if err := s.db.GetContext(ctx, &user, dml, role, id); err != nil {
+		return nil, fmt.Errorf("error setting role of user %s: %w", id, err)
+	}
+	return &user, nil
+}
+
 func (s *UserStore) ById(ctx context.Context, uuid uuid.UUID) (*User, error) {
 	const query = `SELECT * FROM users WHERE id = $1`
 	var user User
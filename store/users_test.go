@@ -44,4 +44,8 @@ func TestUserStore(t *testing.T) {
 	require.Equal(t, user.HashedPasswordBase64, user3.HashedPasswordBase64)
 	require.Equal(t, user.CreatedAt.UnixNano(), user3.CreatedAt.UnixNano())
 
+	require.Equal(t, "standard", user.Role)
+	admin, err := userStore.SetRole(ctx, user.Id, "admin")
+	require.NoError(t, err)
+	require.Equal(t, "admin", admin.Role)
 }
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type WebhookEndpointStore struct {
+	db *sqlx.DB
+}
+
+func NewWebhookEndpointStore(db *sql.DB) *WebhookEndpointStore {
+	return &WebhookEndpointStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type WebhookEndpoint struct {
+	Id          uuid.UUID `db:"id"`
+	UserId      uuid.UUID `db:"user_id"`
+	Url         string    `db:"url"`
+	Secret      string    `db:"secret"`
+	Description *string   `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+func (s *WebhookEndpointStore) Create(ctx context.Context, userId uuid.UUID, url string, secret string, description *string) (*WebhookEndpoint, error) {
+	const insert = `INSERT INTO webhook_endpoints (user_id, url, secret, description) VALUES ($1, $2, $3, $4) RETURNING *`
+	var endpoint WebhookEndpoint
+	if err := s.db.GetContext(ctx, &endpoint, insert, userId, url, secret, description); err != nil {
+		return nil, fmt.Errorf("failed to insert webhook endpoint for user %s: %w", userId, err)
+	}
+
+	return &endpoint, nil
+}
+
+func (s *WebhookEndpointStore) ByPrimaryKey(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*WebhookEndpoint, error) {
+	const query = `SELECT * FROM webhook_endpoints WHERE user_id = $1 AND id = $2`
+	var endpoint WebhookEndpoint
+	if err := s.db.GetContext(ctx, &endpoint, query, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to query webhook endpoint for user %s: %w", userId, err)
+	}
+
+	return &endpoint, nil
+}
+
+func (s *WebhookEndpointStore) ByUser(ctx context.Context, userId uuid.UUID) ([]WebhookEndpoint, error) {
+	const query = `SELECT * FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at`
+	var endpoints []WebhookEndpoint
+	if err := s.db.SelectContext(ctx, &endpoints, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to query webhook endpoints for user %s: %w", userId, err)
+	}
+
+	return endpoints, nil
+}
+
+func (s *WebhookEndpointStore) Delete(ctx context.Context, userId uuid.UUID, id uuid.UUID) error {
+	const deleteStatement = `DELETE FROM webhook_endpoints WHERE user_id = $1 AND id = $2 RETURNING id`
+	var deletedId uuid.UUID
+	if err := s.db.GetContext(ctx, &deletedId, deleteStatement, userId, id); err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint %s for user %s: %w", id, userId, err)
+	}
+
+	return nil
+}
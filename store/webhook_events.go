@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	_ "github.com/lib/pq"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+type WebhookEventStore struct {
+	db *sqlx.DB
+}
+
+func NewWebhookEventStore(db *sql.DB) *WebhookEventStore {
+	return &WebhookEventStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type WebhookEvent struct {
+	Id          uuid.UUID      `db:"id"`
+	UserId      uuid.UUID      `db:"user_id"`
+	ReportId    uuid.UUID      `db:"report_id"`
+	EventType   string         `db:"event_type"`
+	Payload     types.JSONText `db:"payload"`
+	CallbackUrl *string        `db:"callback_url"`
+	CreatedAt   time.Time      `db:"created_at"`
+}
+
+type WebhookDelivery struct {
+	Id             uuid.UUID  `db:"id"`
+	EventId        uuid.UUID  `db:"event_id"`
+	EndpointId     *uuid.UUID `db:"endpoint_id"`
+	Url            string     `db:"url"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	LastAttemptAt  *time.Time `db:"last_attempt_at"`
+	ResponseStatus *int       `db:"response_status"`
+	LastError      *string    `db:"last_error"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// ClaimedWebhookDelivery is a delivery together with what is needed to send it.
+type ClaimedWebhookDelivery struct {
+	Id             uuid.UUID      `db:"id"`
+	EventId        uuid.UUID      `db:"event_id"`
+	Url            string         `db:"url"`
+	Attempts       int            `db:"attempts"`
+	UserId         uuid.UUID      `db:"user_id"`
+	Payload        types.JSONText `db:"payload"`
+	EndpointSecret *string        `db:"endpoint_secret"`
+}
+
+// Publish stores the event and queues a delivery to each of the user's webhook endpoints and to the
+// event's callback url. Nothing is stored and nil is returned when there is nowhere to deliver to.
+func (s *WebhookEventStore) Publish(ctx context.Context, event *WebhookEvent) (*WebhookEvent, error) {
+	const insert = `WITH event AS (
+                   INSERT INTO webhook_events (id, user_id, report_id, event_type, payload, callback_url)
+                   SELECT $1::UUID, $2::UUID, $3::UUID, $4::VARCHAR, $5::JSONB, $6::VARCHAR
+                   WHERE $6::VARCHAR IS NOT NULL OR EXISTS (SELECT 1 FROM webhook_endpoints WHERE user_id = $2)
+                   RETURNING *
+               ), endpoint_deliveries AS (
+                   INSERT INTO webhook_deliveries (event_id, endpoint_id, url)
+                   SELECT event.id, endpoints.id, endpoints.url FROM event JOIN webhook_endpoints endpoints ON endpoints.user_id = event.user_id
+               ), callback_delivery AS (
+                   INSERT INTO webhook_deliveries (event_id, url)
+                   SELECT event.id, event.callback_url FROM event WHERE event.callback_url IS NOT NULL
+               )
+               SELECT * FROM event`
+
+	var published WebhookEvent
+	if err := s.db.GetContext(ctx, &published, insert,
+		event.Id,
+		event.UserId,
+		event.ReportId,
+		event.EventType,
+		event.Payload,
+		event.CallbackUrl); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to publish webhook event for report %s: %w", event.ReportId, err)
+	}
+
+	return &published, nil
+}
+
+func (s *WebhookEventStore) ByPrimaryKey(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*WebhookEvent, error) {
+	const query = `SELECT * FROM webhook_events WHERE user_id = $1 AND id = $2`
+	var event WebhookEvent
+	if err := s.db.GetContext(ctx, &event, query, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to query webhook event for user %s: %w", userId, err)
+	}
+
+	return &event, nil
+}
+
+// Redeliver queues new deliveries of an existing event to the user's current endpoints and the event's callback url.
+func (s *WebhookEventStore) Redeliver(ctx context.Context, userId uuid.UUID, eventId uuid.UUID) ([]WebhookDelivery, error) {
+	const insert = `INSERT INTO webhook_deliveries (event_id, endpoint_id, url)
+                   SELECT events.id, endpoints.id, endpoints.url FROM webhook_events events
+                   JOIN webhook_endpoints endpoints ON endpoints.user_id = events.user_id
+                   WHERE events.user_id = $1 AND events.id = $2
+                   UNION ALL
+                   SELECT events.id, NULL, events.callback_url FROM webhook_events events
+                   WHERE events.user_id = $1 AND events.id = $2 AND events.callback_url IS NOT NULL
+                   RETURNING *`
+
+	var deliveries []WebhookDelivery
+	if err := s.db.SelectContext(ctx, &deliveries, insert, userId, eventId); err != nil {
+		return nil, fmt.Errorf("failed to redeliver webhook event %s: %w", eventId, err)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDeliveries locks up to limit due deliveries until leaseUntil and counts the attempt.
+func (s *WebhookEventStore) ClaimDeliveries(ctx context.Context, limit int, leaseUntil time.Time) ([]ClaimedWebhookDelivery, error) {
+	const update = `WITH claimed AS (
+                   UPDATE webhook_deliveries SET
+                   attempts = attempts + 1,
+                   next_attempt_at = $2,
+                   last_attempt_at = CURRENT_TIMESTAMP
+                   WHERE id IN (
+                       SELECT id FROM webhook_deliveries
+                       WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+                       ORDER BY next_attempt_at
+                       LIMIT $1
+                       FOR UPDATE SKIP LOCKED
+                   ) RETURNING *
+               )
+               SELECT claimed.id, claimed.event_id, claimed.url, claimed.attempts, events.user_id, events.payload,
+               endpoints.secret AS endpoint_secret
+               FROM claimed
+               JOIN webhook_events events ON events.id = claimed.event_id
+               LEFT JOIN webhook_endpoints endpoints ON endpoints.id = claimed.endpoint_id`
+
+	var deliveries []ClaimedWebhookDelivery
+	if err := s.db.SelectContext(ctx, &deliveries, update, limit, leaseUntil); err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (s *WebhookEventStore) RecordAttempt(ctx context.Context, id uuid.UUID, status string, responseStatus *int, lastError *string, nextAttemptAt time.Time) error {
+	const update = `UPDATE webhook_deliveries SET
+                   status = $1,
+                   response_status = $2,
+                   last_error = $3,
+                   next_attempt_at = $4
+                   WHERE id = $5`
+	if _, err := s.db.ExecContext(ctx, update, status, responseStatus, lastError, nextAttemptAt, id); err != nil {
+		return fmt.Errorf("failed to record attempt of webhook delivery %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *WebhookEventStore) DeliveriesByEndpoint(ctx context.Context, userId uuid.UUID, endpointId uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	const query = `SELECT deliveries.* FROM webhook_deliveries deliveries
+                   JOIN webhook_endpoints endpoints ON endpoints.id = deliveries.endpoint_id
+                   WHERE endpoints.user_id = $1 AND endpoints.id = $2
+                   ORDER BY deliveries.created_at DESC
+                   LIMIT $3`
+
+	var deliveries []WebhookDelivery
+	if err := s.db.SelectContext(ctx, &deliveries, query, userId, endpointId, limit); err != nil {
+		return nil, fmt.Errorf("failed to query deliveries of webhook endpoint %s: %w", endpointId, err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,107 @@
+package store_test
+
+import (
+	"asyncapi/fixtures"
+	"asyncapi/store"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookStores(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() { cleanup(t) })
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db)
+	endpointStore := store.NewWebhookEndpointStore(env.Db)
+	eventStore := store.NewWebhookEventStore(env.Db)
+
+	user, err := userStore.CreateUser(ctx, "test@test.com", "secretpswd")
+	require.NoError(t, err)
+
+	// nothing is stored while the user has nowhere to receive events
+	event, err := eventStore.Publish(ctx, &store.WebhookEvent{
+		Id:        uuid.New(),
+		UserId:    user.Id,
+		ReportId:  uuid.New(),
+		EventType: "report.completed",
+		Payload:   []byte(`{"type":"report.completed"}`),
+	})
+	require.NoError(t, err)
+	require.Nil(t, event)
+
+	endpoint, err := endpointStore.Create(ctx, user.Id, "https://example.com/hooks", "whsec_test", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/hooks", endpoint.Url)
+	require.Equal(t, "whsec_test", endpoint.Secret)
+
+	endpoints, err := endpointStore.ByUser(ctx, user.Id)
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+
+	callbackUrl := "https://example.com/callback"
+	event, err = eventStore.Publish(ctx, &store.WebhookEvent{
+		Id:          uuid.New(),
+		UserId:      user.Id,
+		ReportId:    uuid.New(),
+		EventType:   "report.completed",
+		Payload:     []byte(`{"type":"report.completed"}`),
+		CallbackUrl: &callbackUrl,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, event)
+
+	leaseUntil := time.Now().Add(time.Minute)
+	claimed, err := eventStore.ClaimDeliveries(ctx, 10, leaseUntil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	for _, delivery := range claimed {
+		require.Equal(t, event.Id, delivery.EventId)
+		require.Equal(t, user.Id, delivery.UserId)
+		require.Equal(t, 1, delivery.Attempts)
+		require.JSONEq(t, `{"type":"report.completed"}`, delivery.Payload.String())
+		if delivery.Url == endpoint.Url {
+			require.Equal(t, endpoint.Secret, *delivery.EndpointSecret)
+		} else {
+			require.Equal(t, callbackUrl, delivery.Url)
+			require.Nil(t, delivery.EndpointSecret)
+		}
+	}
+
+	claimed, err = eventStore.ClaimDeliveries(ctx, 10, leaseUntil)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	deliveries, err := eventStore.DeliveriesByEndpoint(ctx, user.Id, endpoint.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+
+	responseStatus := 500
+	errMsg := "webhook receiver responded with status 500"
+	require.NoError(t, eventStore.RecordAttempt(ctx, deliveries[0].Id, store.WebhookDeliveryPending, &responseStatus, &errMsg, time.Now().Add(-time.Second)))
+	claimed, err = eventStore.ClaimDeliveries(ctx, 10, leaseUntil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, 2, claimed[0].Attempts)
+
+	responseStatus = 200
+	require.NoError(t, eventStore.RecordAttempt(ctx, deliveries[0].Id, store.WebhookDeliverySucceeded, &responseStatus, nil, time.Now()))
+	deliveries, err = eventStore.DeliveriesByEndpoint(ctx, user.Id, endpoint.Id, 10)
+	require.NoError(t, err)
+	require.Equal(t, store.WebhookDeliverySucceeded, deliveries[0].Status)
+	require.Equal(t, 200, *deliveries[0].ResponseStatus)
+
+	redelivered, err := eventStore.Redeliver(ctx, user.Id, event.Id)
+	require.NoError(t, err)
+	require.Len(t, redelivered, 2)
+
+	require.NoError(t, endpointStore.Delete(ctx, user.Id, endpoint.Id))
+	err = endpointStore.Delete(ctx, user.Id, endpoint.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
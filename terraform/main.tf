@@ -14,6 +14,14 @@ variable "sqs_queue" {
   type = string
 }
 
+variable "sqs_queue_high" {
+  type = string
+}
+
+variable "sqs_queue_low" {
+  type = string
+}
+
 variable "s3_bucket" {
   type = string
 }
@@ -47,10 +55,26 @@ resource "aws_s3_bucket" "reports-s3-bucket" {
   bucket = var.s3_bucket
 }
 
+# the worker short polls the queues of every priority in turn, so they must not long poll by default
 resource "aws_sqs_queue" "reports-sqs-queue" {
   name                      = var.sqs_queue
   delay_seconds             = 5
   max_message_size          = 2048
   message_retention_seconds = 86400
-  receive_wait_time_seconds = 10
+  receive_wait_time_seconds = 0
+}
+
+resource "aws_sqs_queue" "reports-sqs-queue-high" {
+  name                      = var.sqs_queue_high
+  max_message_size          = 2048
+  message_retention_seconds = 86400
+  receive_wait_time_seconds = 0
+}
+
+resource "aws_sqs_queue" "reports-sqs-queue-low" {
+  name                      = var.sqs_queue_low
+  delay_seconds             = 5
+  max_message_size          = 2048
+  message_retention_seconds = 86400
+  receive_wait_time_seconds = 0
 }
\ No newline at end of file